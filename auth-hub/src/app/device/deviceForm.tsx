@@ -0,0 +1,147 @@
+"use client";
+
+import { AUTH_SESSION_KEY } from "@/constants/auth";
+import { getDeviceAuthorization, verifyDevice } from "@/utils/api";
+import { DeviceVerificationResponse } from "@/types/session";
+import { useRouter, useSearchParams } from "next/navigation";
+import { useCallback, useEffect, useState } from "react";
+
+export default function DeviceForm() {
+  const [userCode, setUserCode] = useState("");
+  const [request, setRequest] = useState<DeviceVerificationResponse | null>(
+    null
+  );
+  const [result, setResult] = useState("");
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+  const router = useRouter();
+  const searchParams = useSearchParams();
+
+  const getSessionIdFromCookie = useCallback(() => {
+    const cookies = document.cookie.split("; ");
+    return (
+      cookies
+        .find((row) => row.startsWith(`${AUTH_SESSION_KEY}=`))
+        ?.split("=")[1] || undefined
+    );
+  }, []);
+
+  // ログインしていない場合はログイン後にこのページへ戻す
+  useEffect(() => {
+    if (!getSessionIdFromCookie()) {
+      const returnTo = `/device?${searchParams.toString()}`;
+      router.push(`/login?return_to=${encodeURIComponent(returnTo)}`);
+      return;
+    }
+    setUserCode(searchParams.get("user_code") ?? "");
+  }, [router, searchParams, getSessionIdFromCookie]);
+
+  const handleConfirm = async () => {
+    setError("");
+    const sessionId = getSessionIdFromCookie();
+    if (!sessionId) {
+      return;
+    }
+
+    try {
+      setIsLoading(true);
+      setRequest(await getDeviceAuthorization(userCode, sessionId));
+    } catch (err) {
+      console.error("コードの確認中にエラーが発生しました:", err);
+      setError("コードが無効か、有効期限が切れています");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleVerify = async (approve: boolean) => {
+    setError("");
+    const sessionId = getSessionIdFromCookie();
+    if (!sessionId) {
+      return;
+    }
+
+    try {
+      setIsLoading(true);
+      await verifyDevice(userCode, approve, sessionId);
+      setResult(
+        approve
+          ? "デバイスを承認しました。デバイスの画面に戻ってください。"
+          : "デバイスへのアクセスを拒否しました。"
+      );
+    } catch (err) {
+      console.error("デバイスの承認中にエラーが発生しました:", err);
+      setError("デバイスの承認に失敗しました。もう一度お試しください。");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="max-w-md mx-auto">
+      <div className="bg-white p-8 rounded-lg shadow-sm border border-zinc-200">
+        <h2 className="text-2xl font-semibold text-zinc-800 mb-6">
+          デバイスの接続
+        </h2>
+        {error && <p className="text-red-600 text-center mb-4">{error}</p>}
+        {result ? (
+          <p className="text-zinc-700 text-center">{result}</p>
+        ) : request ? (
+          <div className="space-y-4">
+            <p className="text-zinc-700">
+              <span className="font-mono">{request.client_id}</span>{" "}
+              が次の権限を要求しています
+            </p>
+            <p className="p-3 bg-zinc-50 rounded-md border border-zinc-200 font-mono text-sm">
+              {request.scope || "(スコープなし)"}
+            </p>
+            <div className="flex gap-4">
+              <button
+                type="button"
+                onClick={() => handleVerify(true)}
+                className="flex-1 bg-zinc-800 text-white py-2 px-4 rounded-md hover:bg-zinc-700 transition duration-150 ease-in-out disabled:opacity-50 disabled:cursor-not-allowed"
+                disabled={isLoading}
+              >
+                承認
+              </button>
+              <button
+                type="button"
+                onClick={() => handleVerify(false)}
+                className="flex-1 border border-zinc-300 text-zinc-700 py-2 px-4 rounded-md hover:bg-zinc-100 transition duration-150 ease-in-out disabled:opacity-50 disabled:cursor-not-allowed"
+                disabled={isLoading}
+              >
+                拒否
+              </button>
+            </div>
+          </div>
+        ) : (
+          <div className="space-y-4">
+            <label
+              htmlFor="user_code"
+              className="block text-sm font-medium text-zinc-700 mb-1"
+            >
+              デバイスに表示されたコード
+            </label>
+            <input
+              id="user_code"
+              type="text"
+              value={userCode}
+              onChange={(e) => setUserCode(e.target.value)}
+              placeholder="XXXX-XXXX"
+              className="w-full px-4 py-2 border border-zinc-300 rounded-md font-mono uppercase focus:outline-none focus:ring-2 focus:ring-zinc-400 focus:border-transparent transition"
+              disabled={isLoading}
+            />
+            <button
+              type="button"
+              onClick={handleConfirm}
+              className="w-full bg-zinc-800 text-white py-2 px-4 rounded-md hover:bg-zinc-700 transition duration-150 ease-in-out disabled:opacity-50 disabled:cursor-not-allowed"
+              disabled={isLoading || !userCode}
+            >
+              {isLoading ? "処理中..." : "次へ"}
+            </button>
+          </div>
+        )}
+      </div>
+    </div>
+  );
+}
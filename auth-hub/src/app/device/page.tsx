@@ -0,0 +1,12 @@
+"use client";
+
+import { Suspense } from "react";
+import DeviceForm from "./deviceForm";
+
+export default function DevicePage() {
+  return (
+    <Suspense fallback={<div>Loading...</div>}>
+      <DeviceForm />
+    </Suspense>
+  );
+}
@@ -18,6 +18,10 @@ type SSOParams = {
   codeChallengeMethod: string;
   responseType: string;
   scope: string;
+  nonce: string;
+  claims: string;
+  resources: string[];
+  requestUri: string;
 };
 
 // バリデーションスキーマの定義
@@ -45,11 +49,19 @@ const getSSOParams = (searchParams: URLSearchParams): SSOParams => {
     codeChallengeMethod: searchParams.get("code_challenge_method") ?? "",
     responseType: searchParams.get("response_type") ?? "",
     scope: searchParams.get("scope") ?? "",
+    nonce: searchParams.get("nonce") ?? "",
+    claims: searchParams.get("claims") ?? "",
+    resources: searchParams.getAll("resource"),
+    requestUri: searchParams.get("request_uri") ?? "",
   };
 };
 
 // SSOパラメータのバリデーション
 const isSSOParamsValid = (ssoParams: SSOParams): boolean => {
+  // PARの場合は認可リクエストのパラメータがサーバー側に保存されている
+  if (ssoParams.requestUri) {
+    return !!ssoParams.clientId;
+  }
   return !!(
     ssoParams.clientId &&
     ssoParams.state &&
@@ -61,6 +73,12 @@ const isSSOParamsValid = (ssoParams: SSOParams): boolean => {
   );
 };
 
+// ログイン後の遷移先の取得関数（オープンリダイレクトを防ぐため同一オリジンのパスのみ許可）
+const getReturnTo = (searchParams: URLSearchParams): string => {
+  const returnTo = searchParams.get("return_to") ?? "";
+  return /^\/(?![/\\])/.test(returnTo) ? returnTo : "/";
+};
+
 export default function LoginForm() {
   const [error, setError] = useState("");
   const [isLoading, setIsLoading] = useState(false);
@@ -98,7 +116,7 @@ export default function LoginForm() {
           throw new Error("セッションIDが見つかりません");
         }
 
-        const authCode = await authorize(
+        const { authorization_code, redirect_uri, state } = await authorize(
           {
             client_id: ssoParams.clientId,
             redirect_uri: ssoParams.redirectUri,
@@ -106,13 +124,18 @@ export default function LoginForm() {
             code_challenge_method: ssoParams.codeChallengeMethod,
             response_type: ssoParams.responseType,
             scope: ssoParams.scope,
+            nonce: ssoParams.nonce,
+            claims: ssoParams.claims,
+            resources: ssoParams.resources,
+            request_uri: ssoParams.requestUri,
           },
           sessionId
         );
 
-        const finalRedirectUri = new URL(ssoParams.redirectUri);
-        finalRedirectUri.searchParams.set("code", authCode);
-        finalRedirectUri.searchParams.set("state", ssoParams.state);
+        // PARの場合はサーバー側で検証済みのリダイレクトURIとstateを使用する
+        const finalRedirectUri = new URL(redirect_uri || ssoParams.redirectUri);
+        finalRedirectUri.searchParams.set("code", authorization_code);
+        finalRedirectUri.searchParams.set("state", state || ssoParams.state);
 
         window.location.href = finalRedirectUri.toString();
       } catch (err) {
@@ -133,7 +156,7 @@ export default function LoginForm() {
         if (isSSOParamsValid(ssoParams)) {
           await handleSSORedirect(ssoParams);
         } else {
-          router.push("/");
+          router.push(getReturnTo(searchParams));
         }
       }
     };
@@ -158,7 +181,7 @@ export default function LoginForm() {
       if (isSSOParamsValid(ssoParams)) {
         await handleSSORedirect(ssoParams);
       } else {
-        router.push("/");
+        router.push(getReturnTo(searchParams));
       }
     } catch (err) {
       console.error("ログイン処理中にエラーが発生しました:", err);
@@ -5,10 +5,16 @@ export interface SessionRequest {
   code_challenge_method: string;
   response_type: string;
   scope: string;
+  nonce?: string;
+  claims?: string;
+  resources?: string[];
+  request_uri?: string;
 }
 
 export interface SessionResponse {
   authorization_code: string;
+  redirect_uri: string;
+  state?: string;
 }
 
 export interface SessionError {
@@ -24,3 +30,9 @@ export interface APIError {
   message: string;
   status?: number;
 }
+
+export interface DeviceVerificationResponse {
+  client_id: string;
+  scope: string;
+  status: string;
+}
@@ -1,4 +1,8 @@
-import { SessionRequest, SessionResponse } from "@/types/session";
+import {
+  DeviceVerificationResponse,
+  SessionRequest,
+  SessionResponse,
+} from "@/types/session";
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL;
 
@@ -9,16 +13,33 @@ if (!API_URL) {
 export async function authorize(
   request: SessionRequest,
   sessionId: string
-): Promise<string> {
+): Promise<SessionResponse> {
   const url = new URL(`${API_URL}/api/oauth/authorize`);
 
   // クエリパラメータの設定
   url.searchParams.set("client_id", request.client_id);
-  url.searchParams.set("redirect_uri", request.redirect_uri);
-  url.searchParams.set("code_challenge", request.code_challenge);
-  url.searchParams.set("code_challenge_method", request.code_challenge_method);
-  url.searchParams.set("response_type", request.response_type);
-  url.searchParams.set("scope", request.scope);
+  if (request.request_uri) {
+    // PARの場合は request_uri のみを送信する
+    url.searchParams.set("request_uri", request.request_uri);
+  } else {
+    url.searchParams.set("redirect_uri", request.redirect_uri);
+    url.searchParams.set("code_challenge", request.code_challenge);
+    url.searchParams.set(
+      "code_challenge_method",
+      request.code_challenge_method
+    );
+    url.searchParams.set("response_type", request.response_type);
+    url.searchParams.set("scope", request.scope);
+    if (request.nonce) {
+      url.searchParams.set("nonce", request.nonce);
+    }
+    if (request.claims) {
+      url.searchParams.set("claims", request.claims);
+    }
+    request.resources?.forEach((resource) =>
+      url.searchParams.append("resource", resource)
+    );
+  }
 
   const response = await fetch(url.toString(), {
     method: "GET",
@@ -35,8 +56,7 @@ export async function authorize(
     throw new Error(error.message || "Failed to create session");
   }
 
-  const data = (await response.json()) as SessionResponse;
-  return data.authorization_code;
+  return (await response.json()) as SessionResponse;
 }
 
 export async function authenticate(
@@ -65,3 +85,47 @@ export async function authenticate(
     expiresIn: data.expires_in,
   };
 }
+
+export async function getDeviceAuthorization(
+  userCode: string,
+  sessionId: string
+): Promise<DeviceVerificationResponse> {
+  const url = new URL(`${API_URL}/api/oauth/device/verify`);
+  url.searchParams.set("user_code", userCode);
+
+  const response = await fetch(url.toString(), {
+    method: "GET",
+    credentials: "include",
+    headers: {
+      "X-Auth-Session": sessionId,
+    },
+  });
+
+  if (!response.ok) {
+    throw new Error("Invalid user code");
+  }
+
+  return (await response.json()) as DeviceVerificationResponse;
+}
+
+export async function verifyDevice(
+  userCode: string,
+  approve: boolean,
+  sessionId: string
+): Promise<DeviceVerificationResponse> {
+  const response = await fetch(`${API_URL}/api/oauth/device/verify`, {
+    method: "POST",
+    credentials: "include",
+    headers: {
+      "Content-Type": "application/json",
+      "X-Auth-Session": sessionId,
+    },
+    body: JSON.stringify({ user_code: userCode, approve }),
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to verify device");
+  }
+
+  return (await response.json()) as DeviceVerificationResponse;
+}
@@ -0,0 +1,140 @@
+// Package authz はリソースサーバー向けの認可ヘルパーです
+// 認証基盤が発行したアクセストークンの scope / groups / roles クレームから、操作の権限を判定します
+//
+// トークンの署名検証はリソースサーバー側で行い、検証済みのクレームを渡して使用します
+//
+//	policy := authz.Policy{
+//		Roles:  map[string][]string{"store-1:admin": {"orders.read", "orders.write"}},
+//		Groups: map[string][]string{"staff": {"orders.read"}},
+//	}
+//	http.HandleFunc("/orders", authz.Require(verify, policy, "orders.write", handleOrders))
+package authz
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Principal アクセストークンが表す利用者とクライアント
+type Principal struct {
+	Subject  string
+	ClientID string
+	Scopes   []string
+	Groups   []string
+	Roles    []string
+}
+
+// NewPrincipal 検証済みのアクセストークンのクレームから Principal を作成します
+func NewPrincipal(claims map[string]interface{}) *Principal {
+	principal := &Principal{}
+	principal.Subject, _ = claims["sub"].(string)
+	principal.ClientID, _ = claims["client_id"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	}
+	principal.Groups = stringList(claims["groups"])
+	principal.Roles = stringList(claims["roles"])
+	return principal
+}
+
+// HasScope アクセストークンに指定したスコープが付与されているかを返します
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole 利用者が指定したロールを持つかを返します
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// InGroup 利用者が指定したグループに所属するかを返します
+func (p *Principal) InGroup(group string) bool {
+	return slices.Contains(p.Groups, group)
+}
+
+// Policy ロール・グループごとに許可する権限の定義
+type Policy struct {
+	Roles  map[string][]string `json:"roles,omitempty"`
+	Groups map[string][]string `json:"groups,omitempty"`
+}
+
+// Permissions 利用者のロールとグループに許可された権限の一覧を返します
+func (p Policy) Permissions(principal *Principal) []string {
+	var permissions []string
+	for _, role := range principal.Roles {
+		permissions = append(permissions, p.Roles[role]...)
+	}
+	for _, group := range principal.Groups {
+		permissions = append(permissions, p.Groups[group]...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+// Allows 利用者のロールまたはグループに指定した権限が許可されているかを返します
+func (p Policy) Allows(principal *Principal, permission string) bool {
+	return slices.Contains(p.Permissions(principal), permission)
+}
+
+// TokenVerifier アクセストークンの署名と有効期限を検証し、クレームを返す関数
+type TokenVerifier func(token string) (map[string]interface{}, error)
+
+type principalContextKey struct{}
+
+// Require Bearer トークンを検証し、指定した権限を持つ場合のみ next を呼び出すミドルウェアです
+// トークンが無効な場合は 401、権限がない場合は 403 を返します
+// next では FromContext で Principal を取得できます
+func Require(verify TokenVerifier, policy Policy, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || token == "" || !strings.EqualFold(scheme, "Bearer") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := verify(token)
+		if err != nil {
+			log.Printf("Invalid access token: %v", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		principal := NewPrincipal(claims)
+		if !policy.Allows(principal, permission) {
+			log.Printf("Permission denied: sub=%s, permission=%s", principal.Subject, permission)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+	}
+}
+
+// FromContext Require で検証した Principal を取得します
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+// stringList JSON の配列 (デコード済み) を文字列のスライスに変換します
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+// assignroles はユーザーのグループとロールを直接ユーザーの保存先に設定するツールです
+// ロール割り当てAPIには hub-admin ロールが必要なため、最初の管理者の設定に使用します
+//
+// 使い方:
+//
+//	REDIS_ADDR=localhost:6379 go run ./cmd/assignroles -email admin@example.com -roles hub-admin
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"backend/model"
+	"backend/store"
+)
+
+func main() {
+	email := flag.String("email", "", "対象ユーザーのメールアドレス")
+	groups := flag.String("groups", "", "設定するグループ (カンマ区切り)。省略時は変更しない")
+	roles := flag.String("roles", "", "設定するロール (カンマ区切り)。省略時は変更しない")
+	flag.Parse()
+
+	if *email == "" {
+		flag.Usage()
+		log.Fatal("-email is required")
+	}
+
+	repos, err := store.Open()
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	ctx := context.Background()
+	user, err := repos.Users.GetUserByEmail(ctx, *email)
+	if err != nil {
+		log.Fatalf("Failed to get user: %v", err)
+	}
+	// 取得後の他の変更を上書きしないよう、保存先の最新のユーザー情報に割り当てを反映する
+	user, err = repos.Users.ModifyUser(ctx, user.ID, func(user *model.User) error {
+		if *groups != "" {
+			user.Groups = splitNames(*groups)
+		}
+		if *roles != "" {
+			user.Roles = splitNames(*roles)
+		}
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to update user: %v", err)
+	}
+	log.Printf("User roles updated: user=%s, groups=%v, roles=%v", user.ID, user.Groups, user.Roles)
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
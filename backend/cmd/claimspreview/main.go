@@ -0,0 +1,144 @@
+// claimspreview はクライアントのクレームマッピングを適用したトークンの内容を確認するためのツールです
+// Redis やサーバーの起動なしに、指定したユーザーに対して発行される ID トークン・アクセストークン・UserInfo を表示します
+//
+// 使い方:
+//
+//	go run ./cmd/claimspreview -clients clients.json -client demo-store-1 -user user.json -scope "openid profile email"
+//
+// トークンの有効期間はサーバーと同じく LIFETIME_POLICY_FILE とクライアントの設定から計算します
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"backend/config"
+	"backend/handler"
+	"backend/model"
+	"backend/store"
+	"backend/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func main() {
+	clientsFile := flag.String("clients", "", "CLIENTS_FILE と同じ形式のクライアント定義ファイル")
+	clientID := flag.String("client", "", "プレビューするクライアントのID")
+	userFile := flag.String("user", "", "ユーザー情報 (JSON) のファイル")
+	scope := flag.String("scope", "openid profile email", "要求するスコープ")
+	grantType := flag.String("grant-type", "authorization_code", "トークンの有効期間の計算に使用するグラントタイプ")
+	flag.Parse()
+
+	if *clientsFile == "" || *clientID == "" || *userFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := config.LoadLifetimes(); err != nil {
+		log.Fatalf("Failed to load lifetimes: %v", err)
+	}
+	client, err := loadClient(*clientsFile, *clientID)
+	if err != nil {
+		log.Fatalf("Failed to load client: %v", err)
+	}
+	var user model.User
+	if err := readJSON(*userFile, &user); err != nil {
+		log.Fatalf("Failed to load user: %v", err)
+	}
+
+	// 表示用のため、鍵は保存せずにその場で生成する
+	if err := utils.InitJWKS(context.Background(), store.NewMemoryStore()); err != nil {
+		log.Fatalf("Failed to initialize JWKS: %v", err)
+	}
+
+	lifetimes := config.Lifetimes(client, *grantType)
+	now := time.Now()
+	authentication := model.NewAuthenticationContext(now, model.AMRPassword)
+	preview, err := handler.PreviewClaims(client, &user, authentication, *scope)
+	if err != nil {
+		log.Fatalf("Failed to apply claims mapping: %v", err)
+	}
+
+	// 実際のトークンと同じく登録済みのクレームを付与するため、署名したトークンを生成してから内容を表示する
+	// sub はペアワイズ識別子を使用するクライアントでも内部のユーザーIDのまま表示する
+	accessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:   user.ID,
+		ClientID:  client.ClientID,
+		Scope:     *scope,
+		IssuedAt:  now,
+		ExpiresIn: lifetimes.AccessTokenTTL,
+		Claims:    preview.AccessToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate access token: %v", err)
+	}
+	idToken, err := utils.GenerateIDToken(utils.IDTokenParams{
+		Subject:     user.ID,
+		ClientID:    client.ClientID,
+		IssuedAt:    now,
+		ExpiresIn:   lifetimes.IDTokenTTL,
+		AuthTime:    authentication.AuthTime,
+		AMR:         authentication.AMR,
+		ACR:         authentication.ACR,
+		AccessToken: accessToken,
+		Claims:      preview.IDToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate ID token: %v", err)
+	}
+	preview.UserInfo["sub"] = user.ID
+
+	result := map[string]interface{}{
+		"id_token":     decodeClaims(idToken),
+		"access_token": decodeClaims(accessToken),
+		"userinfo":     preview.UserInfo,
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatalf("Failed to encode result: %v", err)
+	}
+}
+
+// loadClient クライアント定義ファイルから指定したクライアントを読み込み、クレームマッピングと有効期間を検証します
+func loadClient(path string, clientID string) (*model.Client, error) {
+	var clients []model.Client
+	if err := readJSON(path, &clients); err != nil {
+		return nil, err
+	}
+	for i := range clients {
+		if clients[i].ClientID != clientID {
+			continue
+		}
+		if err := utils.ValidateClaimsMapping(clients[i].ClaimsMapping); err != nil {
+			return nil, fmt.Errorf("invalid claims_mapping: %w", err)
+		}
+		if err := config.ValidateClientLifetimes(clients[i]); err != nil {
+			return nil, err
+		}
+		return &clients[i], nil
+	}
+	return nil, fmt.Errorf("client not found: %s", clientID)
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeClaims 生成したトークンのペイロードを取り出します
+func decodeClaims(token string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		log.Fatalf("Failed to decode token: %v", err)
+	}
+	return claims
+}
@@ -0,0 +1,72 @@
+// migraterecords は Redis に保存されたレコードを現在の保存形式のバージョンで保存し直すツールです
+// サービスを止めずに実行でき、中断した場合は次回の実行で続きから再開します
+//
+// 保存形式のバージョンを上げた場合は、すべてのインスタンスを更新した後に実行してください
+// 実行しなくても読み出し時に変換されますが、実行すると古い形式の変換処理を削除できるようになります
+//
+// STORE_ENCRYPTION_KEY_FILE を指定した場合は、暗号化されていないユーザー情報を暗号化し、
+// 現在の鍵 (current) 以外で暗号化されたユーザー情報と、レコードのキーを追加認証データにしていない以前の形式の暗号文を暗号化し直します
+// 鍵を切り替えた後は、すべてのインスタンスが新しい鍵ファイルを読み込んでから実行し、完了するまで古い鍵を鍵ファイルから削除しないでください
+//
+// -store postgres の場合は、PostgreSQL (DATABASE_URL) の users テーブルを同じように保存し直し、
+// email 列をブラインドインデックスに置き換えます (進捗は保存しないため、中断した場合は最初から走査します)
+//
+// 使い方:
+//
+//	REDIS_ADDR=localhost:6379 go run ./cmd/migraterecords -dry-run
+//	REDIS_ADDR=localhost:6379 go run ./cmd/migraterecords -batch 500
+//	DATABASE_URL=postgres://... go run ./cmd/migraterecords -store postgres
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"backend/store"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "書き換えずに、書き換えが必要なレコードを数える")
+	batchSize := flag.Int64("batch", 100, "1回の SCAN で走査するキーの数の目安")
+	restart := flag.Bool("restart", false, "保存された進捗を破棄して最初から走査する")
+	backend := flag.String("store", store.BackendRedis, "移行する保存先 (redis, postgres)")
+	flag.Parse()
+
+	options := store.RecordMigrationOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+		Restart:   *restart,
+	}
+	var results []store.RecordMigrationStats
+	var err error
+	switch *backend {
+	case store.BackendRedis:
+		if initErr := store.InitRedis(); initErr != nil {
+			log.Fatalf("Failed to initialize Redis: %v", initErr)
+		}
+		s := &store.RedisStore{}
+		results, err = s.MigrateRecords(context.Background(), options)
+	case store.BackendPostgres:
+		s, openErr := store.OpenPostgres(os.Getenv("DATABASE_URL"))
+		if openErr != nil {
+			log.Fatalf("Failed to initialize PostgreSQL: %v", openErr)
+		}
+		defer s.Close()
+		results, err = s.MigrateRecords(context.Background(), options)
+	default:
+		log.Fatalf("Unsupported store: %s", *backend)
+	}
+	for _, stats := range results {
+		fmt.Printf("%-18s scanned=%d migrated=%d invalid=%d resumed=%d\n",
+			stats.Prefix, stats.Scanned, stats.Migrated, stats.Invalid, stats.Resumed)
+	}
+	if err != nil {
+		log.Fatalf("Failed to migrate records: %v", err)
+	}
+	if *dryRun {
+		log.Println("Dry run: no records were changed")
+	}
+}
@@ -0,0 +1,85 @@
+// repairusers は Redis のユーザー情報とメールアドレスのインデックスの不整合を検出・修復するツールです
+// 既定では検出結果の表示のみを行い、-reindex や -delete-orphans を指定した場合のみ変更します
+//
+//   - インデックスのないユーザー: 現在の形式のインデックスを登録します (-reindex)
+//   - 以前の形式のインデックスが残っているユーザー: 平文のメールアドレスを含むインデックスを削除します (-reindex)
+//   - 到達できないユーザー: インデックスが別のユーザーを指しているユーザーを削除します (-delete-orphans)
+//
+// メールアドレスの正規化やブラインドインデックスを導入した後は、すべてのインスタンスを更新してから一度 -reindex を実行してください
+// サーバーは入力された表記と正規化した表記のインデックスのみを参照するため (インデックスの走査は行いません)、
+// 実行するまでは登録時と異なる表記 (大文字・小文字など) で入力したメールアドレスで以前のユーザーに到達できず、別のユーザーが作成されます
+//
+// 到達できないユーザーに発行済みのリフレッシュトークンは、削除後は使用できなくなります
+// ブラインドインデックスを使用する場合は、サーバーと同じ STORE_ENCRYPTION_KEY_FILE を指定してください
+//
+// 使い方:
+//
+//	REDIS_ADDR=localhost:6379 go run ./cmd/repairusers -reindex
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend/store"
+)
+
+func main() {
+	reindex := flag.Bool("reindex", false, "インデックスのないユーザーのインデックスを登録し、以前の形式のインデックスを削除する")
+	deleteOrphans := flag.Bool("delete-orphans", false, "インデックスから到達できないユーザーを削除する")
+	flag.Parse()
+
+	if err := store.InitRedis(); err != nil {
+		log.Fatalf("Failed to initialize Redis: %v", err)
+	}
+	s := &store.RedisStore{}
+
+	var missing, orphaned, legacy, restored, deleted, cleaned int
+	err := s.FindUserIndexIssues(context.Background(), func(ctx context.Context, issue store.UserIndexIssue) error {
+		user := issue.User
+		if issue.Orphaned() {
+			orphaned++
+			fmt.Printf("orphaned  user=%s email=%s indexed_user=%s\n", user.ID, user.Email, issue.IndexedUserID)
+			if *deleteOrphans {
+				if err := s.DeleteOrphanedUser(ctx, user); err != nil {
+					return fmt.Errorf("failed to delete user %s: %w", user.ID, err)
+				}
+				deleted++
+			}
+			return nil
+		}
+
+		if issue.IndexedUserID == user.ID {
+			legacy++
+			fmt.Printf("legacy    user=%s email=%s\n", user.ID, user.Email)
+			if *reindex {
+				if err := s.DeleteLegacyEmailIndex(ctx, user); err != nil {
+					return fmt.Errorf("failed to delete legacy index for user %s: %w", user.ID, err)
+				}
+				cleaned++
+			}
+			return nil
+		}
+
+		missing++
+		fmt.Printf("no-index  user=%s email=%s\n", user.ID, user.Email)
+		if *reindex {
+			ok, err := s.RestoreUserEmailIndex(ctx, user)
+			if err != nil {
+				return fmt.Errorf("failed to restore index for user %s: %w", user.ID, err)
+			}
+			// 同じメールアドレスの別のユーザーが先に登録した場合は、次回の実行で到達できないユーザーとして検出される
+			if ok {
+				restored++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to scan users: %v", err)
+	}
+
+	log.Printf("Missing index: %d (restored: %d), legacy index: %d (deleted: %d), orphaned: %d (deleted: %d)", missing, restored, legacy, cleaned, orphaned, deleted)
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"backend/model"
+	"backend/utils"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+)
+
+// Clients 登録済みのOAuthクライアント一覧
+var Clients []model.Client
+
+// デフォルトのクライアント定義 (デモストアはすべてパブリッククライアント)
+var defaultClients = []model.Client{
+	{
+		ClientID:                "demo-store-1",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		RedirectURIs:            []string{"http://localhost:3000/callback"},
+	},
+	{
+		ClientID:                "demo-store-2",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		RedirectURIs:            []string{"http://localhost:3001/callback"},
+	},
+	{
+		ClientID:                "demo-store-3",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		RedirectURIs:            []string{"http://localhost:3003/callback"},
+	},
+}
+
+// loadClients クライアント定義を読み込みます
+// CLIENTS_FILE が設定されている場合はJSONファイルから読み込み、未設定の場合はデフォルト定義を使用します
+func loadClients() error {
+	path := os.Getenv("CLIENTS_FILE")
+	if path == "" {
+		setClients(defaultClients)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CLIENTS_FILE: %w", err)
+	}
+
+	var clients []model.Client
+	if err := json.Unmarshal(data, &clients); err != nil {
+		return fmt.Errorf("invalid CLIENTS_FILE format: %w", err)
+	}
+
+	pairwise := false
+	for i := range clients {
+		client := &clients[i]
+		if client.ClientID == "" {
+			return fmt.Errorf("client_id is required in CLIENTS_FILE")
+		}
+		if client.UsesClientSecret() && client.ClientSecretHash == "" {
+			return fmt.Errorf("client_secret_hash is required for confidential client: %s", client.ClientID)
+		}
+		if client.PKCEOptional && !client.IsConfidential() {
+			return fmt.Errorf("pkce_optional is only allowed for confidential client: %s", client.ClientID)
+		}
+		if err := validateRedirectURIs(*client); err != nil {
+			return err
+		}
+		if err := validateTLSClientAuth(*client); err != nil {
+			return err
+		}
+		if err := validateRolePatterns(*client); err != nil {
+			return err
+		}
+		if err := ValidateClientLifetimes(*client); err != nil {
+			return err
+		}
+		if err := utils.ValidateClaimsMapping(client.ClaimsMapping); err != nil {
+			return fmt.Errorf("invalid claims_mapping for client %s: %w", client.ClientID, err)
+		}
+		switch client.SubjectType {
+		case "", "public":
+		case "pairwise":
+			pairwise = true
+			if err := loadSectorRedirectURIs(client); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported subject_type for client %s: %s", client.ClientID, client.SubjectType)
+		}
+	}
+
+	if pairwise {
+		if err := loadPairwiseSubjectSecret(); err != nil {
+			return err
+		}
+	}
+
+	setClients(clients)
+	return nil
+}
+
+// validateRedirectURIs 登録するリダイレクトURIを検証します
+// 認可コードグラントを使用するクライアントは、フラグメントを含まない絶対URIを1つ以上登録する (RFC 6749 Section 3.1.2)
+func validateRedirectURIs(client model.Client) error {
+	if slices.Contains(client.GrantTypes, "authorization_code") && len(client.RedirectURIs) == 0 {
+		return fmt.Errorf("redirect_uris is required for authorization_code client: %s", client.ClientID)
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("invalid redirect_uri for client %s: %s", client.ClientID, redirectURI)
+		}
+	}
+	return nil
+}
+
+// validateTLSClientAuth mTLS クライアント認証 (RFC 8705) の設定を検証します
+func validateTLSClientAuth(client model.Client) error {
+	switch client.TokenEndpointAuthMethod {
+	case "tls_client_auth":
+		identifiers := 0
+		for _, value := range []string{
+			client.TLSClientAuthSubjectDN,
+			client.TLSClientAuthSANDNS,
+			client.TLSClientAuthSANURI,
+			client.TLSClientAuthSANIP,
+			client.TLSClientAuthSANEmail,
+		} {
+			if value != "" {
+				identifiers++
+			}
+		}
+		if identifiers != 1 {
+			return fmt.Errorf("exactly one tls_client_auth_* value is required for client: %s", client.ClientID)
+		}
+		if MTLSTrustedCAs == nil {
+			return fmt.Errorf("MTLS_CA_FILE is required for tls_client_auth client: %s", client.ClientID)
+		}
+	case "self_signed_tls_client_auth":
+		if len(client.JWKS) == 0 && client.JWKSURI == "" {
+			return fmt.Errorf("jwks or jwks_uri is required for self_signed_tls_client_auth client: %s", client.ClientID)
+		}
+	}
+	return nil
+}
+
+// validateRolePatterns allowed_groups / allowed_roles のパターンを検証します
+func validateRolePatterns(client model.Client) error {
+	for _, pattern := range slices.Concat(client.AllowedGroups, client.AllowedRoles) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed_groups or allowed_roles pattern for client %s: %s", client.ClientID, pattern)
+		}
+	}
+	return nil
+}
+
+func setClients(clients []model.Client) {
+	Clients = clients
+	ClientIDs = make([]string, 0, len(clients))
+	for _, client := range clients {
+		ClientIDs = append(ClientIDs, client.ClientID)
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"backend/model"
+	"backend/utils"
 	"encoding/base64"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 )
 
@@ -13,11 +16,13 @@ var (
 	JWTSecret               []byte
 	AuthSessionCookieName   string
 	AuthSessionCookieDomain string
+	DeviceVerificationURI   string
+	AuthorizationEndpoint   string
+	APIBaseURL              string
 )
 
 func Init() error {
 	AllowedOrigins = strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",")
-	ClientIDs = strings.Split("demo-store-1,demo-store-2,demo-store-3", ",")
 
 	encodedSecret := os.Getenv("JWT_SECRET")
 	if encodedSecret == "" {
@@ -42,5 +47,48 @@ func Init() error {
 	if AuthSessionCookieDomain == "" {
 		return fmt.Errorf("AUTH_SESSION_COOKIE_DOMAIN environment variable is not set")
 	}
+	// デバイス認可の確認ページと、利用者がログインする認可エンドポイントはいずれも auth-hub の画面
+	// 未設定の場合は auth-hub のURL (CORS_ALLOWED_ORIGINS の先頭) から決める
+	authHubURL := strings.TrimSuffix(strings.TrimSpace(AllowedOrigins[0]), "/")
+	DeviceVerificationURI = envOrDefault("DEVICE_VERIFICATION_URI", authHubURL, "/device")
+	// ディスカバリーで公開する
+	AuthorizationEndpoint = envOrDefault("AUTHORIZATION_ENDPOINT", authHubURL, "/login")
+	if AuthorizationEndpoint == "" {
+		return fmt.Errorf("AUTHORIZATION_ENDPOINT or CORS_ALLOWED_ORIGINS environment variable must be set")
+	}
+	// このサーバー (API) の外部から見たURL。トークンエンドポイントなどのURLとしてディスカバリーで公開する
+	// 未設定の場合は発行者識別子と同じURLで公開しているものとする
+	APIBaseURL = strings.TrimSuffix(envOrDefault("API_BASE_URL", utils.Issuer, ""), "/")
+
+	if err := loadMTLS(); err != nil {
+		return err
+	}
+	if err := LoadLifetimes(); err != nil {
+		return err
+	}
+	if err := loadClients(); err != nil {
+		return err
+	}
+	// デバイス認可グラントを使用するクライアントがいる場合のみ確認ページのURLが必要
+	if DeviceVerificationURI == "" && slices.ContainsFunc(Clients, func(client model.Client) bool {
+		return client.AllowsGrantType("urn:ietf:params:oauth:grant-type:device_code")
+	}) {
+		return fmt.Errorf("DEVICE_VERIFICATION_URI or CORS_ALLOWED_ORIGINS environment variable must be set to use the device_code grant")
+	}
+	if err := loadResources(); err != nil {
+		return err
+	}
 	return nil
 }
+
+// envOrDefault 環境変数の値を返します
+// 未設定の場合は baseURL に path を付けたURLを返し、baseURL も空の場合は空文字列を返します
+func envOrDefault(name string, baseURL string, path string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if baseURL == "" {
+		return ""
+	}
+	return baseURL + path
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"backend/model"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DefaultLifetimes サーバーの既定のトークンとセッションの有効期間
+// クライアントごとの設定 (lifetimes / grant_lifetimes) で上書きできます
+var DefaultLifetimes model.LifetimePolicy
+
+// 組み込みの既定値
+var defaultLifetimes = model.LifetimePolicy{
+	AccessTokenTTL:          60 * 60,
+	IDTokenTTL:              60 * 60,
+	RefreshTokenIdleTTL:     30 * 24 * 60 * 60,
+	RefreshTokenAbsoluteTTL: 30 * 24 * 60 * 60,
+	SessionIdleTTL:          24 * 60 * 60,
+	SessionAbsoluteTTL:      24 * 60 * 60,
+}
+
+// LoadLifetimes 既定の有効期間を読み込みます (Init から呼び出します)
+// LIFETIME_POLICY_FILE が設定されている場合はJSONファイルの値で組み込みの既定値を上書きします
+func LoadLifetimes() error {
+	DefaultLifetimes = defaultLifetimes
+	path := os.Getenv("LIFETIME_POLICY_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read LIFETIME_POLICY_FILE: %w", err)
+	}
+	var policy model.LifetimePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("invalid LIFETIME_POLICY_FILE format: %w", err)
+	}
+	DefaultLifetimes = defaultLifetimes.Override(&policy)
+	if err := validateLifetimes(DefaultLifetimes); err != nil {
+		return fmt.Errorf("invalid LIFETIME_POLICY_FILE: %w", err)
+	}
+	return nil
+}
+
+// ValidateClientLifetimes クライアントの有効期間の設定を検証します
+// 既定値に重ねた結果を、クライアント全体とグラントタイプごとに検証します
+func ValidateClientLifetimes(client model.Client) error {
+	if err := validateClientPolicy(client.LifetimesFor(DefaultLifetimes, "")); err != nil {
+		return fmt.Errorf("invalid lifetimes for client %s: %w", client.ClientID, err)
+	}
+	for grantType := range client.GrantLifetimes {
+		if !client.AllowsGrantType(grantType) {
+			return fmt.Errorf("grant_lifetimes for client %s contains a grant type that is not allowed: %s", client.ClientID, grantType)
+		}
+		if err := validateClientPolicy(client.LifetimesFor(DefaultLifetimes, grantType)); err != nil {
+			return fmt.Errorf("invalid grant_lifetimes for client %s (%s): %w", client.ClientID, grantType, err)
+		}
+	}
+	return nil
+}
+
+// validateClientPolicy クライアントごとの有効期間を検証します
+// 認証セッションはクライアントをまたいで共有し、サーバーの既定値で失効するため、
+// クライアントはセッションの有効期間を短くすることだけができます (既定値より長い値は延長されないため設定ミスとして扱います)
+func validateClientPolicy(policy model.LifetimePolicy) error {
+	if err := validateLifetimes(policy); err != nil {
+		return err
+	}
+	if policy.SessionIdleTTL > DefaultLifetimes.SessionIdleTTL {
+		return fmt.Errorf("session_idle_ttl must not exceed the server default (%d)", DefaultLifetimes.SessionIdleTTL)
+	}
+	if policy.SessionAbsoluteTTL > DefaultLifetimes.SessionAbsoluteTTL {
+		return fmt.Errorf("session_absolute_ttl must not exceed the server default (%d)", DefaultLifetimes.SessionAbsoluteTTL)
+	}
+	return nil
+}
+
+// validateLifetimes 有効期間が正の値で、アイドル期間が絶対的な期間を超えないことを確認します
+func validateLifetimes(policy model.LifetimePolicy) error {
+	for name, ttl := range map[string]int64{
+		"access_token_ttl":           policy.AccessTokenTTL,
+		"id_token_ttl":               policy.IDTokenTTL,
+		"refresh_token_idle_ttl":     policy.RefreshTokenIdleTTL,
+		"refresh_token_absolute_ttl": policy.RefreshTokenAbsoluteTTL,
+		"session_idle_ttl":           policy.SessionIdleTTL,
+		"session_absolute_ttl":       policy.SessionAbsoluteTTL,
+	} {
+		if ttl <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	if policy.RefreshTokenIdleTTL > policy.RefreshTokenAbsoluteTTL {
+		return fmt.Errorf("refresh_token_idle_ttl must not exceed refresh_token_absolute_ttl")
+	}
+	if policy.SessionIdleTTL > policy.SessionAbsoluteTTL {
+		return fmt.Errorf("session_idle_ttl must not exceed session_absolute_ttl")
+	}
+	return nil
+}
+
+// Lifetimes クライアントがグラントタイプで発行するトークンの有効期間を返します
+func Lifetimes(client *model.Client, grantType string) model.LifetimePolicy {
+	return client.LifetimesFor(DefaultLifetimes, grantType)
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	// MTLSTrustedCAs tls_client_auth で受け入れるクライアント証明書の発行元CA
+	MTLSTrustedCAs *x509.CertPool
+	// MTLSClientCertHeader TLSを終端するプロキシがクライアント証明書を転送するヘッダー名
+	// プロキシが同名のヘッダーを上書きする環境でのみ設定してください
+	MTLSClientCertHeader string
+	// MTLSTrustedProxies MTLSClientCertHeader を受け入れる接続元 (TLSを終端するプロキシ) のアドレス範囲
+	// それ以外の接続元から送られたヘッダーは、利用者が証明書を偽って送ったものとみなして無視する
+	MTLSTrustedProxies []*net.IPNet
+	// TLSCertFile / TLSKeyFile が設定されている場合はサーバー自身がTLSを終端します (ローカルでの mTLS 検証用)
+	TLSCertFile string
+	TLSKeyFile  string
+)
+
+// loadMTLS mTLS クライアント認証 (RFC 8705) の設定を読み込みます
+func loadMTLS() error {
+	MTLSClientCertHeader = os.Getenv("MTLS_CLIENT_CERT_HEADER")
+	MTLSTrustedProxies = nil
+	for _, cidr := range strings.Split(os.Getenv("MTLS_TRUSTED_PROXY_CIDRS"), ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid MTLS_TRUSTED_PROXY_CIDRS: %w", err)
+		}
+		MTLSTrustedProxies = append(MTLSTrustedProxies, network)
+	}
+	if MTLSClientCertHeader != "" && len(MTLSTrustedProxies) == 0 {
+		return fmt.Errorf("MTLS_TRUSTED_PROXY_CIDRS must be set when MTLS_CLIENT_CERT_HEADER is set")
+	}
+	TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (TLSCertFile == "") != (TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	path := os.Getenv("MTLS_CA_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read MTLS_CA_FILE: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("invalid MTLS_CA_FILE format: no certificates found")
+	}
+	MTLSTrustedCAs = pool
+	return nil
+}
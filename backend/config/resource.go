@@ -0,0 +1,81 @@
+package config
+
+import (
+	"backend/model"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Resources 登録済みのAPIリソース一覧
+var Resources []model.Resource
+
+// デフォルトのAPIリソース定義
+var defaultResources = []model.Resource{
+	{
+		Identifier: "https://api.example.com/catalog",
+		Name:       "Catalog API",
+		Scopes:     []string{"catalog.read"},
+	},
+	{
+		Identifier: "https://api.example.com/cart",
+		Name:       "Cart API",
+		Scopes:     []string{"cart.read", "cart.write"},
+	},
+	{
+		Identifier: "https://api.example.com/orders",
+		Name:       "Orders API",
+		Scopes:     []string{"orders.read", "orders.write"},
+	},
+}
+
+// loadResources APIリソースの定義を読み込みます
+// API_RESOURCES_FILE が設定されている場合はJSONファイルから読み込み、未設定の場合はデフォルト定義を使用します
+func loadResources() error {
+	path := os.Getenv("API_RESOURCES_FILE")
+	if path == "" {
+		Resources = defaultResources
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read API_RESOURCES_FILE: %w", err)
+	}
+
+	var resources []model.Resource
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return fmt.Errorf("invalid API_RESOURCES_FILE format: %w", err)
+	}
+
+	for _, resource := range resources {
+		if !IsValidResourceIndicator(resource.Identifier) {
+			return fmt.Errorf("invalid resource identifier: %s", resource.Identifier)
+		}
+	}
+
+	Resources = resources
+	return nil
+}
+
+// GetResource リソース識別子から登録済みのAPIリソースを取得します
+func GetResource(identifier string) (*model.Resource, bool) {
+	for i := range Resources {
+		if Resources[i].Identifier == identifier {
+			return &Resources[i], true
+		}
+	}
+	return nil, false
+}
+
+// IsValidResourceIndicator RFC 8707 Section 2 に従いリソース識別子の形式を検証します
+// 絶対URIであり、フラグメントを含まないことが必要です
+func IsValidResourceIndicator(identifier string) bool {
+	u, err := url.Parse(identifier)
+	if err != nil {
+		return false
+	}
+	return u.IsAbs() && !strings.Contains(identifier, "#")
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"backend/model"
+)
+
+// PairwiseSubjectSecret ペアワイズ識別子の計算に使用する秘密鍵
+var PairwiseSubjectSecret []byte
+
+// loadPairwiseSubjectSecret PAIRWISE_SUBJECT_SECRET を読み込みます
+// 値を変更すると発行済みのペアワイズ識別子がすべて変わるため、一度設定したら変更しないでください
+func loadPairwiseSubjectSecret() error {
+	encoded := os.Getenv("PAIRWISE_SUBJECT_SECRET")
+	if encoded == "" {
+		return fmt.Errorf("PAIRWISE_SUBJECT_SECRET environment variable is required for pairwise clients")
+	}
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid PAIRWISE_SUBJECT_SECRET format: must be base64 encoded")
+	}
+	if len(secret) < 32 {
+		return fmt.Errorf("PAIRWISE_SUBJECT_SECRET must be at least 32 bytes after decoding")
+	}
+	PairwiseSubjectSecret = secret
+	return nil
+}
+
+// loadSectorRedirectURIs セクター識別子URIからリダイレクトURIの一覧を取得します (OpenID Connect Core 1.0 Section 8.1)
+func loadSectorRedirectURIs(client *model.Client) error {
+	u, err := url.Parse(client.SectorIdentifierURI)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("sector_identifier_uri must be an https URL for pairwise client: %s", client.ClientID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.SectorIdentifierURI, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sector_identifier_uri for %s: %w", client.ClientID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch sector_identifier_uri for %s: status %d", client.ClientID, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+
+	var redirectURIs []string
+	if err := json.Unmarshal(body, &redirectURIs); err != nil || len(redirectURIs) == 0 {
+		return fmt.Errorf("sector_identifier_uri for %s must return a JSON array of redirect URIs", client.ClientID)
+	}
+	// 登録済みのリダイレクトURIはすべてセクター識別子URIの一覧に含まれている必要がある (Section 8.1)
+	for _, redirectURI := range client.RedirectURIs {
+		if !slices.Contains(redirectURIs, redirectURI) {
+			return fmt.Errorf("redirect_uri %s for %s is not listed in sector_identifier_uri", redirectURI, client.ClientID)
+		}
+	}
+	client.SectorRedirectURIs = redirectURIs
+	return nil
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"backend/config"
 	"backend/model"
-	"backend/store"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -41,10 +40,10 @@ func Authenticate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 仮実装: ユーザーを取得または作成
-	user, err := store.GetOrCreateUser(req.Email)
+	user, err := repos.Users.GetOrCreateUser(r.Context(), req.Email)
 	if err != nil {
 		log.Printf("Failed to get or create user: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -56,25 +55,29 @@ func Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 認証セッション有効期限（24時間）
-	expiresIn := 24 * 60 * 60
+	// 認証セッションの有効期限 (サーバーの既定の有効期間に従う)
+	// ログインの時点ではクライアントが決まらないため、クライアントごとの設定は認可時に確認する (requireClientSession)
+	lifetimes := config.DefaultLifetimes
 	now := time.Now()
-	expiresAt := now.Add(time.Duration(expiresIn) * time.Second)
+	expiresAt := lifetimes.SessionExpiry(now, now)
 
 	// 認証セッションの作成
 	authSession := model.AuthSession{
-		SessionID:  sessionID,
-		UserID:     user.ID,
-		Email:      user.Email,
-		CreatedAt:  now,
-		ExpiresAt:  expiresAt,
-		IsLoggedIn: true,
+		SessionID:    sessionID,
+		UserID:       user.ID,
+		Email:        user.Email,
+		CreatedAt:    now,
+		ExpiresAt:    expiresAt,
+		LastActiveAt: now,
+		IsLoggedIn:   true,
+		// 仮実装: パスワードによる単一要素認証として記録する
+		AuthenticationContext: model.NewAuthenticationContext(now, model.AMRPassword),
 	}
 
 	// 認証セッションの保存
-	if err := store.SaveAuthSession(sessionID, authSession); err != nil {
+	if err := repos.Sessions.SaveAuthSession(r.Context(), sessionID, authSession); err != nil {
 		log.Printf("Failed to save auth session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
@@ -86,15 +89,16 @@ func Authenticate(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: false,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   expiresIn,
-		Domain:   config.AuthSessionCookieDomain,
+		// 使用するたびに延長されるため、Cookie はログインからの絶対的な有効期間まで保持する
+		MaxAge: int(lifetimes.SessionAbsoluteTTL),
+		Domain: config.AuthSessionCookieDomain,
 	}
 	http.SetCookie(w, cookie)
 
 	// レスポンスの作成
 	resp := model.LoginResponse{
 		SessionID: sessionID,
-		ExpiresIn: expiresIn,
+		ExpiresIn: int(expiresAt.Sub(now).Seconds()),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -107,3 +111,84 @@ func Authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// requireAuthSession X-Auth-Session ヘッダーからログイン済みの認証セッションを取得します
+// 認証セッションが無効な場合はエラーレスポンスを書き込み、false を返します
+func requireAuthSession(w http.ResponseWriter, r *http.Request) (*model.AuthSession, bool) {
+	// 認証セッションIDを取得
+	authSessionID := r.Header.Get("X-Auth-Session")
+	if authSessionID == "" {
+		log.Println("Missing auth session ID")
+		http.Error(w, "Missing auth session ID", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// 認証セッションの有効性確認
+	authSession, err := repos.Sessions.GetAuthSession(r.Context(), authSessionID)
+	if err != nil {
+		log.Printf("Invalid auth session: %v", err)
+		writeStoreError(w, err, http.StatusUnauthorized, "Invalid auth session")
+		return nil, false
+	}
+
+	// 有効期限切れ確認
+	if time.Now().After(authSession.ExpiresAt) {
+		log.Println("Auth session expired")
+		http.Error(w, "Auth session expired", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// ログイン状態確認
+	if !authSession.IsLoggedIn {
+		log.Println("User not logged in")
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	touchAuthSession(r, authSessionID, *authSession)
+	return authSession, true
+}
+
+// authSessionTouchInterval 認証セッションの有効期限を延長する間隔
+// リクエストのたびに保存し直さないよう、前回の延長からこの期間が過ぎた場合のみ延長する
+const authSessionTouchInterval = time.Minute
+
+// touchAuthSession 認証セッションの最終利用時刻を更新し、アイドル期間の有効期限を延長します
+// 延長できなくても今回のリクエストは処理できるため、失敗はログに記録するのみとする
+func touchAuthSession(r *http.Request, sessionID string, session model.AuthSession) {
+	now := time.Now()
+	expiresAt := config.DefaultLifetimes.SessionExpiry(session.CreatedAt, now)
+	if expiresAt.Sub(session.ExpiresAt) < authSessionTouchInterval {
+		return
+	}
+	session.ExpiresAt = expiresAt
+	session.LastActiveAt = now
+	if err := repos.Sessions.SaveAuthSession(r.Context(), sessionID, session); err != nil {
+		log.Printf("Failed to extend auth session: %v", err)
+	}
+}
+
+// requireClientSession 認証セッションがクライアントの有効期間の設定 (session_idle_ttl / session_absolute_ttl) を満たすか確認します
+// サーバーの既定値より短い期間を設定したクライアントでは、既定値では有効なセッションでも再ログインを求める
+// 満たさない場合はエラーレスポンスを書き込み、false を返します
+func requireClientSession(w http.ResponseWriter, r *http.Request, authSession *model.AuthSession, clientID string, grantType string) bool {
+	client, err := repos.Clients.GetClient(r.Context(), clientID)
+	if err != nil {
+		log.Printf("Failed to get client: %v", err)
+		writeStoreError(w, err, http.StatusBadRequest, "Invalid client")
+		return false
+	}
+
+	// requireAuthSession が延長する前の最終利用時刻 (以前のセッションはログイン時刻)
+	lastActiveAt := authSession.LastActiveAt
+	if lastActiveAt.IsZero() {
+		lastActiveAt = authSession.CreatedAt
+	}
+	expiresAt := config.Lifetimes(client, grantType).SessionExpiry(authSession.CreatedAt, lastActiveAt)
+	if !time.Now().Before(expiresAt) {
+		log.Printf("Auth session expired for client %s", clientID)
+		http.Error(w, "Auth session expired", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
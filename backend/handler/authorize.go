@@ -1,15 +1,13 @@
 package handler
 
 import (
-	"backend/config"
 	"backend/model"
-	"backend/store"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 )
@@ -24,67 +22,54 @@ func Authorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 認証セッションIDを取得
-	authSessionID := r.Header.Get("X-Auth-Session")
-	if authSessionID == "" {
-		log.Println("Missing auth session ID")
-		http.Error(w, "Missing auth session ID", http.StatusUnauthorized)
+	// 認証セッションの検証
+	authSession, ok := requireAuthSession(w, r)
+	if !ok {
 		return
 	}
 
-	// 認証セッションの有効性確認
-	authSession, err := store.GetAuthSession(authSessionID)
-	if err != nil {
-		log.Printf("Invalid auth session: %v", err)
-		http.Error(w, "Invalid auth session", http.StatusUnauthorized)
-		return
-	}
-
-	// 有効期限切れ確認
-	if time.Now().After(authSession.ExpiresAt) {
-		log.Println("Auth session expired")
-		http.Error(w, "Auth session expired", http.StatusUnauthorized)
-		return
+	// 認可リクエストの取得
+	// request_uri にPARで発行したURNが指定された場合は、事前に検証・保存されたパラメータのみを使用する (RFC 9126 Section 4)
+	var authRequest *model.AuthorizationRequest
+	var err error
+	query := r.URL.Query()
+	if requestURI := query.Get("request_uri"); strings.HasPrefix(requestURI, requestURIPrefix) {
+		// request_uri は一度しか使用できないため、再ログインを求める場合は request_uri を使用する前に判定する
+		// (再ログインの後に同じ request_uri で認可リクエストをやり直せるようにする)
+		if !requireClientSession(w, r, authSession, query.Get("client_id"), "authorization_code") {
+			return
+		}
+		authRequest, err = resolvePushedAuthorizationRequest(r.Context(), query.Get("client_id"), requestURI)
+		if err != nil {
+			log.Printf("Invalid request_uri: %v", err)
+			writeStoreError(w, err, http.StatusBadRequest, "Invalid request_uri")
+			return
+		}
+	} else {
+		authRequest, err = resolveAuthorizationRequest(r.Context(), query, false)
+		if err != nil {
+			var reqErr *authorizationRequestError
+			if errors.As(err, &reqErr) {
+				http.Error(w, reqErr.Description, reqErr.status())
+				return
+			}
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		// クライアントごとのセッションの有効期間を満たさない場合は再ログインを求める
+		if !requireClientSession(w, r, authSession, authRequest.ClientID, "authorization_code") {
+			return
+		}
 	}
 
-	// ログイン状態確認
-	if !authSession.IsLoggedIn {
-		log.Println("User not logged in")
-		http.Error(w, "User not logged in", http.StatusUnauthorized)
-		return
-	}
-
-	responseType := r.URL.Query().Get("response_type")
-	if responseType != "code" {
-		log.Printf("Invalid response type: %s", responseType)
-		http.Error(w, "Invalid response type", http.StatusBadRequest)
-		return
-	}
-
-	scope := r.URL.Query().Get("scope")
-	scopes := strings.Fields(scope)
-	if !slices.Contains(scopes, "openid") {
-		log.Printf("Missing openid scope. Provided scopes: %v", scopes)
-		http.Error(w, "Missing openid scope", http.StatusBadRequest)
-		return
-	}
-
-	clientID := r.URL.Query().Get("client_id")
-	redirectURI := r.URL.Query().Get("redirect_uri")
-	codeChallenge := r.URL.Query().Get("code_challenge")
-	codeChallengeMethod := r.URL.Query().Get("code_challenge_method")
-
-	if clientID == "" || redirectURI == "" || codeChallenge == "" {
-		log.Printf("Missing required fields: client_id=%s, redirect_uri=%s, code_challenge=%s",
-			clientID, redirectURI, codeChallenge)
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
-		return
-	}
-
-	if !slices.Contains(config.ClientIDs, clientID) {
-		log.Printf("Invalid client ID: %s", clientID)
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
-		return
+	// acr が必須のクレームとして要求された場合は、現在の認証が要件を満たすことを確認する
+	if authRequest.Claims != nil {
+		if acr := authRequest.Claims.IDToken["acr"]; acr.IsEssential() && !acr.Accepts(authSession.ACR) {
+			log.Printf("Unmet authentication requirements: acr=%s", authSession.ACR)
+			http.Error(w, "Unmet authentication requirements", http.StatusBadRequest)
+			return
+		}
 	}
 
 	// 認可コードの生成
@@ -99,21 +84,28 @@ func Authorize(w http.ResponseWriter, r *http.Request) {
 		AuthorizationCode:   authCode,
 		UserID:              authSession.UserID, // 認証済みユーザーID
 		Email:               authSession.Email,  // ユーザーのメールアドレス
-		ClientID:            clientID,
-		CodeChallenge:       codeChallenge,
-		CodeChallengeMethod: codeChallengeMethod,
-		Scope:               scope,
-		RedirectURI:         redirectURI,
+		ClientID:            authRequest.ClientID,
+		CodeChallenge:       authRequest.CodeChallenge,
+		CodeChallengeMethod: authRequest.CodeChallengeMethod,
+		Scope:               authRequest.Scope,
+		RedirectURI:         authRequest.RedirectURI,
+		Resources:           authRequest.Resources,
+		Nonce:               authRequest.Nonce,
+		Claims:              authRequest.Claims,
 		CreatedAt:           time.Now(),
+		// IDトークンの auth_time / amr / acr として使用する
+		AuthenticationContext: authSession.AuthenticationContext,
 	}
 
-	if err := store.SaveAuthorizeSession(authCode, session); err != nil {
-		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+	if err := repos.Codes.SaveAuthorizeSession(r.Context(), authCode, session); err != nil {
+		writeStoreError(w, err, http.StatusInternalServerError, "Failed to save session")
 		return
 	}
 
 	resp := model.AuthorizeResponse{
 		AuthorizationCode: authCode,
+		RedirectURI:       authRequest.RedirectURI,
+		State:             authRequest.State,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
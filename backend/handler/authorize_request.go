@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"backend/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// authorizationRequestError 認可リクエストの検証エラー
+type authorizationRequestError struct {
+	Code        string // OAuth 2.0 のエラーコード
+	Description string
+}
+
+func (e *authorizationRequestError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// status エラーレスポンスのHTTPステータスコード
+func (e *authorizationRequestError) status() int {
+	if e.Code == "temporarily_unavailable" {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// clientLookupError 認可リクエストのクライアントを取得できなかった場合のエラー
+// 保存先の障害の場合は、クライアントIDの誤りと区別して temporarily_unavailable にします
+func clientLookupError(err error) *authorizationRequestError {
+	if isStoreUnavailable(err) {
+		return &authorizationRequestError{"temporarily_unavailable", "The authorization server is temporarily unavailable"}
+	}
+	return &authorizationRequestError{"invalid_request", "Invalid client ID"}
+}
+
+// parseAuthorizationRequest 認可リクエストのパラメータを検証します
+// 認可エンドポイントとPARエンドポイントで同じ検証を行うために使用します
+func parseAuthorizationRequest(ctx context.Context, params url.Values) (*model.AuthorizationRequest, error) {
+	responseType := params.Get("response_type")
+	if responseType != "code" {
+		log.Printf("Invalid response type: %s", responseType)
+		return nil, &authorizationRequestError{"unsupported_response_type", "Invalid response type"}
+	}
+
+	scope := params.Get("scope")
+	scopes := strings.Fields(scope)
+	if !slices.Contains(scopes, "openid") {
+		log.Printf("Missing openid scope. Provided scopes: %v", scopes)
+		return nil, &authorizationRequestError{"invalid_scope", "Missing openid scope"}
+	}
+
+	clientID := params.Get("client_id")
+	redirectURI := params.Get("redirect_uri")
+	codeChallenge := params.Get("code_challenge")
+	codeChallengeMethod := params.Get("code_challenge_method")
+
+	if clientID == "" || redirectURI == "" {
+		log.Printf("Missing required fields: client_id=%s, redirect_uri=%s", clientID, redirectURI)
+		return nil, &authorizationRequestError{"invalid_request", "Missing required fields"}
+	}
+
+	client, err := repos.Clients.GetClient(ctx, clientID)
+	if err != nil {
+		log.Printf("Invalid client ID: %s: %v", clientID, err)
+		return nil, clientLookupError(err)
+	}
+
+	// 登録済みのリダイレクトURIと完全一致するものだけを受け付ける (RFC 6749 Section 3.1.2.3)
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		log.Printf("Redirect URI not registered: client=%s, redirect_uri=%s", clientID, redirectURI)
+		return nil, &authorizationRequestError{"invalid_request", "Invalid redirect URI"}
+	}
+
+	// ペアワイズ識別子のクライアントは、セクター識別子URIに登録されたリダイレクトURIのみ使用できる
+	if client.IsPairwise() && !slices.Contains(client.SectorRedirectURIs, redirectURI) {
+		log.Printf("Redirect URI not registered in sector: client=%s, redirect_uri=%s", clientID, redirectURI)
+		return nil, &authorizationRequestError{"invalid_request", "Invalid redirect URI"}
+	}
+
+	// PKCEの検証 (RFC 7636)
+	codeChallengeMethod, err = validateCodeChallenge(client, codeChallenge, codeChallengeMethod)
+	if err != nil {
+		log.Printf("Invalid code challenge: client=%s, err=%v", clientID, err)
+		return nil, &authorizationRequestError{"invalid_request", "Invalid code_challenge or code_challenge_method"}
+	}
+
+	// claims パラメータの検証 (OpenID Connect Core 1.0 Section 5.5)
+	var claimsRequest *model.ClaimsRequest
+	if raw := params.Get("claims"); raw != "" {
+		claimsRequest = &model.ClaimsRequest{}
+		if err := json.Unmarshal([]byte(raw), claimsRequest); err != nil {
+			log.Printf("Invalid claims parameter: %v", err)
+			return nil, &authorizationRequestError{"invalid_request", "Invalid claims parameter"}
+		}
+	}
+
+	// リソースインジケーターの検証 (RFC 8707)
+	resources, err := parseResourceIndicators(params["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		return nil, &authorizationRequestError{"invalid_target", "Invalid resource"}
+	}
+
+	return &model.AuthorizationRequest{
+		ClientID:            clientID,
+		ResponseType:        responseType,
+		RedirectURI:         redirectURI,
+		Scope:               scope,
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		Claims:              claimsRequest,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		Resources:           resources,
+	}, nil
+}
+
+// resolveAuthorizationRequest リクエストオブジェクトを解決した上で認可リクエストを検証し、クライアントごとの要件を確認します
+// pushed はPARエンドポイントで受け付けたリクエストかどうかを表します
+func resolveAuthorizationRequest(ctx context.Context, params url.Values, pushed bool) (*model.AuthorizationRequest, error) {
+	params, signed, err := resolveRequestObject(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	authRequest, err := parseAuthorizationRequest(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := repos.Clients.GetClient(ctx, authRequest.ClientID)
+	if err != nil {
+		log.Printf("Invalid client ID: %s: %v", authRequest.ClientID, err)
+		return nil, clientLookupError(err)
+	}
+
+	// PARが必須のクライアントはクエリパラメータでの認可リクエストを受け付けない
+	if !pushed && client.RequirePushedAuthorizationRequests {
+		log.Printf("Pushed authorization request required for client: %s", client.ClientID)
+		return nil, &authorizationRequestError{"invalid_request", "Pushed authorization request required"}
+	}
+
+	// 署名付きリクエストオブジェクトが必須のクライアントは平文のパラメータを受け付けない
+	if client.RequireSignedRequestObject && !signed {
+		log.Printf("Signed request object required for client: %s", client.ClientID)
+		return nil, &authorizationRequestError{"invalid_request", "Signed request object required"}
+	}
+
+	return authRequest, nil
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"backend/model"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// クライアントごとのセッションの有効期間により再ログインを求める場合も、PARの request_uri は使用されずに残る
+func TestAuthorizePushedRequestSurvivesReLogin(t *testing.T) {
+	useMemoryStore(t)
+	saveTestClient(t, model.Client{
+		ClientID:                "client-1",
+		TokenEndpointAuthMethod: "none",
+		Lifetimes:               &model.LifetimePolicy{SessionAbsoluteTTL: 60},
+	})
+	requestURI := requestURIPrefix + "survives-relogin"
+	pushed := model.AuthorizationRequest{ClientID: "client-1", ResponseType: "code", RedirectURI: "https://client.example.com/callback", Scope: "openid"}
+	if err := repos.Codes.SavePushedAuthorizationRequest(context.Background(), requestURI, pushed, time.Minute); err != nil {
+		t.Fatalf("SavePushedAuthorizationRequest() error = %v", err)
+	}
+
+	authorize := func(sessionID string) int {
+		query := url.Values{"client_id": {"client-1"}, "request_uri": {requestURI}}
+		r := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+query.Encode(), nil)
+		r.Header.Set("X-Auth-Session", sessionID)
+		return serveTest(Authorize, r).Code
+	}
+
+	// ログインから2時間が経過しており、クライアントのセッションの有効期間 (60秒) を過ぎている
+	if got := authorize(saveTestAuthSession(t, time.Now().Add(-2*time.Hour))); got != http.StatusUnauthorized {
+		t.Fatalf("Authorize() with an expired client session = %d, want %d", got, http.StatusUnauthorized)
+	}
+	// 再ログインした後は同じ request_uri で認可できる
+	if got := authorize(saveTestAuthSession(t, time.Now())); got != http.StatusOK {
+		t.Fatalf("Authorize() after re-login = %d, want %d", got, http.StatusOK)
+	}
+}
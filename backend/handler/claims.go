@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"backend/model"
+	"log"
+	"slices"
+	"strings"
+)
+
+// スコープごとに返却するクレーム (OpenID Connect Core 1.0 Section 5.4)
+var scopeClaims = map[string][]string{
+	"profile": {"name", "family_name", "given_name", "picture", "locale", "zoneinfo", "updated_at"},
+	"email":   {"email", "email_verified"},
+	// 電話番号の確認の仕組みがない間、phone_number_verified は false を返す
+	"phone":   {"phone_number", "phone_number_verified"},
+	"address": {"address"},
+}
+
+// userClaims ユーザーの標準クレームを返します
+// 値が設定されていないクレームは含めません
+func userClaims(user *model.User) map[string]interface{} {
+	claims := map[string]interface{}{
+		"email":          user.Email,
+		"email_verified": true,
+	}
+	for name, value := range map[string]string{
+		"name":         user.Name,
+		"given_name":   user.GivenName,
+		"family_name":  user.FamilyName,
+		"picture":      user.Picture,
+		"locale":       user.Locale,
+		"zoneinfo":     user.Zoneinfo,
+		"phone_number": user.PhoneNumber,
+	} {
+		if value != "" {
+			claims[name] = value
+		}
+	}
+	if user.PhoneNumber != "" {
+		claims["phone_number_verified"] = user.PhoneNumberVerified
+	}
+	if user.Address != nil {
+		claims["address"] = user.Address
+	}
+	if !user.UpdatedAt.IsZero() {
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return claims
+}
+
+// scopedUserClaims 付与されたスコープに応じてユーザーのクレームを絞り込みます
+// email / email_verified は従来どおりスコープに関わらず返します
+func scopedUserClaims(user *model.User, scope string) map[string]interface{} {
+	all := userClaims(user)
+	allowed := slices.Clone(scopeClaims["email"])
+	for _, s := range strings.Fields(scope) {
+		allowed = append(allowed, scopeClaims[s]...)
+	}
+
+	claims := map[string]interface{}{}
+	for name, value := range all {
+		if slices.Contains(allowed, name) {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// releasedUserClaims スコープと claims パラメータに応じて返却するユーザーのクレームを返します
+// claims パラメータで個別に要求されたクレームはスコープに含まれなくても返却し、
+// value / values が指定されている場合は値が一致する場合のみ返却します (OpenID Connect Core 1.0 Section 5.5.1)
+func releasedUserClaims(user *model.User, scope string, requested map[string]*model.ClaimRequest) map[string]interface{} {
+	claims := scopedUserClaims(user, scope)
+	if len(requested) == 0 {
+		return claims
+	}
+
+	all := userClaims(user)
+	for name, request := range requested {
+		value, ok := all[name]
+		if !ok {
+			if request.IsEssential() {
+				log.Printf("Essential claim is not available: %s", name)
+			}
+			continue
+		}
+		if !request.Accepts(value) {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
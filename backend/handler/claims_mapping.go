@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"backend/model"
+	"backend/utils"
+	"strings"
+)
+
+// applyClaimsMapping クライアントのクレームマッピング規則を対象のトークンのクレームに適用します
+// user はクライアント自身のトークン (client_credentials など) の場合は nil になります
+func applyClaimsMapping(client *model.Client, target string, user *model.User, authentication model.AuthenticationContext, scope string, claims map[string]interface{}) (map[string]interface{}, error) {
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+	if len(client.ClaimsMapping) == 0 {
+		return claims, nil
+	}
+
+	input, err := claimsMappingInput(client, user, authentication, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.ApplyClaimsMapping(client.ClaimsMapping, target, input, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// claimsMappingInput クレームマッピングの式から参照できる値を組み立てます
+// クライアントはシークレットや鍵を含めず、識別に必要な項目のみを渡します
+func claimsMappingInput(client *model.Client, user *model.User, authentication model.AuthenticationContext, scope string) (utils.ClaimsMappingInput, error) {
+	var userInput interface{} = map[string]interface{}{}
+	if user != nil {
+		userInput = user
+	}
+
+	session := map[string]interface{}{
+		"amr": authentication.AMR,
+		"acr": authentication.ACR,
+	}
+	if !authentication.AuthTime.IsZero() {
+		session["auth_time"] = authentication.AuthTime.Unix()
+	}
+
+	clientInput := map[string]interface{}{
+		"client_id":      client.ClientID,
+		"grant_types":    client.GrantTypes,
+		"allowed_scopes": client.AllowedScopes,
+		"subject_type":   client.SubjectType,
+	}
+
+	return utils.NewClaimsMappingInput(userInput, session, clientInput, strings.Fields(scope))
+}
+
+// ClaimsPreview クレームマッピング適用後の各トークンのクレーム
+type ClaimsPreview struct {
+	IDToken     map[string]interface{} `json:"id_token"`
+	AccessToken map[string]interface{} `json:"access_token"`
+	UserInfo    map[string]interface{} `json:"userinfo"`
+}
+
+// PreviewClaims 指定したユーザーとスコープでトークンを発行した場合のクレームを組み立てます
+// クレームマッピングの動作確認用で、トークンエンドポイント・UserInfo と同じ手順でクレームを解決します
+// sub などの登録済みのクレームはトークンの生成時に設定されるため含みません
+func PreviewClaims(client *model.Client, user *model.User, authentication model.AuthenticationContext, scope string) (*ClaimsPreview, error) {
+	idTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetIDToken, user, authentication, scope, scopedUserClaims(user, scope))
+	if err != nil {
+		return nil, err
+	}
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, user, authentication, scope, nil)
+	if err != nil {
+		return nil, err
+	}
+	userInfoClaims, err := applyClaimsMapping(client, model.ClaimsTargetUserInfo, user, model.AuthenticationContext{}, scope, scopedUserClaims(user, scope))
+	if err != nil {
+		return nil, err
+	}
+	return &ClaimsPreview{
+		IDToken:     idTokenClaims,
+		AccessToken: accessTokenClaims,
+		UserInfo:    userInfoClaims,
+	}, nil
+}
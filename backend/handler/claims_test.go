@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"backend/model"
+	"testing"
+)
+
+func TestScopedUserClaimsPhoneNumberVerified(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      model.User
+		scope     string
+		wantClaim bool
+	}{
+		{name: "phone scope", user: model.User{UserProfile: model.UserProfile{PhoneNumber: "+81 90-0000-0000"}}, scope: "openid phone", wantClaim: true},
+		{name: "no phone number", user: model.User{}, scope: "openid phone"},
+		{name: "no phone scope", user: model.User{UserProfile: model.UserProfile{PhoneNumber: "+81 90-0000-0000"}}, scope: "openid profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := scopedUserClaims(&tt.user, tt.scope)
+			verified, ok := claims["phone_number_verified"]
+			if ok != tt.wantClaim {
+				t.Fatalf("phone_number_verified present = %v, want %v (claims = %v)", ok, tt.wantClaim, claims)
+			}
+			// 電話番号を確認する仕組みがないため、確認済みとして返さない
+			if ok && verified != false {
+				t.Errorf("phone_number_verified = %v, want false", verified)
+			}
+		})
+	}
+}
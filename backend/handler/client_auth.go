@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"backend/model"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// errInvalidClient クライアント認証に失敗した場合のエラー (RFC 6749 invalid_client)
+var errInvalidClient = errors.New("invalid_client")
+
+// authenticateClient トークンエンドポイントでクライアントを認証します
+// client_secret_basic / client_secret_post / tls_client_auth / self_signed_tls_client_auth /
+// none (パブリッククライアント) に対応しています
+// r.ParseForm() の呼び出し後に使用してください
+func authenticateClient(r *http.Request) (*model.Client, error) {
+	clientID, clientSecret, hasBasic := r.BasicAuth()
+	method := "client_secret_basic"
+	if hasBasic {
+		// RFC 6749 Section 2.3.1 に従い、Basic認証の値はフォームエンコードされている
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return nil, fmt.Errorf("%w: malformed basic credentials", errInvalidClient)
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return nil, fmt.Errorf("%w: malformed basic credentials", errInvalidClient)
+		}
+		if formClientID := r.PostForm.Get("client_id"); formClientID != "" && formClientID != clientID {
+			return nil, fmt.Errorf("%w: client_id mismatch between header and body", errInvalidClient)
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+		method = "client_secret_post"
+		if clientSecret == "" {
+			method = "none"
+		}
+	}
+
+	client, err := repos.Clients.GetClient(r.Context(), clientID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown client: %s: %w", errInvalidClient, clientID, err)
+	}
+
+	// mTLS の場合はシークレットを送らず、client_id とクライアント証明書で認証する
+	if method == "none" && client.UsesTLSClientAuth() {
+		if err := authenticateTLSClient(r, client); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	if client.TokenEndpointAuthMethod != method {
+		return nil, fmt.Errorf("%w: client %s must authenticate with %s, got %s",
+			errInvalidClient, clientID, client.TokenEndpointAuthMethod, method)
+	}
+
+	if client.UsesClientSecret() && !verifyClientSecret(client, clientSecret) {
+		return nil, fmt.Errorf("%w: invalid client secret for %s", errInvalidClient, clientID)
+	}
+
+	return client, nil
+}
+
+// verifyClientSecret クライアントシークレットを定数時間で比較します
+func verifyClientSecret(client *model.Client, secret string) bool {
+	expected, err := hex.DecodeString(client.ClientSecretHash)
+	if err != nil {
+		return false
+	}
+	actual := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(expected, actual[:]) == 1
+}
+
+// writeClientAuthError クライアント認証失敗のレスポンスを返します
+// Basic認証が使われた場合は RFC 6749 Section 5.2 に従い 401 と WWW-Authenticate ヘッダーを返します
+// クライアントの取得で保存先に障害が発生した場合は、認証情報の誤りではないため temporarily_unavailable を返します
+func writeClientAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if isStoreUnavailable(err) {
+		writeTemporarilyUnavailable(w)
+		return
+	}
+	if _, _, ok := r.BasicAuth(); ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+	writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Client authentication failed")
+}
@@ -0,0 +1,509 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/store"
+	"backend/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// デバイス認可グラントのグラントタイプ (RFC 8628 Section 3.4)
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	// デバイスコードの有効期限（10分）
+	deviceCodeExpiresIn = 10 * 60
+	// トークンエンドポイントへのポーリング間隔の初期値（秒）
+	deviceCodeDefaultInterval = 5
+	// slow_down 応答時にポーリング間隔へ加算する秒数 (RFC 8628 Section 3.5)
+	deviceCodeSlowDownIncrement = 5
+)
+
+// 承認・拒否を記録する時点でデバイス認可セッションが承認待ちでなくなっていたことを示すエラー
+var errDeviceSessionNotPending = errors.New("device session is no longer pending")
+
+// ユーザーコードに使用する文字セット
+// 入力ミスを避けるため、母音と紛らわしい文字を除いた子音のみを使用する (RFC 8628 Section 6.1)
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization はデバイスコードとユーザーコードを発行するハンドラ関数
+// RFC8628: https://datatracker.ietf.org/doc/html/rfc8628
+func DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeviceAuthorization")
+
+	if r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Invalid form data: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+	if !client.AllowsGrantType(deviceCodeGrantType) {
+		log.Printf("Device code grant not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+
+	resources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		log.Printf("Failed to generate user code: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	deviceCode, err := generateDeviceCode(userCode)
+	if err != nil {
+		log.Printf("Failed to generate device code: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	session := model.DeviceSession{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientID:   client.ClientID,
+		Scope:      strings.Join(strings.Fields(r.PostForm.Get("scope")), " "),
+		Resources:  resources,
+		Status:     model.DeviceAuthorizationPending,
+		Interval:   deviceCodeDefaultInterval,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(deviceCodeExpiresIn * time.Second),
+	}
+
+	if err := repos.Codes.SaveDeviceSession(r.Context(), session); err != nil {
+		log.Printf("Failed to save device session: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	verificationURIComplete, err := url.Parse(config.DeviceVerificationURI)
+	if err != nil {
+		log.Printf("Invalid device verification URI: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	query := verificationURIComplete.Query()
+	query.Set("user_code", userCode)
+	verificationURIComplete.RawQuery = query.Encode()
+
+	resp := model.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         config.DeviceVerificationURI,
+		VerificationURIComplete: verificationURIComplete.String(),
+		ExpiresIn:               deviceCodeExpiresIn,
+		Interval:                deviceCodeDefaultInterval,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeviceVerification はユーザーコードに紐づく認可要求を確認・承認するハンドラ関数
+// Auth Hub のログインセッションを利用し、GET で認可要求の内容を返し、POST で承認または拒否を記録します
+func DeviceVerification(w http.ResponseWriter, r *http.Request) {
+	log.Println("DeviceVerification")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 認証セッションの検証
+	authSession, ok := requireAuthSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.DeviceVerificationRequest
+	if r.Method == http.MethodGet {
+		req.UserCode = r.URL.Query().Get("user_code")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userCode, ok := normalizeUserCode(req.UserCode)
+	if !ok {
+		log.Printf("Invalid user code format: %s", req.UserCode)
+		http.Error(w, "Invalid user code", http.StatusBadRequest)
+		return
+	}
+
+	session, err := repos.Codes.GetDeviceSessionByUserCode(r.Context(), userCode)
+	if err != nil {
+		log.Printf("Device session not found: %v", err)
+		writeStoreError(w, err, http.StatusBadRequest, "Invalid user code")
+		return
+	}
+
+	if session.Status != model.DeviceAuthorizationPending || time.Now().After(session.ExpiresAt) {
+		log.Printf("Device session is no longer pending: status=%s", session.Status)
+		http.Error(w, "Invalid user code", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		// クライアントごとのセッションの有効期間を満たさない場合は再ログインを求める
+		if req.Approve && !requireClientSession(w, r, authSession, session.ClientID, deviceCodeGrantType) {
+			return
+		}
+		// 同じユーザーコードに対する承認・拒否が同時に行われても、最初の1件だけを記録する
+		session, err = repos.Codes.UpdateDeviceSessionByUserCode(r.Context(), userCode, func(session *model.DeviceSession) error {
+			if session.Status != model.DeviceAuthorizationPending || time.Now().After(session.ExpiresAt) {
+				return errDeviceSessionNotPending
+			}
+			if req.Approve {
+				session.Status = model.DeviceAuthorizationApproved
+				session.UserID = authSession.UserID
+				session.Email = authSession.Email
+				session.AuthenticationContext = authSession.AuthenticationContext
+			} else {
+				session.Status = model.DeviceAuthorizationDenied
+			}
+			return nil
+		})
+		if errors.Is(err, errDeviceSessionNotPending) {
+			log.Println("Device session is no longer pending")
+			http.Error(w, "Invalid user code", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to save device session: %v", err)
+			writeStoreError(w, err, http.StatusBadRequest, "Invalid user code")
+			return
+		}
+	}
+
+	resp := model.DeviceVerificationResponse{
+		ClientID: session.ClientID,
+		Scope:    session.Scope,
+		Status:   session.Status,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// デバイス認可グラントタイプの処理
+func handleDeviceCodeGrant(w http.ResponseWriter, r *http.Request) {
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+	if !client.AllowsGrantType(deviceCodeGrantType) {
+		log.Printf("Device code grant not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+	clientID := client.ClientID
+
+	// DPoP証明の検証 (RFC 9449)
+	dpopJKT, ok := bindDPoP(w, r, client)
+	if !ok {
+		return
+	}
+	// クライアント証明書による束縛 (RFC 8705)
+	certThumbprint, ok := bindCertificate(w, r, client)
+	if !ok {
+		return
+	}
+
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		log.Println("Missing device code")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing device code")
+		return
+	}
+
+	session, err := repos.Codes.GetDeviceSession(r.Context(), deviceCode)
+	if err != nil {
+		log.Printf("Invalid device code: %v", err)
+		writeGrantError(w, err, "Invalid device code")
+		return
+	}
+
+	if session.ClientID != clientID {
+		log.Printf("Client ID mismatch: expected=%s, got=%s", session.ClientID, clientID)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		log.Println("Device code has expired")
+		if err := repos.Codes.DeleteDeviceSession(r.Context(), *session); err != nil {
+			log.Printf("Warning: Failed to delete device session: %v", err)
+		}
+		writeOAuthError(w, http.StatusBadRequest, "expired_token", "Device code has expired")
+		return
+	}
+
+	// ポーリング間隔の確認
+	// 間隔より短いポーリングには slow_down を返し、以降の間隔を延長する
+	polled, err := repos.Codes.MarkDevicePolled(r.Context(), deviceCode, time.Duration(session.Interval)*time.Second)
+	if err != nil {
+		log.Printf("Failed to record device polling: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+	if !polled {
+		// 同時に記録された承認・拒否を上書きしないよう、ポーリング間隔のみを変更する
+		if _, err := repos.Codes.UpdateDeviceSession(r.Context(), deviceCode, func(session *model.DeviceSession) error {
+			session.Interval += deviceCodeSlowDownIncrement
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save device session: %v", err)
+			writeGrantError(w, err, "Invalid device code")
+			return
+		}
+		writeOAuthError(w, http.StatusBadRequest, "slow_down", "Polling too frequently")
+		return
+	}
+
+	switch session.Status {
+	case model.DeviceAuthorizationPending:
+		writeOAuthError(w, http.StatusBadRequest, "authorization_pending", "Authorization pending")
+		return
+	case model.DeviceAuthorizationDenied:
+		if err := repos.Codes.DeleteDeviceSession(r.Context(), *session); err != nil {
+			log.Printf("Warning: Failed to delete device session: %v", err)
+		}
+		writeOAuthError(w, http.StatusBadRequest, "access_denied", "Authorization denied by user")
+		return
+	case model.DeviceAuthorizationApproved:
+	default:
+		log.Printf("Unknown device session status: %s", session.Status)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// トークンリクエストで指定されたリソースの検証 (RFC 8707)
+	requestedResources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	resources, err := selectTokenResources(requestedResources, session.Resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	audience, accessTokenScope, err := resolveAccessTokenTarget(clientID, session.Scope, resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+
+	// デバイスコードは一度だけ使用できる
+	// 取得と同時に削除し、同時に送られた他のリクエストが先に使用した場合は invalid_grant を返す
+	session, err = repos.Codes.ConsumeDeviceSession(r.Context(), deviceCode)
+	if err != nil {
+		log.Printf("Failed to consume device session: %v", err)
+		writeGrantError(w, err, "Invalid device code")
+		return
+	}
+	if session.Status != model.DeviceAuthorizationApproved || session.ClientID != clientID {
+		log.Printf("Device session changed before consumption: status=%s", session.Status)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid device code")
+		return
+	}
+
+	subject, err := subjectIdentifier(r.Context(), client, session.UserID)
+	if err != nil {
+		log.Printf("Failed to resolve subject: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	user, err := repos.Users.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		writeGrantError(w, err, "User not found")
+		return
+	}
+
+	// クライアントに公開するグループとロール
+	groups, roles := releasedGroupsAndRoles(client, user)
+
+	// クライアントごとのクレームマッピングを適用する
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, user, session.AuthenticationContext, accessTokenScope, nil)
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	lifetimes := config.Lifetimes(client, deviceCodeGrantType)
+	now := time.Now()
+
+	accessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:      subject,
+		ClientID:     clientID,
+		Audience:     audience,
+		Scope:        accessTokenScope,
+		IssuedAt:     now,
+		ExpiresIn:    lifetimes.AccessTokenTTL,
+		Confirmation: tokenConfirmation(dpopJKT, certThumbprint),
+		Groups:       groups,
+		Roles:        roles,
+		Claims:       accessTokenClaims,
+	})
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// openid スコープが要求された場合のみIDトークンを発行する
+	var idToken string
+	if slices.Contains(strings.Fields(session.Scope), "openid") {
+		idTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetIDToken, user, session.AuthenticationContext, session.Scope, scopedUserClaims(user, session.Scope))
+		if err != nil {
+			log.Printf("Failed to apply claims mapping: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		idToken, err = utils.GenerateIDToken(utils.IDTokenParams{
+			Subject:     subject,
+			ClientID:    clientID,
+			IssuedAt:    now,
+			ExpiresIn:   lifetimes.IDTokenTTL,
+			AuthTime:    session.AuthTime,
+			AMR:         session.AMR,
+			ACR:         session.ACR,
+			AccessToken: accessToken,
+			Claims:      idTokenClaims,
+		})
+		if err != nil {
+			log.Printf("Failed to generate ID token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		log.Printf("Failed to generate refresh token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt, absoluteExpiresAt := lifetimes.RefreshTokenExpiry(now, time.Time{})
+	tokenSession := model.TokenSession{
+		UserID:                session.UserID,
+		ClientID:              clientID,
+		Scope:                 session.Scope,
+		Resources:             session.Resources,
+		DPoPJKT:               dpopJKT,
+		CertificateThumbprint: certThumbprint,
+		CreatedAt:             now,
+		ExpiresAt:             expiresAt,
+		AbsoluteExpiresAt:     absoluteExpiresAt,
+		IsRevoked:             false,
+		AuthenticationContext: session.AuthenticationContext,
+	}
+
+	if err := repos.Tokens.SaveTokenSession(r.Context(), refreshToken, tokenSession); err != nil {
+		log.Printf("Failed to save token session: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	sendTokenResponse(w, idToken, accessToken, refreshToken, accessTokenScope, tokenTypeFor(dpopJKT), lifetimes.AccessTokenTTL)
+}
+
+// デバイスコードを生成するヘルパー関数
+// 保存先でユーザーコードの索引と同じ場所に配置できるよう、先頭にユーザーコードから求めたタグを付ける (64文字)
+func generateDeviceCode(userCode string) (string, error) {
+	tag := store.DeviceCodeTag(userCode)
+	bytes := make([]byte, (64-len(tag))/2)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return tag + hex.EncodeToString(bytes), nil
+}
+
+// ユーザーコードを生成するヘルパー関数
+// 入力しやすいように XXXX-XXXX 形式で返す
+func generateUserCode() (string, error) {
+	code := make([]byte, 8)
+	charsetSize := big.NewInt(int64(len(userCodeCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, charsetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code[:4]) + "-" + string(code[4:]), nil
+}
+
+// normalizeUserCode ユーザーが入力したユーザーコードを正規化します
+// 大文字小文字・区切り文字・空白の違いを吸収し、XXXX-XXXX 形式に揃えます
+func normalizeUserCode(input string) (string, bool) {
+	var code []byte
+	for _, c := range strings.ToUpper(input) {
+		if c == '-' || c == ' ' {
+			continue
+		}
+		if !strings.ContainsRune(userCodeCharset, c) {
+			return "", false
+		}
+		code = append(code, byte(c))
+	}
+	if len(code) != 8 {
+		return "", false
+	}
+	return string(code[:4]) + "-" + string(code[4:]), true
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupDeviceTest デバイス認可グラントを使用するクライアントを登録し、承認に使用するユーザーを返します
+func setupDeviceTest(t *testing.T) *model.User {
+	t.Helper()
+	s := useMemoryStore(t)
+	previous := config.DeviceVerificationURI
+	config.DeviceVerificationURI = "https://auth.example.com/device"
+	t.Cleanup(func() { config.DeviceVerificationURI = previous })
+
+	ctx := context.Background()
+	if err := utils.InitJWKS(ctx, s); err != nil {
+		t.Fatalf("InitJWKS() error = %v", err)
+	}
+	saveTestClient(t, model.Client{
+		ClientID:                "device-client",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{deviceCodeGrantType},
+	})
+	user, err := s.GetOrCreateUser(ctx, "user-1@example.com")
+	if err != nil {
+		t.Fatalf("GetOrCreateUser() error = %v", err)
+	}
+	return user
+}
+
+// startDeviceAuthorization デバイス認可リクエストを送信し、発行されたデバイスコードとユーザーコードを返します
+func startDeviceAuthorization(t *testing.T) model.DeviceAuthorizationResponse {
+	t.Helper()
+	form := url.Values{"client_id": {"device-client"}, "scope": {"openid"}}
+	r := httptest.NewRequest(http.MethodPost, "/api/oauth/device_authorization", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := serveTest(DeviceAuthorization, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("DeviceAuthorization() = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	var resp model.DeviceAuthorizationResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return resp
+}
+
+// pollDeviceToken デバイスコードでトークンエンドポイントにポーリングし、ステータスコードと error の値を返します
+func pollDeviceToken(t *testing.T, deviceCode string) (int, string) {
+	t.Helper()
+	form := url.Values{"grant_type": {deviceCodeGrantType}, "client_id": {"device-client"}, "device_code": {deviceCode}}
+	r := httptest.NewRequest(http.MethodPost, "/api/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := serveTest(Token, r)
+	var resp struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	return w.Code, resp.Error
+}
+
+// 承認前のポーリングには authorization_pending を返し、間隔より短いポーリングには slow_down を返して間隔を延長する
+func TestDeviceCodePolling(t *testing.T) {
+	setupDeviceTest(t)
+	device := startDeviceAuthorization(t)
+
+	if code, errorCode := pollDeviceToken(t, device.DeviceCode); code != http.StatusBadRequest || errorCode != "authorization_pending" {
+		t.Fatalf("first poll = %d %q, want authorization_pending", code, errorCode)
+	}
+	if code, errorCode := pollDeviceToken(t, device.DeviceCode); code != http.StatusBadRequest || errorCode != "slow_down" {
+		t.Fatalf("second poll = %d %q, want slow_down", code, errorCode)
+	}
+
+	session, err := repos.Codes.GetDeviceSession(context.Background(), device.DeviceCode)
+	if err != nil {
+		t.Fatalf("GetDeviceSession() error = %v", err)
+	}
+	if want := deviceCodeDefaultInterval + deviceCodeSlowDownIncrement; session.Interval != want {
+		t.Errorf("Interval = %d, want %d", session.Interval, want)
+	}
+	if session.Status != model.DeviceAuthorizationPending {
+		t.Errorf("Status = %s, want %s", session.Status, model.DeviceAuthorizationPending)
+	}
+}
+
+// 承認されたデバイスコードでトークンを発行できるのは1回だけ
+func TestDeviceCodeConsumed(t *testing.T) {
+	user := setupDeviceTest(t)
+	device := startDeviceAuthorization(t)
+
+	if _, err := repos.Codes.UpdateDeviceSessionByUserCode(context.Background(), device.UserCode, func(session *model.DeviceSession) error {
+		session.Status = model.DeviceAuthorizationApproved
+		session.UserID = user.ID
+		session.Email = user.Email
+		session.AuthenticationContext = model.NewAuthenticationContext(time.Now(), model.AMRPassword)
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateDeviceSessionByUserCode() error = %v", err)
+	}
+
+	if code, errorCode := pollDeviceToken(t, device.DeviceCode); code != http.StatusOK {
+		t.Fatalf("poll after approval = %d %q, want %d", code, errorCode, http.StatusOK)
+	}
+	if code, errorCode := pollDeviceToken(t, device.DeviceCode); code != http.StatusBadRequest || errorCode != "invalid_grant" {
+		t.Errorf("poll with a used device code = %d %q, want invalid_grant", code, errorCode)
+	}
+	if _, err := repos.Codes.GetDeviceSessionByUserCode(context.Background(), device.UserCode); err == nil {
+		t.Error("GetDeviceSessionByUserCode() found the consumed device session")
+	}
+}
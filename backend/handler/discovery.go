@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// OpenIDConfiguration は OpenID Provider のメタデータを返すハンドラ関数
+// OpenID Connect Discovery 1.0: https://openid.net/specs/openid-connect-discovery-1_0.html
+func OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	if err := json.NewEncoder(w).Encode(providerMetadata()); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// providerMetadata 現在の設定からメタデータを組み立てます
+func providerMetadata() model.ProviderMetadata {
+	// OpenID Connect のスコープと、登録済みリソースのスコープ
+	scopes := []string{"openid", "profile", "email", "phone", "address"}
+	for _, resource := range config.Resources {
+		for _, scope := range resource.Scopes {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	claims := []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "acr", "amr", "at_hash", "c_hash"}
+	for _, scope := range []string{"profile", "email", "phone", "address"} {
+		claims = append(claims, scopeClaims[scope]...)
+	}
+
+	return model.ProviderMetadata{
+		Issuer:                                    utils.Issuer,
+		AuthorizationEndpoint:                     config.AuthorizationEndpoint,
+		TokenEndpoint:                             config.APIBaseURL + "/api/oauth/token",
+		UserInfoEndpoint:                          config.APIBaseURL + "/api/oauth/userinfo",
+		JWKSURI:                                   config.APIBaseURL + "/.well-known/jwks.json",
+		RevocationEndpoint:                        config.APIBaseURL + "/api/oauth/revoke",
+		IntrospectionEndpoint:                     config.APIBaseURL + "/api/oauth/introspect",
+		PushedAuthorizationRequestEndpoint:        config.APIBaseURL + "/api/oauth/par",
+		DeviceAuthorizationEndpoint:               config.APIBaseURL + "/api/oauth/device_authorization",
+		ScopesSupported:                           scopes,
+		ResponseTypesSupported:                    []string{"code"},
+		GrantTypesSupported:                       []string{"authorization_code", "refresh_token", "client_credentials", deviceCodeGrantType, tokenExchangeGrantType},
+		SubjectTypesSupported:                     []string{"public", "pairwise"},
+		IDTokenSigningAlgValuesSupported:          []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:         []string{"none", "client_secret_basic", "client_secret_post", "tls_client_auth", "self_signed_tls_client_auth"},
+		CodeChallengeMethodsSupported:             []string{pkceMethodS256, pkceMethodPlain},
+		ClaimsSupported:                           claims,
+		ClaimTypesSupported:                       []string{"normal"},
+		ClaimsParameterSupported:                  true,
+		ACRValuesSupported:                        []string{model.ACRSingleFactor, model.ACRMultiFactor},
+		RequestParameterSupported:                 true,
+		RequestURIParameterSupported:              true,
+		RequestObjectSigningAlgValuesSupported:    utils.RequestObjectSigningAlgorithms,
+		RequestObjectEncryptionAlgValuesSupported: []string{"RSA-OAEP-256"},
+		DPoPSigningAlgValuesSupported:             utils.DPoPSigningAlgorithms,
+		TLSClientCertificateBoundAccessTokens:     true,
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	// errInvalidDPoPProof DPoP証明が不正な場合のエラー (RFC 9449 invalid_dpop_proof)
+	errInvalidDPoPProof = errors.New("invalid_dpop_proof")
+	// errUseDPoPNonce サーバー発行の nonce が必要な場合のエラー (RFC 9449 use_dpop_nonce)
+	errUseDPoPNonce = errors.New("use_dpop_nonce")
+)
+
+// validateDPoPProof リクエストの DPoP ヘッダーを検証します
+// DPoP ヘッダーがない場合は nil を返します
+// accessToken が空でない場合は、証明がそのアクセストークンに対して作成されたことも検証します
+func validateDPoPProof(r *http.Request, accessToken string, nonceRequired bool) (*utils.DPoPProof, error) {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) == 0 {
+		return nil, nil
+	}
+	if len(proofs) > 1 {
+		return nil, fmt.Errorf("%w: multiple DPoP headers", errInvalidDPoPProof)
+	}
+
+	proof, err := utils.VerifyDPoPProof(proofs[0], r.Method, requestURL(r), accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidDPoPProof, err)
+	}
+
+	if proof.Nonce != "" {
+		if !utils.VerifyDPoPNonce(config.JWTSecret, proof.Nonce) {
+			return nil, fmt.Errorf("%w: invalid or expired nonce", errUseDPoPNonce)
+		}
+	} else if nonceRequired {
+		return nil, fmt.Errorf("%w: nonce required", errUseDPoPNonce)
+	}
+
+	// 同じ証明の再利用 (リプレイ) を防ぐ
+	// iat の未来方向の許容幅も含めて、証明が受け入れられる間は jti を保持する
+	fresh, err := repos.Tokens.MarkDPoPProofUsed(r.Context(), proof.JKT, proof.JTI, utils.DPoPProofMaxAge+time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: proof has already been used", errInvalidDPoPProof)
+	}
+
+	return proof, nil
+}
+
+// bindDPoP トークンエンドポイントでDPoP証明を検証し、トークンを束縛する鍵の Thumbprint を返します
+// DPoP証明がなくクライアントもDPoPを必須としていない場合は空文字を返します
+// 検証に失敗した場合はエラーレスポンスを書き込み、false を返します
+func bindDPoP(w http.ResponseWriter, r *http.Request, client *model.Client) (string, bool) {
+	proof, err := validateDPoPProof(r, "", client.DPoPNonceRequired)
+	if err != nil {
+		log.Printf("Invalid DPoP proof: %v", err)
+		writeDPoPTokenError(w, err)
+		return "", false
+	}
+
+	if proof == nil {
+		if client.DPoPBoundAccessTokens {
+			log.Printf("DPoP proof required for client: %s", client.ClientID)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "DPoP proof required")
+			return "", false
+		}
+		return "", true
+	}
+
+	// 次回の証明で使用できる nonce を提供する
+	w.Header().Set("DPoP-Nonce", utils.GenerateDPoPNonce(config.JWTSecret))
+	return proof.JKT, true
+}
+
+// writeDPoPTokenError トークンエンドポイントでのDPoP検証エラーを返します
+func writeDPoPTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUseDPoPNonce) {
+		w.Header().Set("DPoP-Nonce", utils.GenerateDPoPNonce(config.JWTSecret))
+		writeOAuthError(w, http.StatusBadRequest, "use_dpop_nonce", "Authorization server requires nonce in DPoP proof")
+		return
+	}
+	if errors.Is(err, errInvalidDPoPProof) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_dpop_proof", "Invalid DPoP proof")
+		return
+	}
+	// 使用済みの証明の記録 (保存先) に失敗した場合
+	writeOAuthStoreError(w, err)
+}
+
+// tokenTypeFor アクセストークンの束縛状態に応じたトークンタイプを返します
+func tokenTypeFor(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// requestURL DPoP証明の htu と照合する、リクエストの外部から見たURLを返します
+// Host や X-Forwarded-Proto はクライアントが任意に指定できるため使用せず、設定したこのサーバーのURL (API_BASE_URL) から組み立てます
+func requestURL(r *http.Request) string {
+	return config.APIBaseURL + r.URL.Path
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"backend/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestURL(t *testing.T) {
+	previous := config.APIBaseURL
+	config.APIBaseURL = "https://auth.example.com"
+	t.Cleanup(func() { config.APIBaseURL = previous })
+
+	tests := []struct {
+		name    string
+		target  string
+		host    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "path", target: "/api/oauth/token", want: "https://auth.example.com/api/oauth/token"},
+		{name: "query is ignored", target: "/api/oauth/userinfo?x=1", want: "https://auth.example.com/api/oauth/userinfo"},
+		{name: "host header is ignored", target: "/api/oauth/token", host: "evil.example.com", want: "https://auth.example.com/api/oauth/token"},
+		{name: "forwarded proto is ignored", target: "/api/oauth/token", headers: map[string]string{"X-Forwarded-Proto": "http"}, want: "https://auth.example.com/api/oauth/token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := requestURL(r); got != tt.want {
+				t.Errorf("requestURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
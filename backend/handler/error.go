@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"backend/model"
+	"backend/store"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// writeOAuthError OAuth 2.0 形式のエラーレスポンスを返します
+func writeOAuthError(w http.ResponseWriter, status int, errorCode string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	resp := model.ErrorResponse{
+		Error:            errorCode,
+		ErrorDescription: description,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
+
+// isStoreUnavailable 保存先の障害・タイムアウトによるエラーかを返します
+// リクエストの内容に問題がないため、クライアントは時間をおいて再試行できます
+func isStoreUnavailable(err error) bool {
+	return errors.Is(err, store.ErrUnavailable) || errors.Is(err, store.ErrTimeout)
+}
+
+// writeStoreError 保存先の操作のエラーをレスポンスに変換します
+// 保存先の障害・タイムアウトの場合は 503、一意な値の重複の場合は 409 を返し、
+// それ以外 (見つからないなど) は status と message を返します
+func writeStoreError(w http.ResponseWriter, err error, status int, message string) {
+	switch {
+	case isStoreUnavailable(err):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "Conflict", http.StatusConflict)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// writeTemporarilyUnavailable 保存先の障害・タイムアウトを OAuth 2.0 形式のエラーで返します
+// temporarily_unavailable は RFC 6749 Section 4.1.2.1 のエラーコードで、トークンエンドポイントなどでも同じ意味で使用します
+func writeTemporarilyUnavailable(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "The authorization server is temporarily unavailable")
+}
+
+// writeOAuthStoreError OAuth 2.0 のエンドポイントで保存先の操作に失敗した場合のエラーを返します
+// 保存先の障害・タイムアウトの場合は temporarily_unavailable、それ以外は server_error を返します
+func writeOAuthStoreError(w http.ResponseWriter, err error) {
+	if isStoreUnavailable(err) {
+		writeTemporarilyUnavailable(w)
+		return
+	}
+	writeOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+}
+
+// writeGrantError 認可グラント (認可コード・リフレッシュトークン・デバイスコード) を取得できなかった場合のエラーを返します
+// 見つからない・期限切れの場合はクライアントの誤りとして invalid_grant を返します
+func writeGrantError(w http.ResponseWriter, err error, description string) {
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", description)
+		return
+	}
+	writeOAuthStoreError(w, err)
+}
@@ -0,0 +1,12 @@
+package handler
+
+import "backend/store"
+
+// repos ハンドラーが使用するリポジトリ
+var repos *store.Repositories
+
+// Init ハンドラーが使用するリポジトリを設定します
+// サーバーの起動時に、リクエストを受け付ける前に呼び出します
+func Init(repositories *store.Repositories) {
+	repos = repositories
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useMemoryStore テストの間だけハンドラーのリポジトリをメモリの実装に置き換えます
+// 有効期間はサーバーの組み込みの既定値を使用します
+func useMemoryStore(t *testing.T) *store.MemoryStore {
+	t.Helper()
+	previousRepos, previousLifetimes := repos, config.DefaultLifetimes
+	if err := config.LoadLifetimes(); err != nil {
+		t.Fatalf("LoadLifetimes() error = %v", err)
+	}
+	s := store.NewMemoryStore()
+	Init(&store.Repositories{Users: s, Clients: s, Sessions: s, Codes: s, Tokens: s, Keys: s})
+	t.Cleanup(func() {
+		repos, config.DefaultLifetimes = previousRepos, previousLifetimes
+	})
+	return s
+}
+
+// saveTestClient クライアントを登録します
+func saveTestClient(t *testing.T, client model.Client) {
+	t.Helper()
+	if err := repos.Clients.SaveClient(context.Background(), client); err != nil {
+		t.Fatalf("SaveClient() error = %v", err)
+	}
+}
+
+// saveTestAuthSession createdAt にログインした認証セッションを保存し、セッションIDを返します
+func saveTestAuthSession(t *testing.T, createdAt time.Time) string {
+	t.Helper()
+	sessionID, err := generateSessionID()
+	if err != nil {
+		t.Fatalf("generateSessionID() error = %v", err)
+	}
+	session := model.AuthSession{
+		SessionID:    sessionID,
+		UserID:       "user-1",
+		Email:        "user-1@example.com",
+		CreatedAt:    createdAt,
+		LastActiveAt: createdAt,
+		ExpiresAt:    time.Now().Add(time.Hour),
+		IsLoggedIn:   true,
+	}
+	if err := repos.Sessions.SaveAuthSession(context.Background(), sessionID, session); err != nil {
+		t.Fatalf("SaveAuthSession() error = %v", err)
+	}
+	return sessionID
+}
+
+// serveTest ハンドラーにリクエストを渡し、レスポンスを返します
+func serveTest(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
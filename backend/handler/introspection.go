@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"backend/authz"
+	"backend/model"
+	"backend/store"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Introspect はトークンの有効性と属性を返すハンドラ関数
+// リソースサーバーとして動作する機密クライアントのみが利用できます
+// RFC7662: https://datatracker.ietf.org/doc/html/rfc7662
+func Introspect(w http.ResponseWriter, r *http.Request) {
+	log.Println("Introspect")
+
+	if r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Invalid form data: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	client, err := authenticateClient(r)
+	if err != nil || !client.IsConfidential() {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		log.Println("Missing token")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing token")
+		return
+	}
+
+	resp := introspectAccessToken(token)
+	if !resp.Active {
+		resp, err = introspectRefreshToken(r.Context(), token, client.ClientID)
+		if err != nil {
+			// 保存先の障害の場合はトークンが無効とは判断できないため、active: false ではなくエラーを返す
+			log.Printf("Failed to introspect refresh token: %v", err)
+			writeOAuthStoreError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// introspectAccessToken アクセストークンを検証してイントロスペクションの結果を返します
+// DPoPで束縛されたトークンは token_type を DPoP とし、cnf クレームを返します (RFC 9449 Section 6.2)
+// イントロスペクションは cnf をそのまま返すだけで束縛を確認しません。リソースサーバーは、提示されたDPoP証明の鍵
+// (RFC 9449 Section 7) やクライアント証明書 (RFC 8705 Section 3) が cnf と一致することを自身で確認してください
+func introspectAccessToken(token string) model.IntrospectionResponse {
+	claims, err := utils.VerifyAccessToken(token)
+	if err != nil {
+		return model.IntrospectionResponse{Active: false}
+	}
+
+	resp := model.IntrospectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		Aud:       claims["aud"],
+	}
+	resp.Sub, _ = claims.GetSubject()
+	resp.Iss, _ = claims.GetIssuer()
+	resp.Scope, _ = claims["scope"].(string)
+	resp.ClientID, _ = claims["client_id"].(string)
+	resp.Act, _ = claims["act"].(map[string]interface{})
+	principal := authz.NewPrincipal(claims)
+	resp.Groups = principal.Groups
+	resp.Roles = principal.Roles
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		resp.Exp = exp.Unix()
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		resp.Iat = iat.Unix()
+	}
+	if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+		resp.Cnf = cnf
+		if confirmationValue(claims, "jkt") != "" {
+			resp.TokenType = "DPoP"
+		}
+	}
+	return resp
+}
+
+// introspectRefreshToken リフレッシュトークンのイントロスペクションの結果を返します
+// リフレッシュトークンは発行先のクライアント以外には有効と返しません
+// 見つからない・期限切れのトークンは無効として返し、保存先の障害の場合のみエラーを返します
+func introspectRefreshToken(ctx context.Context, token string, clientID string) (model.IntrospectionResponse, error) {
+	if utils.CheckRefreshToken(token) != nil {
+		return model.IntrospectionResponse{Active: false}, nil
+	}
+	session, err := repos.Tokens.GetTokenSession(ctx, token)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrExpired) {
+		return model.IntrospectionResponse{Active: false}, nil
+	}
+	if err != nil {
+		return model.IntrospectionResponse{}, err
+	}
+	if session.IsRevoked || session.ClientID != clientID {
+		return model.IntrospectionResponse{Active: false}, nil
+	}
+
+	resp := model.IntrospectionResponse{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID,
+		TokenType: "refresh_token",
+		Iss:       utils.Issuer,
+		Iat:       session.CreatedAt.Unix(),
+	}
+	if !session.ExpiresAt.IsZero() {
+		resp.Exp = session.ExpiresAt.Unix()
+	}
+	// sub は発行先クライアント向けの値 (ペアワイズ識別子の場合あり) を返す
+	client, err := repos.Clients.GetClient(ctx, session.ClientID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return model.IntrospectionResponse{}, err
+	}
+	if client != nil {
+		sub, err := subjectIdentifier(ctx, client, session.UserID)
+		if isStoreUnavailable(err) {
+			return model.IntrospectionResponse{}, err
+		}
+		if err != nil {
+			log.Printf("Failed to resolve subject: %v", err)
+			return model.IntrospectionResponse{Active: false}, nil
+		}
+		resp.Sub = sub
+	}
+	if session.DPoPJKT != "" {
+		resp.Cnf = map[string]interface{}{"jkt": session.DPoPJKT}
+	}
+	return resp, nil
+}
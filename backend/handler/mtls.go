@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/utils"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// clientCertificateChain リクエストのクライアント証明書チェーンを取得します
+// TLS接続の証明書を優先し、ない場合は信頼できるプロキシのヘッダー (MTLS_CLIENT_CERT_HEADER) から取得します
+// 証明書が提示されていない場合は nil を返します
+func clientCertificateChain(r *http.Request) ([]*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates, nil
+	}
+	if config.MTLSClientCertHeader == "" {
+		return nil, nil
+	}
+	value := r.Header.Get(config.MTLSClientCertHeader)
+	if value == "" {
+		return nil, nil
+	}
+	// プロキシを経由せずに直接送られたヘッダーは取り除き、証明書が提示されていないものとして扱う
+	if !fromTrustedProxy(r) {
+		log.Printf("Ignoring %s header from untrusted address: %s", config.MTLSClientCertHeader, r.RemoteAddr)
+		r.Header.Del(config.MTLSClientCertHeader)
+		return nil, nil
+	}
+	return utils.ParseClientCertificateHeader(value)
+}
+
+// fromTrustedProxy リクエストの接続元が MTLS_TRUSTED_PROXY_CIDRS のアドレス範囲に含まれるかを返します
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return slices.ContainsFunc(config.MTLSTrustedProxies, func(network *net.IPNet) bool {
+		return network.Contains(ip)
+	})
+}
+
+// authenticateTLSClient クライアント証明書によるクライアント認証を行います (RFC 8705 Section 2)
+func authenticateTLSClient(r *http.Request, client *model.Client) error {
+	chain, err := clientCertificateChain(r)
+	if err != nil {
+		return fmt.Errorf("%w: malformed client certificate: %v", errInvalidClient, err)
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: client certificate required for %s", errInvalidClient, client.ClientID)
+	}
+	cert := chain[0]
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: client certificate is not valid at this time", errInvalidClient)
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case "tls_client_auth":
+		// PKIによる認証: 信頼するCAの発行した証明書で、登録済みの識別情報と一致すること
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range chain[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:         config.MTLSTrustedCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return fmt.Errorf("%w: untrusted client certificate: %v", errInvalidClient, err)
+		}
+		if !matchesTLSClientAuth(client, cert) {
+			return fmt.Errorf("%w: client certificate does not match registered identity for %s", errInvalidClient, client.ClientID)
+		}
+	case "self_signed_tls_client_auth":
+		// 自己署名証明書による認証: 証明書の公開鍵がクライアントの登録済み公開鍵と一致すること
+		keys, err := clientKeySet(r.Context(), client)
+		if err != nil {
+			return fmt.Errorf("%w: failed to load client keys: %v", errInvalidClient, err)
+		}
+		if !utils.CertificateKeyRegistered(keys, cert) {
+			return fmt.Errorf("%w: client certificate is not registered for %s", errInvalidClient, client.ClientID)
+		}
+	default:
+		return fmt.Errorf("%w: client %s does not use certificate authentication", errInvalidClient, client.ClientID)
+	}
+	return nil
+}
+
+// matchesTLSClientAuth 証明書がクライアントに登録された識別情報と一致するかを返します (RFC 8705 Section 2.1.2)
+func matchesTLSClientAuth(client *model.Client, cert *x509.Certificate) bool {
+	switch {
+	case client.TLSClientAuthSubjectDN != "":
+		return cert.Subject.String() == client.TLSClientAuthSubjectDN
+	case client.TLSClientAuthSANDNS != "":
+		return slices.Contains(cert.DNSNames, client.TLSClientAuthSANDNS)
+	case client.TLSClientAuthSANURI != "":
+		return slices.ContainsFunc(cert.URIs, func(u *url.URL) bool { return u.String() == client.TLSClientAuthSANURI })
+	case client.TLSClientAuthSANIP != "":
+		ip := net.ParseIP(client.TLSClientAuthSANIP)
+		return ip != nil && slices.ContainsFunc(cert.IPAddresses, ip.Equal)
+	case client.TLSClientAuthSANEmail != "":
+		return slices.Contains(cert.EmailAddresses, client.TLSClientAuthSANEmail)
+	default:
+		return false
+	}
+}
+
+// bindCertificate トークンをクライアント証明書で束縛する場合に、証明書の Thumbprint を返します (RFC 8705 Section 3)
+// クライアントが証明書による束縛を設定していない場合は空文字を返します
+// 証明書が提示されていない場合はエラーレスポンスを書き込み、false を返します
+func bindCertificate(w http.ResponseWriter, r *http.Request, client *model.Client) (string, bool) {
+	if !client.TLSClientCertificateBoundAccessTokens {
+		return "", true
+	}
+
+	chain, err := clientCertificateChain(r)
+	if err != nil || len(chain) == 0 {
+		log.Printf("Client certificate required for client: %s, err=%v", client.ClientID, err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Client certificate required")
+		return "", false
+	}
+	return utils.CertificateThumbprint(chain[0]), true
+}
+
+// tokenConfirmation アクセストークンを束縛する場合の cnf クレームを返します
+// DPoP (jkt) とクライアント証明書 (x5t#S256) のいずれか、または両方を含みます
+func tokenConfirmation(jkt string, certThumbprint string) map[string]string {
+	if jkt == "" && certThumbprint == "" {
+		return nil
+	}
+	cnf := map[string]string{}
+	if jkt != "" {
+		cnf["jkt"] = jkt
+	}
+	if certThumbprint != "" {
+		cnf["x5t#S256"] = certThumbprint
+	}
+	return cnf
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"backend/model"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// request_uri の接頭辞 (RFC 9126 Section 2.2)
+const requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PARで保存した認可リクエストの有効期限（60秒）
+const pushedAuthorizationRequestExpiresIn = 60
+
+// PushedAuthorizationRequest は認可リクエストを事前に受け付けて request_uri を発行するハンドラ関数
+// RFC9126: https://datatracker.ietf.org/doc/html/rfc9126
+func PushedAuthorizationRequest(w http.ResponseWriter, r *http.Request) {
+	log.Println("PushedAuthorizationRequest")
+
+	if r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Invalid form data: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form data")
+		return
+	}
+
+	// request_uri 自体をPARで送ることはできない (RFC 9126 Section 2.1)
+	if r.PostForm.Get("request_uri") != "" {
+		log.Println("request_uri is not allowed in pushed authorization request")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request_uri is not allowed")
+		return
+	}
+
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+
+	// Basic認証の場合はボディの client_id を省略できるため、認証済みのクライアントIDで補う
+	if r.PostForm.Get("client_id") == "" {
+		r.PostForm.Set("client_id", client.ClientID)
+	}
+
+	// クエリパラメータは使用せず、認証済みのリクエストボディのみを検証する
+	// request パラメータでリクエストオブジェクトを送ることもできる (RFC 9126 Section 3)
+	authRequest, err := resolveAuthorizationRequest(r.Context(), r.PostForm, true)
+	if err != nil {
+		var reqErr *authorizationRequestError
+		if errors.As(err, &reqErr) {
+			writeOAuthError(w, reqErr.status(), reqErr.Code, reqErr.Description)
+			return
+		}
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid request")
+		return
+	}
+	if authRequest.ClientID != client.ClientID {
+		log.Printf("Client ID mismatch: authenticated=%s, requested=%s", client.ClientID, authRequest.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid client ID")
+		return
+	}
+
+	requestID, err := generateRequestID()
+	if err != nil {
+		log.Printf("Failed to generate request URI: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	requestURI := requestURIPrefix + requestID
+
+	if err := repos.Codes.SavePushedAuthorizationRequest(r.Context(), requestURI, *authRequest, pushedAuthorizationRequestExpiresIn*time.Second); err != nil {
+		log.Printf("Failed to save pushed authorization request: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	resp := model.PushedAuthorizationResponse{
+		RequestURI: requestURI,
+		ExpiresIn:  pushedAuthorizationRequestExpiresIn,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		return
+	}
+}
+
+// resolvePushedAuthorizationRequest 認可エンドポイントで指定された request_uri から認可リクエストを取得します
+func resolvePushedAuthorizationRequest(ctx context.Context, clientID string, requestURI string) (*model.AuthorizationRequest, error) {
+	if !strings.HasPrefix(requestURI, requestURIPrefix) {
+		return nil, fmt.Errorf("unsupported request_uri: %s", requestURI)
+	}
+	if clientID == "" {
+		return nil, errors.New("missing client_id")
+	}
+
+	authRequest, err := repos.Codes.ConsumePushedAuthorizationRequest(ctx, requestURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// request_uri は発行先のクライアントのみが使用できる
+	if authRequest.ClientID != clientID {
+		return nil, fmt.Errorf("client ID mismatch: expected=%s, got=%s", authRequest.ClientID, clientID)
+	}
+	return authRequest, nil
+}
+
+// request_uri の識別子を生成するヘルパー関数
+func generateRequestID() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"backend/model"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRedirectURI = "https://client.example.com/callback"
+
+// PARで受け付けた request_uri は1回の認可リクエストでのみ使用できる
+func TestPushedAuthorizationRequestSingleUse(t *testing.T) {
+	useMemoryStore(t)
+	saveTestClient(t, model.Client{
+		ClientID:                "client-1",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code"},
+		RedirectURIs:            []string{testRedirectURI},
+	})
+
+	w := pushTestAuthorizationRequest(testRedirectURI)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("PushedAuthorizationRequest() = %d %s, want %d", w.Code, w.Body, http.StatusCreated)
+	}
+	var pushed model.PushedAuthorizationResponse
+	if err := json.NewDecoder(w.Body).Decode(&pushed); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+
+	sessionID := saveTestAuthSession(t, time.Now())
+	authorize := func() int {
+		query := url.Values{"client_id": {"client-1"}, "request_uri": {pushed.RequestURI}}
+		r := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+query.Encode(), nil)
+		r.Header.Set("X-Auth-Session", sessionID)
+		return serveTest(Authorize, r).Code
+	}
+	if got := authorize(); got != http.StatusOK {
+		t.Fatalf("Authorize() = %d, want %d", got, http.StatusOK)
+	}
+	if got := authorize(); got != http.StatusBadRequest {
+		t.Errorf("Authorize() with a used request_uri = %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+// 登録済みのリダイレクトURIと完全一致しない redirect_uri は、PARでもクエリパラメータでも受け付けない
+func TestAuthorizationRequestRedirectURI(t *testing.T) {
+	useMemoryStore(t)
+	saveTestClient(t, model.Client{
+		ClientID:                "client-1",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code"},
+		RedirectURIs:            []string{testRedirectURI},
+	})
+	sessionID := saveTestAuthSession(t, time.Now())
+
+	tests := []struct {
+		name        string
+		redirectURI string
+		want        int
+	}{
+		{name: "registered", redirectURI: testRedirectURI, want: http.StatusOK},
+		{name: "query added", redirectURI: testRedirectURI + "?next=/", want: http.StatusBadRequest},
+		{name: "path prefix", redirectURI: testRedirectURI + "/evil", want: http.StatusBadRequest},
+		{name: "other host", redirectURI: "https://attacker.example.com/callback", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pushedWant := tt.want
+			if pushedWant == http.StatusOK {
+				pushedWant = http.StatusCreated
+			}
+			if got := pushTestAuthorizationRequest(tt.redirectURI).Code; got != pushedWant {
+				t.Errorf("PushedAuthorizationRequest() = %d, want %d", got, pushedWant)
+			}
+
+			query := testAuthorizationParams(tt.redirectURI)
+			r := httptest.NewRequest(http.MethodGet, "/api/oauth/authorize?"+query.Encode(), nil)
+			r.Header.Set("X-Auth-Session", sessionID)
+			if got := serveTest(Authorize, r).Code; got != tt.want {
+				t.Errorf("Authorize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// pushTestAuthorizationRequest client-1 の認可リクエストをPARエンドポイントに送信します
+func pushTestAuthorizationRequest(redirectURI string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/oauth/par", strings.NewReader(testAuthorizationParams(redirectURI).Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serveTest(PushedAuthorizationRequest, r)
+}
+
+// testAuthorizationParams client-1 の認可リクエストのパラメータを返します
+func testAuthorizationParams(redirectURI string) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"client-1"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"backend/model"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// PKCEのコードチャレンジ方式 (RFC 7636 Section 4.2)
+const (
+	pkceMethodS256  = "S256"
+	pkceMethodPlain = "plain"
+)
+
+// code_verifier の長さの制限 (RFC 7636 Section 4.1)
+const (
+	pkceVerifierMinLength = 43
+	pkceVerifierMaxLength = 128
+)
+
+// validateCodeChallenge 認可リクエストの code_challenge と code_challenge_method をクライアントのポリシーに従って検証します
+// 検証に成功した場合は保存するコードチャレンジ方式を返します (PKCEを省略した場合は空文字)
+func validateCodeChallenge(client *model.Client, codeChallenge string, method string) (string, error) {
+	if codeChallenge == "" {
+		if method != "" {
+			return "", errors.New("code_challenge_method without code_challenge")
+		}
+		// PKCEの省略はポリシーで許可されたコンフィデンシャルクライアントのみ
+		if client.IsConfidential() && client.PKCEOptional {
+			return "", nil
+		}
+		return "", errors.New("code_challenge is required")
+	}
+
+	// 省略時は plain として扱う (RFC 7636 Section 4.3)
+	if method == "" {
+		method = pkceMethodPlain
+	}
+
+	switch method {
+	case pkceMethodS256:
+		// SHA-256 ハッシュの base64url エンコード (パディングなし) は43文字になる
+		if decoded, err := base64.RawURLEncoding.DecodeString(codeChallenge); err != nil || len(decoded) != sha256.Size {
+			return "", errors.New("malformed S256 code_challenge")
+		}
+	case pkceMethodPlain:
+		if !client.AllowPlainPKCE {
+			return "", fmt.Errorf("code_challenge_method %s is not allowed for client", method)
+		}
+		if !isValidCodeVerifier(codeChallenge) {
+			return "", errors.New("malformed plain code_challenge")
+		}
+	default:
+		return "", fmt.Errorf("unsupported code_challenge_method: %s", method)
+	}
+	return method, nil
+}
+
+// verifyCodeVerifier トークンリクエストの code_verifier を認可時のコードチャレンジと照合します (RFC 7636 Section 4.6)
+func verifyCodeVerifier(session *model.AuthorizeSession, codeVerifier string) error {
+	// 認可リクエストでPKCEを省略した場合は code_verifier を受け付けない (ダウングレード防止)
+	if session.CodeChallenge == "" {
+		if codeVerifier != "" {
+			return errors.New("code_verifier without code_challenge")
+		}
+		return nil
+	}
+
+	if codeVerifier == "" {
+		return errors.New("missing code_verifier")
+	}
+	if !isValidCodeVerifier(codeVerifier) {
+		return errors.New("malformed code_verifier")
+	}
+
+	var computed string
+	switch session.CodeChallengeMethod {
+	case pkceMethodS256:
+		hash := sha256.Sum256([]byte(codeVerifier))
+		computed = base64.RawURLEncoding.EncodeToString(hash[:])
+	case pkceMethodPlain:
+		computed = codeVerifier
+	default:
+		return fmt.Errorf("unsupported code_challenge_method: %s", session.CodeChallengeMethod)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(session.CodeChallenge)) != 1 {
+		return errors.New("code_verifier does not match code_challenge")
+	}
+	return nil
+}
+
+// isValidCodeVerifier code_verifier の長さと文字種を検証します
+// [A-Z] / [a-z] / [0-9] / "-" / "." / "_" / "~" の43〜128文字である必要があります
+func isValidCodeVerifier(verifier string) bool {
+	if len(verifier) < pkceVerifierMinLength || len(verifier) > pkceVerifierMaxLength {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"backend/model"
+	"strings"
+	"testing"
+)
+
+// RFC 7636 Appendix B の例
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestValidateCodeChallenge(t *testing.T) {
+	public := &model.Client{TokenEndpointAuthMethod: "none"}
+	confidential := &model.Client{TokenEndpointAuthMethod: "client_secret_basic"}
+	optional := &model.Client{TokenEndpointAuthMethod: "client_secret_basic", PKCEOptional: true}
+	publicOptional := &model.Client{TokenEndpointAuthMethod: "none", PKCEOptional: true}
+	plain := &model.Client{TokenEndpointAuthMethod: "none", AllowPlainPKCE: true}
+
+	tests := []struct {
+		name      string
+		client    *model.Client
+		challenge string
+		method    string
+		want      string
+		wantErr   bool
+	}{
+		{name: "S256", client: public, challenge: testCodeChallenge, method: "S256", want: "S256"},
+		{name: "S256 malformed", client: public, challenge: "not-a-hash", method: "S256", wantErr: true},
+		{name: "S256 wrong length", client: public, challenge: testCodeChallenge[:42], method: "S256", wantErr: true},
+		{name: "plain not allowed", client: public, challenge: testCodeVerifier, method: "plain", wantErr: true},
+		{name: "method omitted is plain", client: public, challenge: testCodeVerifier, wantErr: true},
+		{name: "plain allowed", client: plain, challenge: testCodeVerifier, method: "plain", want: "plain"},
+		{name: "method omitted with plain allowed", client: plain, challenge: testCodeVerifier, want: "plain"},
+		{name: "plain too short", client: plain, challenge: testCodeVerifier[:42], method: "plain", wantErr: true},
+		{name: "unsupported method", client: plain, challenge: testCodeChallenge, method: "S512", wantErr: true},
+		{name: "missing for public client", client: public, wantErr: true},
+		{name: "missing for confidential client", client: confidential, wantErr: true},
+		{name: "optional for confidential client", client: optional, want: ""},
+		{name: "optional ignored for public client", client: publicOptional, wantErr: true},
+		{name: "method without challenge", client: optional, method: "S256", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateCodeChallenge(tt.client, tt.challenge, tt.method)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCodeChallenge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("validateCodeChallenge() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	s256 := &model.AuthorizeSession{CodeChallenge: testCodeChallenge, CodeChallengeMethod: "S256"}
+	plain := &model.AuthorizeSession{CodeChallenge: testCodeVerifier, CodeChallengeMethod: "plain"}
+	none := &model.AuthorizeSession{}
+
+	tests := []struct {
+		name     string
+		session  *model.AuthorizeSession
+		verifier string
+		wantErr  bool
+	}{
+		{name: "S256", session: s256, verifier: testCodeVerifier},
+		{name: "S256 mismatch", session: s256, verifier: strings.Repeat("a", 43), wantErr: true},
+		{name: "S256 challenge as verifier", session: s256, verifier: testCodeChallenge, wantErr: true},
+		{name: "plain", session: plain, verifier: testCodeVerifier},
+		{name: "plain mismatch", session: plain, verifier: strings.Repeat("a", 43), wantErr: true},
+		{name: "missing verifier", session: s256, wantErr: true},
+		{name: "too short", session: s256, verifier: strings.Repeat("a", 42), wantErr: true},
+		{name: "too long", session: s256, verifier: strings.Repeat("a", 129), wantErr: true},
+		{name: "invalid character", session: s256, verifier: strings.Repeat("a", 42) + "+", wantErr: true},
+		{name: "no challenge", session: none},
+		{name: "verifier without challenge", session: none, verifier: testCodeVerifier, wantErr: true},
+		{name: "unknown method", session: &model.AuthorizeSession{CodeChallenge: testCodeChallenge, CodeChallengeMethod: "S512"}, verifier: testCodeVerifier, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyCodeVerifier(tt.session, tt.verifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCodeVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
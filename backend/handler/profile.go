@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"backend/model"
+	"backend/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+	// 本番イメージ (alpine) にはタイムゾーンデータがないため、zoneinfo の検証用に埋め込む
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+// プロフィールの文字列項目の最大長
+const profileFieldMaxLength = 256
+
+var (
+	// E.164 形式の電話番号 (例: +819012345678)
+	phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// BCP 47 言語タグ (例: ja-JP)
+	localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+)
+
+// UserProfile はログイン中のユーザーのプロフィールを取得・更新するハンドラ関数
+// GET でプロフィールを返し、POST で送信された内容にプロフィール全体を置き換えます
+func UserProfile(w http.ResponseWriter, r *http.Request) {
+	log.Println("UserProfile")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authSession, ok := requireAuthSession(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := repos.Users.GetUserByID(r.Context(), authSession.UserID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var profile model.UserProfile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+			log.Printf("Invalid request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateUserProfile(profile); err != nil {
+			log.Printf("Invalid profile: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 取得に使用したレプリカの内容ではなく、保存先の最新のユーザー情報にプロフィールを反映する
+		user, err = repos.Users.ModifyUser(r.Context(), user.ID, func(user *model.User) error {
+			// 電話番号が変更された場合は確認済みの状態を取り消す
+			if profile.PhoneNumber != user.PhoneNumber {
+				user.PhoneNumberVerified = false
+			}
+			user.UserProfile = profile
+			user.UpdatedAt = time.Now()
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update user: %v", err)
+			// 取得後に削除されたユーザーは 404、メールアドレスの重複は 409 (writeStoreError) を返す
+			if errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	resp := model.UserProfileResponse{
+		ID:                  user.ID,
+		Email:               user.Email,
+		UserProfile:         user.UserProfile,
+		PhoneNumberVerified: user.PhoneNumberVerified,
+		UpdatedAt:           user.UpdatedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// validateUserProfile プロフィールの各項目を検証します
+func validateUserProfile(profile model.UserProfile) error {
+	fields := map[string]string{
+		"name":         profile.Name,
+		"given_name":   profile.GivenName,
+		"family_name":  profile.FamilyName,
+		"picture":      profile.Picture,
+		"locale":       profile.Locale,
+		"zoneinfo":     profile.Zoneinfo,
+		"phone_number": profile.PhoneNumber,
+	}
+	if profile.Address != nil {
+		fields["address.formatted"] = profile.Address.Formatted
+		fields["address.street_address"] = profile.Address.StreetAddress
+		fields["address.locality"] = profile.Address.Locality
+		fields["address.region"] = profile.Address.Region
+		fields["address.postal_code"] = profile.Address.PostalCode
+		fields["address.country"] = profile.Address.Country
+	}
+	for name, value := range fields {
+		if utf8.RuneCountInString(value) > profileFieldMaxLength {
+			return fmt.Errorf("%s is too long", name)
+		}
+	}
+
+	if profile.Picture != "" {
+		u, err := url.Parse(profile.Picture)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("picture must be an https URL")
+		}
+	}
+	if profile.Locale != "" && !localePattern.MatchString(profile.Locale) {
+		return errors.New("locale must be a BCP 47 language tag")
+	}
+	if profile.Zoneinfo != "" {
+		if _, err := time.LoadLocation(profile.Zoneinfo); err != nil || profile.Zoneinfo == "Local" {
+			return errors.New("zoneinfo must be an IANA time zone name")
+		}
+	}
+	if profile.PhoneNumber != "" && !phoneNumberPattern.MatchString(profile.PhoneNumber) {
+		return errors.New("phone_number must be in E.164 format")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"backend/model"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// リクエストオブジェクトの標準クレームのうち、認可リクエストのパラメータとして扱わないもの
+var requestObjectRegisteredClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti", "sub"}
+
+// resolveRequestObject request / request_uri パラメータで渡されたリクエストオブジェクト (RFC 9101) を検証し、
+// 認可リクエストのパラメータを返します
+// リクエストオブジェクトが指定されていない場合は params をそのまま返し、2番目の戻り値は false になります
+func resolveRequestObject(ctx context.Context, params url.Values) (url.Values, bool, error) {
+	requestObject := params.Get("request")
+	requestURI := params.Get("request_uri")
+	if requestObject == "" && requestURI == "" {
+		return params, false, nil
+	}
+	if requestObject != "" && requestURI != "" {
+		return nil, false, &authorizationRequestError{"invalid_request", "request and request_uri must not be used together"}
+	}
+
+	clientID := params.Get("client_id")
+	client, err := repos.Clients.GetClient(ctx, clientID)
+	if err != nil {
+		log.Printf("Invalid client ID: %s: %v", clientID, err)
+		return nil, false, clientLookupError(err)
+	}
+
+	// 参照渡しの場合は登録済みの request_uri からのみ取得する
+	if requestURI != "" {
+		if !slices.Contains(client.RequestURIs, requestURI) {
+			log.Printf("request_uri not registered for client: client=%s, request_uri=%s", clientID, requestURI)
+			return nil, false, &authorizationRequestError{"invalid_request_uri", "Invalid request_uri"}
+		}
+
+		var err error
+		requestObject, err = fetchRequestObject(ctx, requestURI)
+		if err != nil {
+			log.Printf("Failed to fetch request object: %v", err)
+			return nil, false, &authorizationRequestError{"invalid_request_uri", "Invalid request_uri"}
+		}
+	}
+
+	keys, err := clientKeySet(ctx, client)
+	if err != nil {
+		log.Printf("Failed to load client keys: client=%s, err=%v", clientID, err)
+		return nil, false, &authorizationRequestError{"invalid_request_object", "Invalid request object"}
+	}
+
+	verified, err := utils.VerifyRequestObject(requestObject, clientID, keys)
+	if err != nil {
+		log.Printf("Invalid request object: %v", err)
+		return nil, false, &authorizationRequestError{"invalid_request_object", "Invalid request object"}
+	}
+
+	// 同じリクエストオブジェクトの再利用を拒否する (RFC 9101 Section 10.8)
+	// 有効期限が切れるまでは同じ jti を受け付けない
+	fresh, err := repos.Tokens.MarkRequestObjectUsed(ctx, clientID, verified.JTI, time.Until(verified.ExpiresAt)+time.Minute)
+	if err != nil {
+		log.Printf("Failed to record request object jti: %v", err)
+		return nil, false, &authorizationRequestError{"temporarily_unavailable", "The authorization server is temporarily unavailable"}
+	}
+	if !fresh {
+		log.Printf("Request object replay detected: client=%s, jti=%s", clientID, verified.JTI)
+		return nil, false, &authorizationRequestError{"invalid_request_object", "Request object has already been used"}
+	}
+
+	objectParams, err := requestObjectParams(verified.Claims)
+	if err != nil {
+		log.Printf("Invalid request object claims: %v", err)
+		return nil, false, &authorizationRequestError{"invalid_request_object", "Invalid request object"}
+	}
+
+	// リクエストオブジェクトと矛盾するクエリパラメータは受け付けない
+	// 一致しないパラメータは改ざんされている可能性がある
+	for key, values := range params {
+		if key == "request" || key == "request_uri" {
+			continue
+		}
+		if objectValues, ok := objectParams[key]; ok && !slices.Equal(values, objectValues) {
+			log.Printf("Conflicting parameter in request object: %s", key)
+			return nil, false, &authorizationRequestError{"invalid_request", "Conflicting parameter: " + key}
+		}
+	}
+
+	// リクエストオブジェクトのパラメータのみを使用する (RFC 9101 Section 6.3)
+	objectParams.Set("client_id", clientID)
+	return objectParams, true, nil
+}
+
+// requestObjectParams リクエストオブジェクトのクレームを認可リクエストのパラメータに変換します
+// 配列は複数値のパラメータ、オブジェクトや数値はJSON文字列として扱います
+func requestObjectParams(claims jwt.MapClaims) (url.Values, error) {
+	params := url.Values{}
+	for key, value := range claims {
+		if slices.Contains(requestObjectRegisteredClaims, key) {
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			params.Set(key, v)
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("unsupported value in %s", key)
+				}
+				params.Add(key, s)
+			}
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			params.Set(key, string(encoded))
+		}
+	}
+	return params, nil
+}
+
+// clientKeySet クライアントの登録済み公開鍵を取得します
+func clientKeySet(ctx context.Context, client *model.Client) (jwk.Set, error) {
+	switch {
+	case len(client.JWKS) > 0:
+		return utils.ParseJWKS(client.JWKS)
+	case client.JWKSURI != "":
+		return utils.FetchJWKS(ctx, client.JWKSURI)
+	default:
+		return nil, errors.New("client has no registered jwks")
+	}
+}
+
+// fetchRequestObject request_uri からリクエストオブジェクトを取得します
+func fetchRequestObject(ctx context.Context, requestURI string) (string, error) {
+	if !strings.HasPrefix(requestURI, "https://") {
+		return "", fmt.Errorf("request_uri must use https: %s", requestURI)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURI, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/oauth-authz-req+jwt")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
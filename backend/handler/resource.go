@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"backend/config"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// errInvalidTarget 要求されたリソースに対してトークンを発行できない場合のエラー (RFC 8707 invalid_target)
+var errInvalidTarget = errors.New("invalid_target")
+
+// parseResourceIndicators resource パラメータを検証し、重複を除いたリソース識別子の一覧を返します
+// RFC 8707 Section 2 に従い、絶対URIかつ登録済みのリソースのみを受け付けます
+func parseResourceIndicators(values []string) ([]string, error) {
+	resources := make([]string, 0, len(values))
+	for _, value := range values {
+		if !config.IsValidResourceIndicator(value) {
+			return nil, fmt.Errorf("%w: malformed resource indicator: %s", errInvalidTarget, value)
+		}
+		if _, ok := config.GetResource(value); !ok {
+			return nil, fmt.Errorf("%w: unknown resource: %s", errInvalidTarget, value)
+		}
+		if !slices.Contains(resources, value) {
+			resources = append(resources, value)
+		}
+	}
+	return resources, nil
+}
+
+// selectTokenResources トークンリクエストで指定されたリソースを認可済みのリソースと照合します
+// requested が空の場合は認可済みのリソースをすべて対象とします
+// 認可リクエストでリソースが指定されていない場合は、登録済みの任意のリソースを指定できます
+func selectTokenResources(requested []string, granted []string) ([]string, error) {
+	if len(requested) == 0 {
+		return granted, nil
+	}
+
+	// リソースごとに個別のトークンを発行するため、1リクエストにつき1リソースに限定する
+	if len(requested) > 1 {
+		return nil, fmt.Errorf("%w: only one resource may be requested per token request", errInvalidTarget)
+	}
+
+	if len(granted) > 0 && !slices.Contains(granted, requested[0]) {
+		return nil, fmt.Errorf("%w: resource was not authorized: %s", errInvalidTarget, requested[0])
+	}
+	return requested, nil
+}
+
+// resolveAccessTokenTarget アクセストークンの audience と scope を決定します
+// リソースが指定されていない場合は従来どおりクライアントIDを audience とし、付与済みのスコープをそのまま設定します
+// リソースが指定されている場合は、付与済みのスコープのうち各リソースに定義されたスコープのみに絞り込みます
+func resolveAccessTokenTarget(clientID string, grantedScope string, resources []string) ([]string, string, error) {
+	if len(resources) == 0 {
+		return []string{clientID}, grantedScope, nil
+	}
+
+	grantedScopes := strings.Fields(grantedScope)
+	var scopes []string
+	for _, identifier := range resources {
+		resource, ok := config.GetResource(identifier)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: unknown resource: %s", errInvalidTarget, identifier)
+		}
+
+		matched := false
+		for _, scope := range grantedScopes {
+			if slices.Contains(resource.Scopes, scope) {
+				matched = true
+				if !slices.Contains(scopes, scope) {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+		if !matched {
+			return nil, "", fmt.Errorf("%w: no granted scope applies to resource: %s", errInvalidTarget, identifier)
+		}
+	}
+
+	return resources, strings.Join(scopes, " "), nil
+}
+
+// narrowScope 要求されたスコープが付与済みのスコープに含まれることを検証します
+// requested が空の場合は付与済みのスコープをそのまま返します
+func narrowScope(requested string, granted string) (string, bool) {
+	if requested == "" {
+		return granted, true
+	}
+
+	grantedScopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(grantedScopes, scope) {
+			return "", false
+		}
+	}
+	return strings.Join(strings.Fields(requested), " "), true
+}
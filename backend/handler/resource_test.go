@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"errors"
+	"slices"
+	"testing"
+)
+
+const (
+	testCatalogResource = "https://api.example.com/catalog"
+	testOrdersResource  = "https://api.example.com/orders"
+)
+
+// setTestResources テストの間だけ登録済みのAPIリソースを置き換えます
+func setTestResources(t *testing.T) {
+	t.Helper()
+	previous := config.Resources
+	config.Resources = []model.Resource{
+		{Identifier: testCatalogResource, Scopes: []string{"catalog:read", "catalog:write"}},
+		{Identifier: testOrdersResource, Scopes: []string{"orders:read"}},
+	}
+	t.Cleanup(func() { config.Resources = previous })
+}
+
+func TestParseResourceIndicators(t *testing.T) {
+	setTestResources(t)
+
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", values: nil, want: []string{}},
+		{name: "registered", values: []string{testCatalogResource, testOrdersResource}, want: []string{testCatalogResource, testOrdersResource}},
+		{name: "duplicates", values: []string{testCatalogResource, testCatalogResource}, want: []string{testCatalogResource}},
+		{name: "relative", values: []string{"/catalog"}, wantErr: true},
+		{name: "fragment", values: []string{testCatalogResource + "#x"}, wantErr: true},
+		{name: "unknown", values: []string{"https://api.example.com/unknown"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResourceIndicators(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResourceIndicators() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, errInvalidTarget) {
+					t.Errorf("parseResourceIndicators() error = %v, want invalid_target", err)
+				}
+				return
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseResourceIndicators() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectTokenResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		granted   []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "all granted", granted: []string{testCatalogResource, testOrdersResource}, want: []string{testCatalogResource, testOrdersResource}},
+		{name: "one granted", requested: []string{testOrdersResource}, granted: []string{testCatalogResource, testOrdersResource}, want: []string{testOrdersResource}},
+		{name: "not granted", requested: []string{testOrdersResource}, granted: []string{testCatalogResource}, wantErr: true},
+		{name: "more than one", requested: []string{testCatalogResource, testOrdersResource}, granted: []string{testCatalogResource, testOrdersResource}, wantErr: true},
+		{name: "none granted", requested: []string{testOrdersResource}, want: []string{testOrdersResource}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectTokenResources(tt.requested, tt.granted)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectTokenResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectTokenResources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAccessTokenTarget(t *testing.T) {
+	setTestResources(t)
+
+	tests := []struct {
+		name         string
+		scope        string
+		resources    []string
+		wantAudience []string
+		wantScope    string
+		wantErr      bool
+	}{
+		{name: "no resource", scope: "openid catalog:read", wantAudience: []string{"client-1"}, wantScope: "openid catalog:read"},
+		{name: "narrowed to resource", scope: "openid catalog:read orders:read", resources: []string{testCatalogResource}, wantAudience: []string{testCatalogResource}, wantScope: "catalog:read"},
+		{name: "no applicable scope", scope: "openid orders:read", resources: []string{testCatalogResource}, wantErr: true},
+		{name: "unknown resource", scope: "catalog:read", resources: []string{"https://api.example.com/unknown"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audience, scope, err := resolveAccessTokenTarget("client-1", tt.scope, tt.resources)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAccessTokenTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(audience, tt.wantAudience) || scope != tt.wantScope {
+				t.Errorf("resolveAccessTokenTarget() = %v, %q, want %v, %q", audience, scope, tt.wantAudience, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested string
+		granted   string
+		want      string
+		wantOK    bool
+	}{
+		{name: "empty request", granted: "openid profile", want: "openid profile", wantOK: true},
+		{name: "subset", requested: "profile", granted: "openid profile", want: "profile", wantOK: true},
+		{name: "extra spaces", requested: " openid  profile ", granted: "openid profile", want: "openid profile", wantOK: true},
+		{name: "not granted", requested: "openid email", granted: "openid profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := narrowScope(tt.requested, tt.granted)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("narrowScope() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
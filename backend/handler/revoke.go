@@ -1,12 +1,13 @@
 package handler
 
 import (
-	"backend/config"
 	"backend/store"
+	"backend/utils"
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"slices"
 )
 
 // RevokeToken はトークンを無効化するためのハンドラー関数です
@@ -32,7 +33,6 @@ func RevokeToken(w http.ResponseWriter, r *http.Request) {
 
 	token := r.FormValue("token")
 	tokenTypeHint := r.FormValue("token_type_hint") // access_token または refresh_token
-	clientID := r.FormValue("client_id")
 
 	if token == "" {
 		log.Println("Missing token")
@@ -41,26 +41,20 @@ func RevokeToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// クライアントIDの検証（パブリッククライアントのためシークレットは不要）
-	if clientID == "" {
-		log.Println("Missing client ID")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
-		return
-	}
-
-	if !slices.Contains(config.ClientIDs, clientID) {
-		log.Printf("Invalid client ID: %s", clientID)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+	// クライアント認証（パブリッククライアントの場合はクライアントIDのみ）
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
 		return
 	}
+	clientID := client.ClientID
 
 	// トークン取り消し処理
-	if err := revokeTokenFromStore(token, tokenTypeHint, clientID); err != nil {
+	if err := revokeTokenFromStore(r.Context(), token, tokenTypeHint, clientID); err != nil {
 		log.Printf("Failed to revoke token: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "server_error"})
+		// 保存先の障害の場合は 503 を返し、クライアントに再試行させる (RFC 7009 Section 2.2.1)
+		writeOAuthStoreError(w, err)
 		return
 	}
 
@@ -70,14 +64,21 @@ func RevokeToken(w http.ResponseWriter, r *http.Request) {
 }
 
 // revokeTokenFromStore はトークンストアからトークンを無効化する関数
-func revokeTokenFromStore(token string, tokenTypeHint string, clientID string) error {
+func revokeTokenFromStore(ctx context.Context, token string, tokenTypeHint string, clientID string) error {
+	// リフレッシュトークンの形式でないトークン (アクセストークンなど) は保存先に存在しない
+	if utils.CheckRefreshToken(token) != nil {
+		log.Printf("Not a refresh token, nothing to revoke")
+		return nil
+	}
+
 	// トークンセッションを取得
-	session, err := store.GetTokenSession(token)
-	if err == nil {
+	// 有効期限を過ぎたセッションも発行先のクライアントであれば削除する
+	session, err := repos.Tokens.GetTokenSession(ctx, token)
+	if err == nil || errors.Is(err, store.ErrExpired) {
 		// トークンが存在する場合、そのクライアントIDが一致するか確認
 		if session.ClientID == clientID {
 			log.Printf("Revoking token for client ID: %s", clientID)
-			return store.DeleteSession("token_session", token)
+			return repos.Tokens.DeleteTokenSession(ctx, token)
 		}
 		// クライアントIDが一致しない場合もエラーは返さない
 		// RFC7009では、他のクライアントのトークンを取り消そうとした場合も
@@ -86,6 +87,11 @@ func revokeTokenFromStore(token string, tokenTypeHint string, clientID string) e
 		return nil
 	}
 
+	// 保存先の障害の場合は取り消せたか分からないため、成功として扱わない
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
 	// トークンが見つからない場合もエラーは返さない
 	// RFC7009では、存在しないトークンも成功として扱います
 	log.Printf("Token not found, treating as already revoked")
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"backend/authz"
+	"backend/model"
+	"backend/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// ロール割り当てAPIの権限
+const (
+	permissionUserRolesRead  = "user_roles.read"
+	permissionUserRolesWrite = "user_roles.write"
+)
+
+// ロール割り当てAPIの認可ポリシー
+// hub-admin ロールは管理用クライアントの allowed_roles に含めた場合のみアクセストークンに含まれる
+var userRolesPolicy = authz.Policy{
+	Roles: map[string][]string{
+		"hub-admin": {permissionUserRolesRead, permissionUserRolesWrite},
+	},
+}
+
+// 1ユーザーに割り当てられるグループ・ロールの上限
+const maxAssignedRoles = 64
+
+// グループ名・ロール名 (例: staff, store-1:admin)
+var roleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,63}$`)
+
+// UserRoles はユーザーのグループとロールを取得・割り当てるハンドラ関数
+// GET で user_id または email クエリパラメータのユーザーの割り当てを返し、
+// POST で送信された内容に割り当てを置き換えます
+// 変更は次回のトークン発行 (リフレッシュを含む) から反映されます
+func UserRoles(w http.ResponseWriter, r *http.Request) {
+	log.Println("UserRoles")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireAccessToken(w, r)
+	if !ok {
+		return
+	}
+	permission := permissionUserRolesRead
+	if r.Method == http.MethodPost {
+		permission = permissionUserRolesWrite
+	}
+	principal := authz.NewPrincipal(claims)
+	if !userRolesPolicy.Allows(principal, permission) {
+		log.Printf("Permission denied: sub=%s, permission=%s", principal.Subject, permission)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req model.UserRolesRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("Invalid request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	} else {
+		req.UserID = r.URL.Query().Get("user_id")
+		req.Email = r.URL.Query().Get("email")
+	}
+
+	user, err := findUser(r.Context(), req.UserID, req.Email)
+	if err != nil {
+		log.Printf("User not found: %v", err)
+		writeStoreError(w, err, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		groups, err := normalizeRoleNames(req.Groups)
+		if err != nil {
+			log.Printf("Invalid groups: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		roles, err := normalizeRoleNames(req.Roles)
+		if err != nil {
+			log.Printf("Invalid roles: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 取得に使用したレプリカの内容ではなく、保存先の最新のユーザー情報に割り当てを反映する
+		user, err = repos.Users.ModifyUser(r.Context(), user.ID, func(user *model.User) error {
+			user.Groups = groups
+			user.Roles = roles
+			user.UpdatedAt = time.Now()
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update user: %v", err)
+			// 取得後に削除されたユーザーは 404、メールアドレスの重複は 409 (writeStoreError) を返す
+			if errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		log.Printf("User roles updated: user=%s, by=%s, groups=%v, roles=%v", user.ID, principal.Subject, groups, roles)
+	}
+
+	resp := model.UserRolesResponse{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Groups:    nonNilStrings(user.Groups),
+		Roles:     nonNilStrings(user.Roles),
+		UpdatedAt: user.UpdatedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// findUser ユーザーIDまたはメールアドレスからユーザーを取得します
+func findUser(ctx context.Context, userID string, email string) (*model.User, error) {
+	switch {
+	case userID != "":
+		return repos.Users.GetUserByID(ctx, userID)
+	case email != "":
+		return repos.Users.GetUserByEmail(ctx, email)
+	default:
+		return nil, fmt.Errorf("missing user_id or email")
+	}
+}
+
+// normalizeRoleNames グループ名・ロール名を検証し、重複を除いて並べ替えます
+func normalizeRoleNames(names []string) ([]string, error) {
+	if len(names) > maxAssignedRoles {
+		return nil, fmt.Errorf("too many values: max %d", maxAssignedRoles)
+	}
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		if !roleNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid name: %q", name)
+		}
+		normalized = append(normalized, name)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// releasedGroupsAndRoles アクセストークンに含めるユーザーのグループとロールを返します
+// クライアントの allowed_groups / allowed_roles に一致するものだけを公開します
+// user が nil の場合 (クライアント自身のトークン) はいずれも空になります
+func releasedGroupsAndRoles(client *model.Client, user *model.User) ([]string, []string) {
+	if user == nil {
+		return nil, nil
+	}
+	return matchingNames(client.AllowedGroups, user.Groups), matchingNames(client.AllowedRoles, user.Roles)
+}
+
+// matchingNames names のうち、いずれかのパターン (path.Match 形式) に一致するものを返します
+func matchingNames(patterns []string, names []string) []string {
+	var matched []string
+	for _, name := range names {
+		if slices.ContainsFunc(patterns, func(pattern string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		}) {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/utils"
+	"context"
+	"fmt"
+)
+
+// subjectIdentifier クライアントに対して発行するユーザーの sub を返します (OpenID Connect Core 1.0 Section 8)
+// pairwise のクライアントにはセクターごとのペアワイズ識別子を、それ以外には内部のユーザーIDを返します
+func subjectIdentifier(ctx context.Context, client *model.Client, userID string) (string, error) {
+	if !client.IsPairwise() {
+		return userID, nil
+	}
+
+	subject := utils.PairwiseSubject(config.PairwiseSubjectSecret, client.SectorIdentifier(), userID)
+	// UserInfo などでトークンの sub からユーザーを引けるように対応を保存する
+	if err := repos.Users.SavePairwiseSubject(ctx, subject, userID); err != nil {
+		return "", fmt.Errorf("failed to save pairwise subject: %w", err)
+	}
+	return subject, nil
+}
+
+// resolveUserID トークンの sub から内部のユーザーIDを返します
+// ペアワイズ識別子でない場合は sub をそのまま返します
+func resolveUserID(ctx context.Context, subject string) (string, error) {
+	userID, err := repos.Users.GetUserIDByPairwiseSubject(ctx, subject)
+	if err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return subject, nil
+	}
+	return userID, nil
+}
@@ -5,12 +5,11 @@ import (
 	"backend/model"
 	"backend/store"
 	"backend/utils"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"slices"
+	"strings"
 	"time"
 )
 
@@ -39,6 +38,12 @@ func Token(w http.ResponseWriter, r *http.Request) {
 		handleAuthorizationCodeGrant(w, r)
 	case "refresh_token":
 		handleRefreshTokenGrant(w, r)
+	case "client_credentials":
+		handleClientCredentialsGrant(w, r)
+	case deviceCodeGrantType:
+		handleDeviceCodeGrant(w, r)
+	case tokenExchangeGrantType:
+		handleTokenExchangeGrant(w, r)
 	default:
 		log.Printf("Invalid grant type: %s", grantType)
 		http.Error(w, "Invalid grant type", http.StatusBadRequest)
@@ -47,10 +52,27 @@ func Token(w http.ResponseWriter, r *http.Request) {
 
 // 認可コードグラントタイプの処理
 func handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
-	clientID := r.PostForm.Get("client_id")
-	if !slices.Contains(config.ClientIDs, clientID) {
-		log.Printf("Invalid client ID: %s", clientID)
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+	if !client.AllowsGrantType("authorization_code") {
+		log.Printf("Grant type not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+	clientID := client.ClientID
+
+	// DPoP証明の検証 (RFC 9449)
+	dpopJKT, ok := bindDPoP(w, r, client)
+	if !ok {
+		return
+	}
+	// クライアント証明書による束縛 (RFC 8705)
+	certThumbprint, ok := bindCertificate(w, r, client)
+	if !ok {
 		return
 	}
 
@@ -69,68 +91,140 @@ func handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing authorization code", http.StatusBadRequest)
 		return
 	}
-	if codeVerifier == "" {
-		log.Println("Missing code verifier")
-		http.Error(w, "Missing code verifier", http.StatusBadRequest)
-		return
-	}
 
-	session, err := store.GetAuthorizeSession(authCode)
+	session, err := repos.Codes.GetAuthorizeSession(r.Context(), authCode)
 	if err != nil {
 		log.Printf("Invalid authorization code: %v", err)
-		http.Error(w, "Invalid authorization code", http.StatusBadRequest)
+		writeGrantError(w, err, "Invalid authorization code")
 		return
 	}
 
 	// セッションの検証
 	if session.ClientID != clientID {
 		log.Printf("Client ID mismatch: expected=%s, got=%s", session.ClientID, clientID)
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid client ID")
 		return
 	}
 
 	if session.RedirectURI != redirectURI {
 		log.Printf("Redirect URI mismatch: expected=%s, got=%s", session.RedirectURI, redirectURI)
-		http.Error(w, "Invalid redirect URI", http.StatusBadRequest)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid redirect URI")
 		return
 	}
 
 	// PKCE検証
-	codeVerifierHash := sha256.Sum256([]byte(codeVerifier))
-	codeVerifierHashString := base64.RawURLEncoding.EncodeToString(codeVerifierHash[:])
-	if codeVerifierHashString != session.CodeChallenge {
-		log.Printf("Invalid code verifier: challenge=%s, computed=%s",
-			session.CodeChallenge, codeVerifierHashString)
-		http.Error(w, "Invalid code verifier", http.StatusBadRequest)
+	if err := verifyCodeVerifier(session, codeVerifier); err != nil {
+		log.Printf("Invalid code verifier: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code verifier")
+		return
+	}
+
+	// トークンリクエストで指定されたリソースの検証 (RFC 8707)
+	requestedResources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	resources, err := selectTokenResources(requestedResources, session.Resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	audience, accessTokenScope, err := resolveAccessTokenTarget(clientID, session.Scope, resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
 		return
 	}
 
 	// セッションからユーザー情報を取得
 	userID := session.UserID
-	email := session.Email
+	user, err := repos.Users.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		writeGrantError(w, err, "User not found")
+		return
+	}
+	subject, err := subjectIdentifier(r.Context(), client, userID)
+	if err != nil {
+		log.Printf("Failed to resolve subject: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	// クライアントに公開するグループとロール
+	groups, roles := releasedGroupsAndRoles(client, user)
+
+	// クライアントごとのクレームマッピングを適用する
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, user, session.AuthenticationContext, accessTokenScope, nil)
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	idTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetIDToken, user, session.AuthenticationContext, session.Scope,
+		releasedUserClaims(user, session.Scope, session.Claims.IDTokenClaims()))
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// トークン生成
+	// 有効期間はクライアントとグラントタイプの設定に従う
+	lifetimes := config.Lifetimes(client, "authorization_code")
 	now := time.Now()
-	expiresIn := int64(3600)
+	tokenID, err := saveUserInfoClaims(r.Context(), session.Claims.UserInfoClaims(), lifetimes.AccessTokenTTL)
+	if err != nil {
+		log.Printf("Failed to save userinfo claims: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
 
-	// IDトークンの生成 - クライアントIDを渡す
-	idToken, err := utils.GenerateIDToken(userID, email, clientID, now, expiresIn)
+	// アクセストークンの生成 - リソースごとに audience とスコープを絞り込む
+	accessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:      subject,
+		ClientID:     clientID,
+		Audience:     audience,
+		Scope:        accessTokenScope,
+		IssuedAt:     now,
+		ExpiresIn:    lifetimes.AccessTokenTTL,
+		Confirmation: tokenConfirmation(dpopJKT, certThumbprint),
+		TokenID:      tokenID,
+		Groups:       groups,
+		Roles:        roles,
+		Claims:       accessTokenClaims,
+	})
 	if err != nil {
-		log.Printf("Failed to generate ID token: %v", err)
+		log.Printf("Failed to generate access token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// アクセストークンの生成 - クライアントIDを渡す
-	accessToken, err := utils.GenerateAccessToken(userID, clientID, now, expiresIn)
+	// IDトークンの生成 - 認可リクエストの nonce と認証時の情報を引き継ぐ
+	idToken, err := utils.GenerateIDToken(utils.IDTokenParams{
+		Subject:           subject,
+		ClientID:          clientID,
+		IssuedAt:          now,
+		ExpiresIn:         lifetimes.IDTokenTTL,
+		Nonce:             session.Nonce,
+		AuthTime:          session.AuthTime,
+		AMR:               session.AMR,
+		ACR:               session.ACR,
+		AccessToken:       accessToken,
+		AuthorizationCode: authCode,
+		Claims:            idTokenClaims,
+	})
 	if err != nil {
-		log.Printf("Failed to generate access token: %v", err)
+		log.Printf("Failed to generate ID token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	// リフレッシュトークンの生成
-	refreshToken, err := utils.GenerateRefreshToken(userID)
+	refreshToken, err := utils.GenerateRefreshToken()
 	if err != nil {
 		log.Printf("Failed to generate refresh token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -138,36 +232,60 @@ func handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// クライアント固有のトークンセッションを保存
+	expiresAt, absoluteExpiresAt := lifetimes.RefreshTokenExpiry(now, time.Time{})
 	tokenSession := model.TokenSession{
-		UserID:       userID,
-		ClientID:     clientID,
-		RefreshToken: refreshToken,
-		CreatedAt:    time.Now(),
-		ExpiresAt:    time.Now().Add(30 * 24 * time.Hour),
-		IsRevoked:    false,
+		UserID:                userID,
+		ClientID:              clientID,
+		Scope:                 session.Scope,
+		Resources:             session.Resources,
+		Claims:                session.Claims,
+		DPoPJKT:               dpopJKT,
+		CertificateThumbprint: certThumbprint,
+		CreatedAt:             now,
+		ExpiresAt:             expiresAt,
+		AbsoluteExpiresAt:     absoluteExpiresAt,
+		IsRevoked:             false,
+		AuthenticationContext: session.AuthenticationContext,
 	}
 
-	if err := store.SaveTokenSession(refreshToken, tokenSession); err != nil {
+	if err := repos.Tokens.SaveTokenSession(r.Context(), refreshToken, tokenSession); err != nil {
 		log.Printf("Failed to save token session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeOAuthStoreError(w, err)
 		return
 	}
 
 	// トークン発行後に認可コードセッションを削除
-	if err := store.DeleteAuthorizeSession(authCode); err != nil {
+	if err := repos.Codes.DeleteAuthorizeSession(r.Context(), authCode); err != nil {
 		log.Printf("Warning: Failed to delete authorization code session: %v", err)
 		// 処理は続行
 	}
 
-	sendTokenResponse(w, idToken, accessToken, refreshToken)
+	sendTokenResponse(w, idToken, accessToken, refreshToken, accessTokenScope, tokenTypeFor(dpopJKT), lifetimes.AccessTokenTTL)
 }
 
 // リフレッシュトークングラントタイプの処理
 func handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request) {
-	clientID := r.PostForm.Get("client_id")
-	if !slices.Contains(config.ClientIDs, clientID) {
-		log.Printf("Invalid client ID: %s", clientID)
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+	if !client.AllowsGrantType("refresh_token") {
+		log.Printf("Grant type not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+	clientID := client.ClientID
+
+	// DPoP証明の検証 (RFC 9449)
+	dpopJKT, ok := bindDPoP(w, r, client)
+	if !ok {
+		return
+	}
+	// クライアント証明書による束縛 (RFC 8705)
+	certThumbprint, ok := bindCertificate(w, r, client)
+	if !ok {
 		return
 	}
 
@@ -178,68 +296,179 @@ func handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 形式やチェックサムが正しくないトークンは保存先を参照せずに拒否する
+	if err := utils.CheckRefreshToken(refreshToken); err != nil {
+		log.Printf("Invalid refresh token: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+	if utils.IsLegacyRefreshToken(refreshToken) {
+		// 以前の形式のトークンの利用状況を確認し、互換処理を削除できる時期を判断するためのログ
+		log.Printf("Legacy refresh token presented by client: %s", clientID)
+	}
+
 	// トークンセッションを取得
-	tokenSession, err := store.GetTokenSession(refreshToken)
+	// 有効期限を過ぎたセッションは保存先が ErrExpired を返す
+	tokenSession, err := repos.Tokens.GetTokenSession(r.Context(), refreshToken)
+	if errors.Is(err, store.ErrExpired) {
+		log.Printf("Refresh token has expired: %v", err)
+		writeGrantError(w, err, "Expired refresh token")
+		return
+	}
 	if err != nil {
 		log.Printf("Invalid refresh token: %v", err)
-		http.Error(w, "Invalid refresh token", http.StatusBadRequest)
+		writeGrantError(w, err, "Invalid refresh token")
 		return
 	}
 
 	// トークンの有効性チェック
 	if tokenSession.IsRevoked {
 		log.Println("Refresh token has been revoked")
-		http.Error(w, "Invalid refresh token", http.StatusBadRequest)
-		return
-	}
-
-	if time.Now().After(tokenSession.ExpiresAt) {
-		log.Println("Refresh token has expired")
-		http.Error(w, "Expired refresh token", http.StatusBadRequest)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
 		return
 	}
 
 	// クライアントIDの検証
 	if tokenSession.ClientID != clientID {
 		log.Printf("Client ID mismatch for refresh token: expected=%s, got=%s", tokenSession.ClientID, clientID)
-		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid client ID")
+		return
+	}
+
+	// DPoPで束縛されたリフレッシュトークンは同じ鍵による証明がなければ使用できない
+	if tokenSession.DPoPJKT != "" && tokenSession.DPoPJKT != dpopJKT {
+		log.Println("DPoP key mismatch for refresh token")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is bound to a different DPoP key")
+		return
+	}
+	// クライアント証明書で束縛されたリフレッシュトークンは同じ証明書でなければ使用できない
+	if tokenSession.CertificateThumbprint != "" && tokenSession.CertificateThumbprint != certThumbprint {
+		log.Println("Client certificate mismatch for refresh token")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is bound to a different client certificate")
+		return
+	}
+
+	// ダウンスコープの検証
+	// リフレッシュトークン自体の権限は変えずに、単一リソース・一部スコープに絞ったアクセストークンを発行できる
+	scope, ok := narrowScope(r.PostForm.Get("scope"), tokenSession.Scope)
+	if !ok {
+		log.Printf("Requested scope exceeds granted scope: requested=%s, granted=%s", r.PostForm.Get("scope"), tokenSession.Scope)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds granted scope")
+		return
+	}
+	requestedResources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	resources, err := selectTokenResources(requestedResources, tokenSession.Resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	audience, accessTokenScope, err := resolveAccessTokenTarget(clientID, scope, resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
 		return
 	}
 
-	user, err := store.GetUserByID(tokenSession.UserID)
+	user, err := repos.Users.GetUserByID(r.Context(), tokenSession.UserID)
 	if err != nil {
 		log.Printf("Failed to get user: %v", err)
+		writeGrantError(w, err, "User not found")
+		return
+	}
+	subject, err := subjectIdentifier(r.Context(), client, tokenSession.UserID)
+	if err != nil {
+		log.Printf("Failed to resolve subject: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	// ユーザー情報は毎回取得し直すため、属性やロールの変更は次回のリフレッシュで反映される
+	groups, roles := releasedGroupsAndRoles(client, user)
+
+	// クライアントごとのクレームマッピングを適用する
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, user, tokenSession.AuthenticationContext, accessTokenScope, nil)
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	idTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetIDToken, user, tokenSession.AuthenticationContext, tokenSession.Scope,
+		releasedUserClaims(user, tokenSession.Scope, tokenSession.Claims.IDTokenClaims()))
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// 提示されたリフレッシュトークンを使用済みにする (ローテーション)
+	// 取得と削除を不可分に行うため、同時に提示された同じトークンで新しいトークンを発行できるのは1回だけ
+	// 検証した後に取り消された場合は、取り消しを優先する
+	consumed, err := repos.Tokens.ConsumeTokenSession(r.Context(), refreshToken)
+	if err != nil {
+		log.Printf("Failed to consume refresh token: %v", err)
+		writeGrantError(w, err, "Invalid refresh token")
+		return
+	}
+	if consumed.IsRevoked {
+		log.Println("Refresh token has been revoked")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
 	// 新しいアクセストークンとIDトークンを生成
-	newIdToken, err := utils.GenerateIDToken(
-		tokenSession.UserID,
-		user.Email,
-		clientID,
-		time.Now(),
-		3600)
+	lifetimes := config.Lifetimes(client, "refresh_token")
+	now := time.Now()
+	tokenID, err := saveUserInfoClaims(r.Context(), tokenSession.Claims.UserInfoClaims(), lifetimes.AccessTokenTTL)
 	if err != nil {
-		log.Printf("Failed to generate new ID token: %v", err)
+		log.Printf("Failed to save userinfo claims: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+	newAccessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:      subject,
+		ClientID:     clientID,
+		Audience:     audience,
+		Scope:        accessTokenScope,
+		IssuedAt:     now,
+		ExpiresIn:    lifetimes.AccessTokenTTL,
+		Confirmation: tokenConfirmation(dpopJKT, certThumbprint),
+		TokenID:      tokenID,
+		Groups:       groups,
+		Roles:        roles,
+		Claims:       accessTokenClaims,
+	})
+	if err != nil {
+		log.Printf("Failed to generate new access token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	newAccessToken, err := utils.GenerateAccessToken(
-		tokenSession.UserID,
-		clientID,
-		time.Now(),
-		3600)
+	// IDトークンには元の認証時刻と方式を引き継ぐ (OpenID Connect Core 1.0 Section 12.2)
+	newIdToken, err := utils.GenerateIDToken(utils.IDTokenParams{
+		Subject:     subject,
+		ClientID:    clientID,
+		IssuedAt:    now,
+		ExpiresIn:   lifetimes.IDTokenTTL,
+		AuthTime:    tokenSession.AuthTime,
+		AMR:         tokenSession.AMR,
+		ACR:         tokenSession.ACR,
+		AccessToken: newAccessToken,
+		Claims:      idTokenClaims,
+	})
 	if err != nil {
-		log.Printf("Failed to generate new access token: %v", err)
+		log.Printf("Failed to generate new ID token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	// 新しいリフレッシュトークンを生成
-	newRefreshToken, err := utils.GenerateRefreshToken(
-		tokenSession.UserID)
+	newRefreshToken, err := utils.GenerateRefreshToken()
 	if err != nil {
 		log.Printf("Failed to generate new refresh token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -247,32 +476,133 @@ func handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 新しいトークンセッションを保存
+	// アイドル期間はローテーションのたびに延長し、絶対的な有効期限は最初の発行時のものを引き継ぐ
+	// (絶対的な有効期限を持たない以前のセッションは、その有効期限を引き継ぐ)
+	absoluteExpiresAt := tokenSession.AbsoluteExpiresAt
+	if absoluteExpiresAt.IsZero() {
+		absoluteExpiresAt = tokenSession.ExpiresAt
+	}
+	expiresAt, absoluteExpiresAt := lifetimes.RefreshTokenExpiry(now, absoluteExpiresAt)
 	newTokenSession := model.TokenSession{
-		UserID:       tokenSession.UserID,
-		ClientID:     clientID,
-		RefreshToken: newRefreshToken,
-		CreatedAt:    time.Now(),
-		ExpiresAt:    time.Now().Add(30 * 24 * time.Hour),
-		IsRevoked:    false,
+		UserID:                tokenSession.UserID,
+		ClientID:              clientID,
+		Scope:                 tokenSession.Scope,
+		Resources:             tokenSession.Resources,
+		Claims:                tokenSession.Claims,
+		DPoPJKT:               dpopJKT,
+		CertificateThumbprint: certThumbprint,
+		CreatedAt:             now,
+		ExpiresAt:             expiresAt,
+		AbsoluteExpiresAt:     absoluteExpiresAt,
+		IsRevoked:             false,
+		AuthenticationContext: tokenSession.AuthenticationContext,
 	}
 
-	if err := store.SaveTokenSession(newRefreshToken, newTokenSession); err != nil {
+	if err := repos.Tokens.SaveTokenSession(r.Context(), newRefreshToken, newTokenSession); err != nil {
 		log.Printf("Failed to save new token session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeOAuthStoreError(w, err)
 		return
 	}
 
 	// 新しいトークンでレスポンスを送信
-	sendTokenResponse(w, newIdToken, newAccessToken, newRefreshToken)
+	sendTokenResponse(w, newIdToken, newAccessToken, newRefreshToken, accessTokenScope, tokenTypeFor(dpopJKT), lifetimes.AccessTokenTTL)
+}
+
+// クライアントクレデンシャルグラントタイプの処理
+// ユーザーを伴わないサービス間通信用のアクセストークンのみを発行し、IDトークンとリフレッシュトークンは発行しない
+func handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request) {
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+
+	// コンフィデンシャルクライアントのみ利用可能
+	if !client.IsConfidential() || !client.AllowsGrantType("client_credentials") {
+		log.Printf("Client credentials grant not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+
+	// DPoP証明の検証 (RFC 9449)
+	dpopJKT, ok := bindDPoP(w, r, client)
+	if !ok {
+		return
+	}
+	// クライアント証明書による束縛 (RFC 8705)
+	certThumbprint, ok := bindCertificate(w, r, client)
+	if !ok {
+		return
+	}
+
+	// スコープはクライアントに許可されたスコープの範囲内に限定する
+	scope, ok := narrowScope(r.PostForm.Get("scope"), strings.Join(client.AllowedScopes, " "))
+	if !ok {
+		log.Printf("Requested scope exceeds allowed scope: client=%s, requested=%s", client.ClientID, r.PostForm.Get("scope"))
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope is not allowed for client")
+		return
+	}
+
+	// audience はリソースインジケーターから決定する (RFC 8707)
+	requestedResources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	resources, err := selectTokenResources(requestedResources, nil)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	audience, accessTokenScope, err := resolveAccessTokenTarget(client.ClientID, scope, resources)
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+
+	// ユーザーが存在しないため、クレームマッピングではユーザーと認証の情報は空になる
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, nil, model.AuthenticationContext{}, accessTokenScope, nil)
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// ユーザーが存在しないため、sub にはクライアントIDを設定する (RFC 9068 Section 2.2)
+	lifetimes := config.Lifetimes(client, "client_credentials")
+	accessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:      client.ClientID,
+		ClientID:     client.ClientID,
+		Audience:     audience,
+		Scope:        accessTokenScope,
+		IssuedAt:     time.Now(),
+		ExpiresIn:    lifetimes.AccessTokenTTL,
+		Confirmation: tokenConfirmation(dpopJKT, certThumbprint),
+		Claims:       accessTokenClaims,
+	})
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sendTokenResponse(w, "", accessToken, "", accessTokenScope, tokenTypeFor(dpopJKT), lifetimes.AccessTokenTTL)
 }
 
-func sendTokenResponse(w http.ResponseWriter, idToken, accessToken, refreshToken string) {
+// sendTokenResponse トークンレスポンスを送信します
+// expiresIn にはアクセストークンの発行に使用した有効期間を渡し、exp クレームと一致させます
+func sendTokenResponse(w http.ResponseWriter, idToken, accessToken, refreshToken, scope, tokenType string, expiresIn int64) {
 	resp := model.TokenResponse{
 		IDToken:      idToken,
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		TokenType:    "Bearer",
-		ExpiresIn:    3600,
+		TokenType:    tokenType,
+		ExpiresIn:    int(expiresIn),
+		Scope:        scope,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/store"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// トークン交換グラントのグラントタイプ (RFC 8693 Section 2.1)
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// トークン交換で扱うトークンの種類 (RFC 8693 Section 3)
+const (
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	idTokenType     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// exchangedSubject 検証済みの subject_token / actor_token の内容
+type exchangedSubject struct {
+	Subject  string
+	ClientID string
+	Audience []string
+	Scope    string
+	Actor    map[string]interface{}
+	// 送信者制約付きのトークンの場合に束縛された鍵・証明書の Thumbprint (cnf の jkt / x5t#S256)
+	Confirmation map[string]string
+}
+
+// トークン交換グラントタイプの処理
+// サービスが利用者の代わりに別のサービスを呼び出す際に、audience とスコープを絞ったアクセストークンを発行する
+// RFC8693: https://datatracker.ietf.org/doc/html/rfc8693
+func handleTokenExchangeGrant(w http.ResponseWriter, r *http.Request) {
+	client, err := authenticateClient(r)
+	if err != nil {
+		log.Printf("Client authentication failed: %v", err)
+		writeClientAuthError(w, r, err)
+		return
+	}
+	policy := client.TokenExchange
+	if !client.IsConfidential() || !client.AllowsGrantType(tokenExchangeGrantType) || policy == nil {
+		log.Printf("Token exchange not allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Grant type not allowed for client")
+		return
+	}
+
+	// DPoP証明の検証 (RFC 9449)
+	dpopJKT, ok := bindDPoP(w, r, client)
+	if !ok {
+		return
+	}
+	// クライアント証明書による束縛 (RFC 8705)
+	certThumbprint, ok := bindCertificate(w, r, client)
+	if !ok {
+		return
+	}
+
+	// 発行できるのはアクセストークンのみ
+	if requestedTokenType := r.PostForm.Get("requested_token_type"); requestedTokenType != "" && requestedTokenType != accessTokenType {
+		log.Printf("Unsupported requested token type: %s", requestedTokenType)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Unsupported requested_token_type")
+		return
+	}
+
+	// subject_token の検証
+	subject, err := verifyExchangeToken(r.PostForm.Get("subject_token"), r.PostForm.Get("subject_token_type"))
+	if err != nil {
+		log.Printf("Invalid subject token: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid subject token")
+		return
+	}
+	if err := verifySenderConstraint(r, subject, dpopJKT); err != nil {
+		log.Printf("Subject token sender constraint not satisfied: client=%s, err=%v", client.ClientID, err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid subject token")
+		return
+	}
+
+	// subject_token がこのクライアント宛てに発行されたものであることを確認する
+	subjectAudiences := policy.SubjectAudiences
+	if len(subjectAudiences) == 0 {
+		subjectAudiences = []string{client.ClientID}
+	}
+	if !slices.ContainsFunc(subject.Audience, func(aud string) bool { return slices.Contains(subjectAudiences, aud) }) {
+		log.Printf("Subject token audience not accepted: client=%s, aud=%v", client.ClientID, subject.Audience)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Subject token audience not accepted")
+		return
+	}
+
+	// なりすまし / 委任の判定
+	// actor_token が指定された場合、またはなりすましが許可されていない場合は委任として act クレームを付与する
+	var actor map[string]interface{}
+	actorToken := r.PostForm.Get("actor_token")
+	switch {
+	case actorToken != "":
+		if !policy.Delegation {
+			log.Printf("Delegation not allowed for client: %s", client.ClientID)
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Delegation not allowed for client")
+			return
+		}
+		actorSubject, err := verifyExchangeToken(actorToken, r.PostForm.Get("actor_token_type"))
+		if err != nil {
+			log.Printf("Invalid actor token: %v", err)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid actor token")
+			return
+		}
+		if err := verifySenderConstraint(r, actorSubject, dpopJKT); err != nil {
+			log.Printf("Actor token sender constraint not satisfied: client=%s, err=%v", client.ClientID, err)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid actor token")
+			return
+		}
+		// 実行者トークンは交換を要求したクライアント自身に発行されたものに限る
+		if actorSubject.ClientID != client.ClientID {
+			log.Printf("Actor token was not issued to client: client=%s, actor_client=%s", client.ClientID, actorSubject.ClientID)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid actor token")
+			return
+		}
+		actor = newActorClaim(actorSubject.Subject, subject.Actor)
+	case policy.Impersonation:
+		// なりすましの場合でも既存の委任チェーンは引き継ぐ
+		actor = subject.Actor
+	case policy.Delegation:
+		actor = newActorClaim(client.ClientID, subject.Actor)
+	default:
+		log.Printf("Neither impersonation nor delegation allowed for client: %s", client.ClientID)
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Token exchange not allowed for client")
+		return
+	}
+
+	// audience / resource の検証
+	// いずれもクライアントのポリシーで許可された値のみ指定できる
+	audiences := r.PostForm["audience"]
+	resources, err := parseResourceIndicators(r.PostForm["resource"])
+	if err != nil {
+		log.Printf("Invalid resource: %v", err)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+		return
+	}
+	if len(audiences) == 0 && len(resources) == 0 {
+		log.Println("Missing audience or resource")
+		writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Missing audience or resource")
+		return
+	}
+	for _, target := range slices.Concat(audiences, resources) {
+		if !slices.Contains(policy.AllowedAudiences, target) {
+			log.Printf("Audience not allowed for client: client=%s, audience=%s", client.ClientID, target)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Audience not allowed for client")
+			return
+		}
+	}
+
+	// スコープの絞り込み
+	// アクセストークンの場合は元のトークンのスコープ、IDトークンの場合はクライアントに許可されたスコープが上限となる
+	availableScope := subject.Scope
+	if r.PostForm.Get("subject_token_type") == idTokenType {
+		availableScope = strings.Join(client.AllowedScopes, " ")
+	}
+	scope, ok := narrowScope(r.PostForm.Get("scope"), availableScope)
+	if !ok {
+		log.Printf("Requested scope exceeds available scope: requested=%s, available=%s", r.PostForm.Get("scope"), availableScope)
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds subject token scope")
+		return
+	}
+	audience := audiences
+	if len(resources) > 0 {
+		var resourceAudience []string
+		resourceAudience, scope, err = resolveAccessTokenTarget(client.ClientID, scope, resources)
+		if err != nil {
+			log.Printf("Invalid resource: %v", err)
+			writeOAuthError(w, http.StatusBadRequest, "invalid_target", "Invalid resource")
+			return
+		}
+		audience = slices.Concat(resourceAudience, audiences)
+	}
+
+	// subject_token の sub はその発行先クライアント向けの値のため、交換を要求したクライアント向けの sub に変換する
+	tokenSubject, user, err := exchangedSubjectIdentifier(r.Context(), client, subject.Subject)
+	if err != nil {
+		log.Printf("Failed to resolve subject: %v", err)
+		writeOAuthStoreError(w, err)
+		return
+	}
+
+	// 交換を要求したクライアントに公開するグループとロール
+	groups, roles := releasedGroupsAndRoles(client, user)
+
+	// 元の認証の情報は引き継がないため、クレームマッピングではユーザーの情報のみを参照できる
+	accessTokenClaims, err := applyClaimsMapping(client, model.ClaimsTargetAccessToken, user, model.AuthenticationContext{}, scope, nil)
+	if err != nil {
+		log.Printf("Failed to apply claims mapping: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresIn := config.Lifetimes(client, tokenExchangeGrantType).AccessTokenTTL
+	accessToken, err := utils.GenerateAccessToken(utils.AccessTokenParams{
+		Subject:      tokenSubject,
+		ClientID:     client.ClientID,
+		Audience:     audience,
+		Scope:        scope,
+		IssuedAt:     time.Now(),
+		ExpiresIn:    expiresIn,
+		Actor:        actor,
+		Confirmation: tokenConfirmation(dpopJKT, certThumbprint),
+		Groups:       groups,
+		Roles:        roles,
+		Claims:       accessTokenClaims,
+	})
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// トークン交換ではリフレッシュトークンを発行しない
+	resp := model.TokenResponse{
+		AccessToken:     accessToken,
+		IssuedTokenType: accessTokenType,
+		TokenType:       tokenTypeFor(dpopJKT),
+		ExpiresIn:       int(expiresIn),
+		Scope:           scope,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// verifyExchangeToken subject_token / actor_token を種類に応じて検証します
+// このサーバーが発行したアクセストークンとIDトークンのみを受け入れます
+func verifyExchangeToken(token string, tokenType string) (*exchangedSubject, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+
+	var claims jwt.MapClaims
+	var err error
+	switch tokenType {
+	case accessTokenType:
+		claims, err = utils.VerifyAccessToken(token)
+	case idTokenType:
+		claims, err = utils.VerifyIDToken(token)
+		if err == nil {
+			// アクセストークンや他の発行者のトークンをIDトークンとして受け入れない
+			if iss, _ := claims.GetIssuer(); iss != utils.Issuer {
+				err = fmt.Errorf("unexpected issuer: %s", iss)
+			} else if _, isAccessToken := claims["typ"]; isAccessToken {
+				err = errors.New("not an id token")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token type: %s", tokenType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, errors.New("missing sub claim")
+	}
+	aud, err := claims.GetAudience()
+	if err != nil {
+		return nil, err
+	}
+
+	subject := &exchangedSubject{
+		Subject:  sub,
+		Audience: aud,
+	}
+	subject.ClientID, _ = claims["client_id"].(string)
+	subject.Scope, _ = claims["scope"].(string)
+	subject.Actor, _ = claims["act"].(map[string]interface{})
+	for _, member := range []string{"jkt", "x5t#S256"} {
+		if value := confirmationValue(claims, member); value != "" {
+			if subject.Confirmation == nil {
+				subject.Confirmation = map[string]string{}
+			}
+			subject.Confirmation[member] = value
+		}
+	}
+	return subject, nil
+}
+
+// verifySenderConstraint 送信者制約付き (cnf を含む) のトークンを、束縛された鍵・証明書を持つクライアントだけが交換できることを確認します
+// 束縛を確認せずに交換すると、漏洩したトークンから束縛のないトークンを得られてしまうため、
+// DPoP (jkt) の場合は同じ鍵のDPoP証明を、証明書 (x5t#S256) の場合は同じクライアント証明書をこのリクエストで提示する必要があります
+func verifySenderConstraint(r *http.Request, subject *exchangedSubject, dpopJKT string) error {
+	if jkt := subject.Confirmation["jkt"]; jkt != "" && jkt != dpopJKT {
+		return errors.New("DPoP proof for the bound key is required")
+	}
+	if thumbprint := subject.Confirmation["x5t#S256"]; thumbprint != "" {
+		chain, err := clientCertificateChain(r)
+		if err != nil {
+			return fmt.Errorf("malformed client certificate: %w", err)
+		}
+		if len(chain) == 0 || utils.CertificateThumbprint(chain[0]) != thumbprint {
+			return errors.New("client certificate for the bound token is required")
+		}
+	}
+	return nil
+}
+
+// exchangedSubjectIdentifier subject_token の sub を交換後のトークンの sub に変換し、対応するユーザーを返します
+// ユーザー以外 (client_credentials で発行されたクライアントなど) の sub はそのまま引き継ぎ、ユーザーは nil になります
+func exchangedSubjectIdentifier(ctx context.Context, client *model.Client, subject string) (string, *model.User, error) {
+	userID, err := resolveUserID(ctx, subject)
+	if err != nil {
+		return "", nil, err
+	}
+	user, err := repos.Users.GetUserByID(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return subject, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	tokenSubject, err := subjectIdentifier(ctx, client, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenSubject, user, nil
+}
+
+// newActorClaim act クレームを生成します
+// 既存の委任チェーンがある場合は入れ子にして保持します (RFC 8693 Section 4.1)
+func newActorClaim(actorSubject string, prior map[string]interface{}) map[string]interface{} {
+	actor := map[string]interface{}{
+		"sub": actorSubject,
+	}
+	if prior != nil {
+		actor["act"] = prior
+	}
+	return actor
+}
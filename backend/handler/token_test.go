@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"backend/model"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// リフレッシュトークンはローテーションで使用済みになり、同じトークンでは二度と発行できない
+func TestRefreshTokenRotation(t *testing.T) {
+	s := useMemoryStore(t)
+	ctx := context.Background()
+	if err := utils.InitJWKS(ctx, s); err != nil {
+		t.Fatalf("InitJWKS() error = %v", err)
+	}
+	saveTestClient(t, model.Client{
+		ClientID:                "client-1",
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+	})
+	user, err := s.GetOrCreateUser(ctx, "user-1@example.com")
+	if err != nil {
+		t.Fatalf("GetOrCreateUser() error = %v", err)
+	}
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error = %v", err)
+	}
+	now := time.Now()
+	session := model.TokenSession{UserID: user.ID, ClientID: "client-1", Scope: "openid", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := s.SaveTokenSession(ctx, refreshToken, session); err != nil {
+		t.Fatalf("SaveTokenSession() error = %v", err)
+	}
+
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		form := url.Values{"grant_type": {"refresh_token"}, "client_id": {"client-1"}, "refresh_token": {refreshToken}}
+		r := httptest.NewRequest(http.MethodPost, "/api/oauth/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serveTest(Token, r)
+	}
+
+	w := refresh(refreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Token() = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+	var rotated struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&rotated); err != nil || rotated.RefreshToken == "" {
+		t.Fatalf("invalid token response: %v", err)
+	}
+
+	// ローテーション前のトークンは使用済み
+	if _, err := s.GetTokenSession(ctx, refreshToken); err == nil {
+		t.Error("GetTokenSession() found the rotated refresh token")
+	}
+	if w := refresh(refreshToken); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_grant") {
+		t.Errorf("Token() with a rotated refresh token = %d %s, want invalid_grant", w.Code, w.Body)
+	}
+	if w := refresh(rotated.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("Token() with the new refresh token = %d %s, want %d", w.Code, w.Body, http.StatusOK)
+	}
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"backend/config"
+	"backend/model"
+	"backend/store"
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// UserInfo はアクセストークンに対応するユーザー情報を返すハンドラ関数
+// OpenID Connect Core 1.0 Section 5.3 に基づいて実装しています
+func UserInfo(w http.ResponseWriter, r *http.Request) {
+	log.Println("UserInfo")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Printf("Method not allowed: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := requireAccessToken(w, r)
+	if !ok {
+		return
+	}
+
+	// ペアワイズ識別子の場合は内部のユーザーIDに変換する
+	sub, _ := claims.GetSubject()
+	userID, err := resolveUserID(r.Context(), sub)
+	if err != nil {
+		log.Printf("Failed to resolve subject: %v", err)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	user, err := repos.Users.GetUserByID(r.Context(), userID)
+	if isStoreUnavailable(err) {
+		log.Printf("Failed to get user: %v", err)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err != nil {
+		// クライアントクレデンシャルで発行されたトークンなど、ユーザーに紐づかないトークン
+		log.Printf("User not found for access token: %v", err)
+		writeTokenAuthError(w, "Bearer", "invalid_token", "Access token is not associated with a user")
+		return
+	}
+
+	// 付与されたスコープと claims パラメータに応じたクレームを返す (OpenID Connect Core 1.0 Section 5.4, 5.5)
+	scope, _ := claims["scope"].(string)
+	requested, err := requestedUserInfoClaims(r.Context(), claims)
+	if err != nil {
+		log.Printf("Failed to get userinfo claims: %v", err)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	resp := releasedUserClaims(user, scope, requested)
+
+	// トークンの発行先クライアントのクレームマッピングを適用する
+	clientID, _ := claims["client_id"].(string)
+	client, err := repos.Clients.GetClient(r.Context(), clientID)
+	if isStoreUnavailable(err) {
+		log.Printf("Failed to get client: %v", err)
+		writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err == nil {
+		resp, err = applyClaimsMapping(client, model.ClaimsTargetUserInfo, user, model.AuthenticationContext{}, scope, resp)
+		if err != nil {
+			log.Printf("Failed to apply claims mapping: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	// sub はアクセストークンと同じくクライアント向けの値を返す
+	resp["sub"] = sub
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// requireAccessToken Authorization ヘッダーのアクセストークンを検証してクレームを返します
+// DPoPで束縛されたトークンの場合は DPoP スキームと、同じ鍵によるDPoP証明を必須とします (RFC 9449 Section 7)
+// クライアント証明書で束縛されたトークンの場合は、同じ証明書による接続を必須とします
+// 検証に失敗した場合はエラーレスポンスを書き込み、false を返します
+func requireAccessToken(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || token == "" || (!strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "DPoP")) {
+		log.Println("Missing access token")
+		writeTokenAuthError(w, "Bearer", "", "")
+		return nil, false
+	}
+
+	claims, err := utils.VerifyAccessToken(token)
+	if err != nil {
+		log.Printf("Invalid access token: %v", err)
+		writeTokenAuthError(w, scheme, "invalid_token", "Invalid access token")
+		return nil, false
+	}
+
+	// クライアント証明書で束縛されたトークンは同じ証明書での接続を必須とする (RFC 8705 Section 3)
+	if x5t := confirmationValue(claims, "x5t#S256"); x5t != "" {
+		chain, err := clientCertificateChain(r)
+		if err != nil || len(chain) == 0 || utils.CertificateThumbprint(chain[0]) != x5t {
+			log.Printf("Client certificate mismatch for access token: %v", err)
+			writeTokenAuthError(w, scheme, "invalid_token", "Access token is bound to a different client certificate")
+			return nil, false
+		}
+	}
+
+	jkt := confirmationValue(claims, "jkt")
+	if jkt == "" {
+		if !strings.EqualFold(scheme, "Bearer") {
+			log.Println("DPoP scheme used with unbound access token")
+			writeTokenAuthError(w, "DPoP", "invalid_token", "Access token is not DPoP-bound")
+			return nil, false
+		}
+		return claims, true
+	}
+
+	// DPoPで束縛されたトークンは Bearer として受け入れない (ダウングレード防止)
+	if !strings.EqualFold(scheme, "DPoP") {
+		log.Println("DPoP-bound access token presented as bearer token")
+		writeTokenAuthError(w, "DPoP", "invalid_token", "DPoP-bound access token requires DPoP scheme")
+		return nil, false
+	}
+
+	proof, err := validateDPoPProof(r, token, false)
+	if err != nil || proof == nil || proof.JKT != jkt {
+		log.Printf("Invalid DPoP proof for access token: %v", err)
+		if errors.Is(err, errUseDPoPNonce) {
+			w.Header().Set("DPoP-Nonce", utils.GenerateDPoPNonce(config.JWTSecret))
+			writeTokenAuthError(w, "DPoP", "use_dpop_nonce", "Resource server requires nonce in DPoP proof")
+			return nil, false
+		}
+		if isStoreUnavailable(err) {
+			writeStoreError(w, err, http.StatusInternalServerError, "Internal server error")
+			return nil, false
+		}
+		writeTokenAuthError(w, "DPoP", "invalid_dpop_proof", "Invalid DPoP proof")
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// saveUserInfoClaims claims パラメータで UserInfo に対して要求されたクレームをアクセストークンの有効期間だけ保存し、
+// アクセストークンの jti に使用するIDを返します (要求がない場合は保存せずに空文字列を返します)
+// 要求の内容はアクセストークンに含めず、UserInfoエンドポイントで jti から参照します
+func saveUserInfoClaims(ctx context.Context, requested map[string]*model.ClaimRequest, expiresIn int64) (string, error) {
+	if len(requested) == 0 {
+		return "", nil
+	}
+	tokenID, err := generateRequestID()
+	if err != nil {
+		return "", err
+	}
+	if err := repos.Tokens.SaveUserInfoClaims(ctx, tokenID, requested, time.Duration(expiresIn)*time.Second); err != nil {
+		return "", err
+	}
+	return tokenID, nil
+}
+
+// requestedUserInfoClaims アクセストークンに対して要求された UserInfo のクレームを取得します
+func requestedUserInfoClaims(ctx context.Context, claims jwt.MapClaims) (map[string]*model.ClaimRequest, error) {
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		return nil, nil
+	}
+	requested, err := repos.Tokens.GetUserInfoClaims(ctx, tokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return requested, err
+}
+
+// confirmationValue cnf クレームから指定したメンバーの値を取得します
+func confirmationValue(claims jwt.MapClaims, member string) string {
+	cnf, ok := claims["cnf"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := cnf[member].(string)
+	return value
+}
+
+// writeTokenAuthError 保護リソースでのアクセストークンのエラーを返します (RFC 6750 Section 3)
+func writeTokenAuthError(w http.ResponseWriter, scheme string, errorCode string, description string) {
+	challenge := "Bearer"
+	if strings.EqualFold(scheme, "DPoP") {
+		challenge = `DPoP algs="` + strings.Join(utils.DPoPSigningAlgorithms, " ") + `"`
+	}
+	if errorCode != "" {
+		if strings.HasPrefix(challenge, "DPoP") {
+			challenge += ","
+		}
+		challenge += ` error="` + errorCode + `", error_description="` + description + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
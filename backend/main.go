@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
 	"net/http"
 
@@ -12,24 +14,61 @@ import (
 )
 
 func main() {
-	if err := store.InitRedis(); err != nil {
-		log.Fatalf("Failed to initialize Redis: %v", err)
-	}
-
 	if err := config.Init(); err != nil {
 		log.Fatalf("Failed to initialize config: %v", err)
 	}
 
-	if err := utils.InitJWKS(); err != nil {
+	repos, err := store.Open()
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// 設定ファイルのクライアント定義をリポジトリに登録する
+	for _, client := range config.Clients {
+		if err := repos.Clients.SaveClient(ctx, client); err != nil {
+			log.Fatalf("Failed to save client: %v", err)
+		}
+	}
+
+	if err := utils.InitJWKS(ctx, repos.Keys); err != nil {
 		log.Fatalf("Failed to initialize JWKS: %v", err)
 	}
 
+	handler.Init(repos)
+
 	http.HandleFunc("/health", handler.Health)
 	http.HandleFunc("/api/oauth/authorize", middleware.Cors(handler.Authorize))
 	http.HandleFunc("/api/oauth/token", middleware.Cors(handler.Token))
+	http.HandleFunc("/api/oauth/par", middleware.Cors(handler.PushedAuthorizationRequest))
 	http.HandleFunc("/api/auth/login", middleware.Cors(handler.Authenticate))
+	http.HandleFunc("/api/user/profile", middleware.Cors(handler.UserProfile))
+	http.HandleFunc("/api/admin/user_roles", middleware.Cors(handler.UserRoles))
 	http.HandleFunc("/api/oauth/revoke", middleware.Cors(handler.RevokeToken))
+	http.HandleFunc("/api/oauth/introspect", middleware.Cors(handler.Introspect))
+	http.HandleFunc("/api/oauth/userinfo", middleware.Cors(handler.UserInfo))
+	http.HandleFunc("/api/oauth/device_authorization", middleware.Cors(handler.DeviceAuthorization))
+	http.HandleFunc("/api/oauth/device/verify", middleware.Cors(handler.DeviceVerification))
 	http.HandleFunc("/.well-known/jwks.json", handler.JWKS)
+	http.HandleFunc("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+
+	// TLS_CERT_FILE が設定されている場合はサーバー自身でTLSを終端し、mTLS のクライアント証明書を受け付ける
+	// 証明書の検証はクライアントごとの認証方式に応じてハンドラーで行う
+	if config.TLSCertFile != "" {
+		server := &http.Server{
+			Addr: ":8080",
+			TLSConfig: &tls.Config{
+				ClientAuth: tls.RequestClientCert,
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+		log.Println("Server starting on :8080 (TLS)")
+		if err := server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+		return
+	}
 
 	log.Println("Server starting on :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
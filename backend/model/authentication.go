@@ -1,9 +1,45 @@
 package model
 
 import (
+	"slices"
 	"time"
 )
 
+// 認証方式 (amr) の値 (RFC 8176)
+const (
+	AMRPassword    = "pwd"
+	AMRMultiFactor = "mfa"
+)
+
+// 認証コンテキストクラス (acr) の値
+const (
+	// 単一要素での認証
+	ACRSingleFactor = "urn:sso-demo:acr:sfa"
+	// 多要素での認証
+	ACRMultiFactor = "urn:sso-demo:acr:mfa"
+)
+
+// AuthenticationContext ユーザーがIdPで認証した時刻と方式
+// 認可コードやリフレッシュトークンに引き継ぎ、IDトークンの auth_time / amr / acr として発行する
+type AuthenticationContext struct {
+	AuthTime time.Time `json:"auth_time"`
+	AMR      []string  `json:"amr,omitempty"`
+	ACR      string    `json:"acr,omitempty"`
+}
+
+// NewAuthenticationContext 使用した認証方式から認証コンテキストを作成します
+func NewAuthenticationContext(authTime time.Time, amr ...string) AuthenticationContext {
+	acr := ACRSingleFactor
+	if slices.Contains(amr, AMRMultiFactor) || len(amr) > 1 {
+		acr = ACRMultiFactor
+	}
+	return AuthenticationContext{
+		AuthTime: authTime,
+		AMR:      amr,
+		ACR:      acr,
+	}
+}
+
 // AuthSession IdP認証セッション
 type AuthSession struct {
 	SessionID  string    `json:"session_id"`
@@ -12,6 +48,9 @@ type AuthSession struct {
 	CreatedAt  time.Time `json:"created_at"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	IsLoggedIn bool      `json:"is_logged_in"`
+	// 最後に使用した時刻。アイドル期間の有効期限の計算に使用する
+	LastActiveAt time.Time `json:"last_active_at"`
+	AuthenticationContext
 }
 
 // LoginRequest ログインリクエスト
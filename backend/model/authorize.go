@@ -4,16 +4,44 @@ import "time"
 
 type AuthorizeResponse struct {
 	AuthorizationCode string `json:"authorization_code"`
+	RedirectURI       string `json:"redirect_uri"`
+	State             string `json:"state,omitempty"`
+}
+
+// AuthorizationRequest 検証済みの認可リクエストパラメータ
+type AuthorizationRequest struct {
+	ClientID     string `json:"client_id"`
+	ResponseType string `json:"response_type"`
+	RedirectURI  string `json:"redirect_uri"`
+	Scope        string `json:"scope"`
+	State        string `json:"state,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	// claims リクエストパラメータ (OpenID Connect Core 1.0 Section 5.5)
+	Claims              *ClaimsRequest `json:"claims,omitempty"`
+	CodeChallenge       string         `json:"code_challenge"`
+	CodeChallengeMethod string         `json:"code_challenge_method"`
+	Resources           []string       `json:"resources,omitempty"`
+}
+
+// PushedAuthorizationResponse PARエンドポイントのレスポンス (RFC 9126 Section 2.2)
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
 }
 
 type AuthorizeSession struct {
-	AuthorizationCode   string    `json:"authorization_code"`
-	UserID              string    `json:"user_id"`
-	Email               string    `json:"email"`
-	ClientID            string    `json:"client_id"`
-	CodeChallenge       string    `json:"code_challenge"`
-	CodeChallengeMethod string    `json:"code_challenge_method"`
-	Scope               string    `json:"scope"`
-	RedirectURI         string    `json:"redirect_uri"`
-	CreatedAt           time.Time `json:"created_at"`
+	AuthorizationCode   string         `json:"authorization_code"`
+	UserID              string         `json:"user_id"`
+	Email               string         `json:"email"`
+	ClientID            string         `json:"client_id"`
+	CodeChallenge       string         `json:"code_challenge"`
+	CodeChallengeMethod string         `json:"code_challenge_method"`
+	Scope               string         `json:"scope"`
+	RedirectURI         string         `json:"redirect_uri"`
+	Resources           []string       `json:"resources,omitempty"`
+	Nonce               string         `json:"nonce,omitempty"`
+	Claims              *ClaimsRequest `json:"claims,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+	// 認可時点のユーザーの認証情報
+	AuthenticationContext
 }
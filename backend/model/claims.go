@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// ClaimsRequest claims リクエストパラメータ (OpenID Connect Core 1.0 Section 5.5)
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// IDTokenClaims IDトークンに対して要求されたクレームを返します
+func (c *ClaimsRequest) IDTokenClaims() map[string]*ClaimRequest {
+	if c == nil {
+		return nil
+	}
+	return c.IDToken
+}
+
+// UserInfoClaims UserInfoエンドポイントに対して要求されたクレームを返します
+func (c *ClaimsRequest) UserInfoClaims() map[string]*ClaimRequest {
+	if c == nil {
+		return nil
+	}
+	return c.UserInfo
+}
+
+// ClaimRequest 個別のクレームの要求内容
+// null の場合 (nil) はデフォルトの方法で要求されたことを表します
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// IsEssential 必須のクレームとして要求されているかを返します
+func (r *ClaimRequest) IsEssential() bool {
+	return r != nil && r.Essential
+}
+
+// Accepts クレームの値が value / values の指定を満たすかを返します
+// value / values が指定されていない場合は常に true を返します
+func (r *ClaimRequest) Accepts(value interface{}) bool {
+	if r == nil || (r.Value == nil && len(r.Values) == 0) {
+		return true
+	}
+
+	// 型の違い (数値の表現など) を吸収するため、JSON表現で比較する
+	actual, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	candidates := r.Values
+	if r.Value != nil {
+		candidates = append(slices.Clone(candidates), r.Value)
+	}
+	for _, candidate := range candidates {
+		expected, err := json.Marshal(candidate)
+		if err == nil && string(expected) == string(actual) {
+			return true
+		}
+	}
+	return false
+}
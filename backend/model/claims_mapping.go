@@ -0,0 +1,35 @@
+package model
+
+// クレームマッピングの対象トークン
+const (
+	ClaimsTargetIDToken     = "id_token"
+	ClaimsTargetAccessToken = "access_token"
+	ClaimsTargetUserInfo    = "userinfo"
+)
+
+// クレームマッピングの操作
+const (
+	// expression の評価結果を claim に設定する (結果が null の場合は claim を削除する)
+	ClaimsMappingSet = "set"
+	// from のクレームを claim に名前を変更する
+	ClaimsMappingRename = "rename"
+	// claim を削除する
+	ClaimsMappingDrop = "drop"
+)
+
+// ClaimMapping クライアントごとのクレームマッピング規則
+// 式は CEL で記述し、user / session / client / scopes / claims / token 変数を参照できる
+type ClaimMapping struct {
+	// 操作 (set, rename, drop)。省略時は set
+	Action string `json:"action,omitempty"`
+	// 対象のクレーム名
+	Claim string `json:"claim"`
+	// set の場合に評価するCEL式
+	Expression string `json:"expression,omitempty"`
+	// rename の場合の元のクレーム名
+	From string `json:"from,omitempty"`
+	// 適用条件 (bool を返すCEL式)。省略時は常に適用する
+	Condition string `json:"condition,omitempty"`
+	// 適用するトークン (id_token, access_token, userinfo)。省略時はすべて
+	Targets []string `json:"targets,omitempty"`
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+)
+
+// Client OAuthクライアント情報
+type Client struct {
+	ClientID string `json:"client_id"`
+	// クライアントシークレットのSHA-256ハッシュ (16進数)。パブリッククライアントの場合は空
+	ClientSecretHash string `json:"client_secret_hash,omitempty"`
+	// トークンエンドポイントでのクライアント認証方式
+	// (none, client_secret_basic, client_secret_post, tls_client_auth, self_signed_tls_client_auth)
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	// 登録済みのリダイレクトURI。認可リクエストの redirect_uri はこの一覧と完全一致で照合する
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	// クライアントに許可されたスコープ (client_credentials グラントで発行可能なスコープ)
+	AllowedScopes []string `json:"allowed_scopes,omitempty"`
+	// リクエストオブジェクトの署名検証に使用するクライアントの公開鍵 (JWKS)
+	JWKS    json.RawMessage `json:"jwks,omitempty"`
+	JWKSURI string          `json:"jwks_uri,omitempty"`
+	// 参照渡しで取得を許可する request_uri (https) の一覧
+	RequestURIs []string `json:"request_uris,omitempty"`
+	// PKCE で plain 方式のコードチャレンジを許可するか (デフォルトは S256 のみ)
+	AllowPlainPKCE bool `json:"allow_plain_pkce,omitempty"`
+	// PKCE の省略を許可するか。コンフィデンシャルクライアントのみ設定できる
+	PKCEOptional bool `json:"pkce_optional,omitempty"`
+	// 認可リクエストに署名付きリクエストオブジェクト (RFC 9101) を必須とするか
+	RequireSignedRequestObject bool `json:"require_signed_request_object,omitempty"`
+	// 認可リクエストにPAR (RFC 9126) の利用を必須とするか
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	// アクセストークンを常にDPoP (RFC 9449) で送信者制約するか
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+	// トークンエンドポイントでサーバー発行の DPoP nonce を必須とするか
+	DPoPNonceRequired bool `json:"dpop_nonce_required,omitempty"`
+	// tls_client_auth で受け入れる証明書の識別情報 (RFC 8705 Section 2.1.2)。いずれか1つを指定する
+	// サブジェクトDNは RFC 4514 形式 (例: CN=partner-a,O=Example Corp) で比較する
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSClientAuthSANDNS    string `json:"tls_client_auth_san_dns,omitempty"`
+	TLSClientAuthSANURI    string `json:"tls_client_auth_san_uri,omitempty"`
+	TLSClientAuthSANIP     string `json:"tls_client_auth_san_ip,omitempty"`
+	TLSClientAuthSANEmail  string `json:"tls_client_auth_san_email,omitempty"`
+	// アクセストークンをクライアント証明書で送信者制約するか (RFC 8705 Section 3)
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// sub の種類 (public または pairwise)。省略時は public
+	SubjectType string `json:"subject_type,omitempty"`
+	// pairwise の場合のセクター識別子URI。クライアントが使用するリダイレクトURIのJSON配列を返す (https)
+	SectorIdentifierURI string `json:"sector_identifier_uri,omitempty"`
+	// セクター識別子URIから取得したリダイレクトURI (起動時に読み込む)
+	SectorRedirectURIs []string `json:"-"`
+	// アクセストークンの groups / roles クレームに含めるグループとロール
+	// path.Match 形式のパターン (例: store-1:*) で指定し、一致しないものはクライアントに公開しない
+	AllowedGroups []string `json:"allowed_groups,omitempty"`
+	AllowedRoles  []string `json:"allowed_roles,omitempty"`
+	// IDトークン・アクセストークン・UserInfo のクレームマッピング規則 (CEL式)
+	ClaimsMapping []ClaimMapping `json:"claims_mapping,omitempty"`
+	// トークン交換 (RFC 8693) のポリシー。未設定の場合はトークン交換を許可しない
+	TokenExchange *TokenExchangePolicy `json:"token_exchange,omitempty"`
+	// トークンとセッションの有効期間。未設定の項目はサーバーの既定値を使用する
+	Lifetimes *LifetimePolicy `json:"lifetimes,omitempty"`
+	// グラントタイプごとの有効期間 (例: {"client_credentials": {"access_token_ttl": 300}})。未設定の項目は lifetimes を使用する
+	GrantLifetimes map[string]*LifetimePolicy `json:"grant_lifetimes,omitempty"`
+}
+
+// TokenExchangePolicy クライアントごとのトークン交換ポリシー
+type TokenExchangePolicy struct {
+	// 交換後のトークンに指定できる audience (リソース識別子または論理名)
+	AllowedAudiences []string `json:"allowed_audiences"`
+	// 受け入れる subject_token の audience。省略時はクライアントID宛てのトークンのみ受け入れる
+	SubjectAudiences []string `json:"subject_audiences,omitempty"`
+	// なりすまし (act クレームなし) を許可するか
+	Impersonation bool `json:"impersonation"`
+	// 委任 (act クレームあり) を許可するか
+	Delegation bool `json:"delegation"`
+}
+
+// IsConfidential コンフィデンシャルクライアントかどうかを返します
+func (c *Client) IsConfidential() bool {
+	return c.TokenEndpointAuthMethod != "" && c.TokenEndpointAuthMethod != "none"
+}
+
+// UsesClientSecret クライアントシークレットで認証するクライアントかどうかを返します
+func (c *Client) UsesClientSecret() bool {
+	return c.TokenEndpointAuthMethod == "client_secret_basic" || c.TokenEndpointAuthMethod == "client_secret_post"
+}
+
+// UsesTLSClientAuth クライアント証明書 (RFC 8705) で認証するクライアントかどうかを返します
+func (c *Client) UsesTLSClientAuth() bool {
+	return c.TokenEndpointAuthMethod == "tls_client_auth" || c.TokenEndpointAuthMethod == "self_signed_tls_client_auth"
+}
+
+// IsPairwise ペアワイズ識別子を使用するクライアントかどうかを返します
+func (c *Client) IsPairwise() bool {
+	return c.SubjectType == "pairwise"
+}
+
+// SectorIdentifier ペアワイズ識別子の計算に使用するセクター (セクター識別子URIのホスト) を返します
+func (c *Client) SectorIdentifier() string {
+	u, err := url.Parse(c.SectorIdentifierURI)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// AllowsGrantType 指定されたグラントタイプの利用が許可されているかを返します
+func (c *Client) AllowsGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// LifetimesFor グラントタイプで発行するトークンの有効期間を、サーバーの既定値にクライアントとグラントタイプの設定を重ねて返します
+func (c *Client) LifetimesFor(defaults LifetimePolicy, grantType string) LifetimePolicy {
+	return defaults.Override(c.Lifetimes).Override(c.GrantLifetimes[grantType])
+}
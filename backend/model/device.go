@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// デバイス認可セッションの状態
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorizationResponse デバイス認可レスポンス (RFC 8628 Section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceSession デバイス認可セッション
+type DeviceSession struct {
+	DeviceCode string    `json:"device_code"`
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	Scope      string    `json:"scope"`
+	Resources  []string  `json:"resources,omitempty"`
+	Status     string    `json:"status"`
+	UserID     string    `json:"user_id,omitempty"` // 承認したユーザーのID
+	Email      string    `json:"email,omitempty"`
+	Interval   int       `json:"interval"` // ポーリング間隔 (秒)
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// 承認したユーザーの認証情報
+	AuthenticationContext
+}
+
+// DeviceVerificationRequest ユーザーコードの承認・拒否リクエスト
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+// DeviceVerificationResponse ユーザーコードに紐づく認可要求の内容
+type DeviceVerificationResponse struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	Status   string `json:"status"`
+}
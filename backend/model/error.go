@@ -0,0 +1,7 @@
+package model
+
+// ErrorResponse OAuth 2.0 のエラーレスポンス (RFC 6749 Section 5.2)
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
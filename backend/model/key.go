@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// 鍵の用途
+const (
+	KeyUseSignature  = "sig"
+	KeyUseEncryption = "enc"
+)
+
+// Key サーバーの鍵 (トークンの署名、リクエストオブジェクトの復号に使用する)
+// 複数のインスタンスで同じ鍵を使用するため、リポジトリに保存して共有する
+type Key struct {
+	KeyID string `json:"kid"`
+	// 用途 (sig または enc)
+	Use string `json:"use"`
+	// PKCS#8 形式の秘密鍵 (DER)
+	PrivateKey []byte    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
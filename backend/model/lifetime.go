@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+// LifetimePolicy トークンとセッションの有効期間 (秒)
+// 0 の項目は上位の設定 (グラントごと → クライアントごと → サーバーの既定値の順) を使用します
+type LifetimePolicy struct {
+	AccessTokenTTL int64 `json:"access_token_ttl,omitempty"`
+	IDTokenTTL     int64 `json:"id_token_ttl,omitempty"`
+	// リフレッシュトークンを使用しないまま経過できる期間 (ローテーションのたびに延長する)
+	RefreshTokenIdleTTL int64 `json:"refresh_token_idle_ttl,omitempty"`
+	// 最初の発行 (認可コードやデバイスコードとの交換) からの期間。ローテーションしても延長しない
+	RefreshTokenAbsoluteTTL int64 `json:"refresh_token_absolute_ttl,omitempty"`
+	// IdPの認証セッションを使用しないまま経過できる期間
+	SessionIdleTTL int64 `json:"session_idle_ttl,omitempty"`
+	// ログインからの期間
+	SessionAbsoluteTTL int64 `json:"session_absolute_ttl,omitempty"`
+}
+
+// Override 0 以外の項目を override の値で置き換えたポリシーを返します
+func (p LifetimePolicy) Override(override *LifetimePolicy) LifetimePolicy {
+	if override == nil {
+		return p
+	}
+	for _, field := range []struct{ dst, src *int64 }{
+		{&p.AccessTokenTTL, &override.AccessTokenTTL},
+		{&p.IDTokenTTL, &override.IDTokenTTL},
+		{&p.RefreshTokenIdleTTL, &override.RefreshTokenIdleTTL},
+		{&p.RefreshTokenAbsoluteTTL, &override.RefreshTokenAbsoluteTTL},
+		{&p.SessionIdleTTL, &override.SessionIdleTTL},
+		{&p.SessionAbsoluteTTL, &override.SessionAbsoluteTTL},
+	} {
+		if *field.src != 0 {
+			*field.dst = *field.src
+		}
+	}
+	return p
+}
+
+// RefreshTokenExpiry リフレッシュトークンの有効期限を返します
+// absoluteExpiresAt は最初の発行時の絶対的な有効期限で、ゼロ値の場合は issuedAt から計算します
+func (p LifetimePolicy) RefreshTokenExpiry(issuedAt time.Time, absoluteExpiresAt time.Time) (expiresAt time.Time, absolute time.Time) {
+	if absoluteExpiresAt.IsZero() {
+		absoluteExpiresAt = issuedAt.Add(seconds(p.RefreshTokenAbsoluteTTL))
+	}
+	return earliest(issuedAt.Add(seconds(p.RefreshTokenIdleTTL)), absoluteExpiresAt), absoluteExpiresAt
+}
+
+// SessionExpiry 認証セッションの有効期限を返します (最後に使用した時刻から SessionIdleTTL、ログインから SessionAbsoluteTTL の早い方)
+func (p LifetimePolicy) SessionExpiry(createdAt time.Time, lastActiveAt time.Time) time.Time {
+	return earliest(lastActiveAt.Add(seconds(p.SessionIdleTTL)), createdAt.Add(seconds(p.SessionAbsoluteTTL)))
+}
+
+func seconds(ttl int64) time.Duration {
+	return time.Duration(ttl) * time.Second
+}
+
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
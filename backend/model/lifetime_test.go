@@ -0,0 +1,116 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifetimePolicyRefreshTokenExpiry(t *testing.T) {
+	issuedAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	day := int64(24 * 60 * 60)
+
+	tests := []struct {
+		name         string
+		policy       LifetimePolicy
+		issuedAt     time.Time
+		absolute     time.Time
+		wantExpires  time.Time
+		wantAbsolute time.Time
+	}{
+		{
+			name:         "first issue uses idle ttl",
+			policy:       LifetimePolicy{RefreshTokenIdleTTL: 7 * day, RefreshTokenAbsoluteTTL: 30 * day},
+			issuedAt:     issuedAt,
+			wantExpires:  issuedAt.AddDate(0, 0, 7),
+			wantAbsolute: issuedAt.AddDate(0, 0, 30),
+		},
+		{
+			name:         "first issue capped by absolute ttl",
+			policy:       LifetimePolicy{RefreshTokenIdleTTL: 30 * day, RefreshTokenAbsoluteTTL: 7 * day},
+			issuedAt:     issuedAt,
+			wantExpires:  issuedAt.AddDate(0, 0, 7),
+			wantAbsolute: issuedAt.AddDate(0, 0, 7),
+		},
+		{
+			name:         "rotation extends idle expiry",
+			policy:       LifetimePolicy{RefreshTokenIdleTTL: 7 * day, RefreshTokenAbsoluteTTL: 30 * day},
+			issuedAt:     issuedAt.AddDate(0, 0, 10),
+			absolute:     issuedAt.AddDate(0, 0, 30),
+			wantExpires:  issuedAt.AddDate(0, 0, 17),
+			wantAbsolute: issuedAt.AddDate(0, 0, 30),
+		},
+		{
+			name:         "rotation does not extend absolute expiry",
+			policy:       LifetimePolicy{RefreshTokenIdleTTL: 7 * day, RefreshTokenAbsoluteTTL: 30 * day},
+			issuedAt:     issuedAt.AddDate(0, 0, 27),
+			absolute:     issuedAt.AddDate(0, 0, 30),
+			wantExpires:  issuedAt.AddDate(0, 0, 30),
+			wantAbsolute: issuedAt.AddDate(0, 0, 30),
+		},
+		{
+			name:         "absolute ttl change does not affect issued tokens",
+			policy:       LifetimePolicy{RefreshTokenIdleTTL: 7 * day, RefreshTokenAbsoluteTTL: 90 * day},
+			issuedAt:     issuedAt.AddDate(0, 0, 27),
+			absolute:     issuedAt.AddDate(0, 0, 30),
+			wantExpires:  issuedAt.AddDate(0, 0, 30),
+			wantAbsolute: issuedAt.AddDate(0, 0, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expires, absolute := tt.policy.RefreshTokenExpiry(tt.issuedAt, tt.absolute)
+			if !expires.Equal(tt.wantExpires) {
+				t.Errorf("expiresAt = %s, want %s", expires, tt.wantExpires)
+			}
+			if !absolute.Equal(tt.wantAbsolute) {
+				t.Errorf("absolute = %s, want %s", absolute, tt.wantAbsolute)
+			}
+		})
+	}
+}
+
+func TestLifetimePolicySessionExpiry(t *testing.T) {
+	createdAt := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	policy := LifetimePolicy{SessionIdleTTL: 60 * 60, SessionAbsoluteTTL: 8 * 60 * 60}
+
+	tests := []struct {
+		name         string
+		lastActiveAt time.Time
+		want         time.Time
+	}{
+		{name: "idle", lastActiveAt: createdAt.Add(time.Hour), want: createdAt.Add(2 * time.Hour)},
+		{name: "capped by absolute", lastActiveAt: createdAt.Add(7*time.Hour + 30*time.Minute), want: createdAt.Add(8 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.SessionExpiry(createdAt, tt.lastActiveAt); !got.Equal(tt.want) {
+				t.Errorf("SessionExpiry() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifetimePolicyOverride(t *testing.T) {
+	base := LifetimePolicy{AccessTokenTTL: 900, IDTokenTTL: 3600, RefreshTokenIdleTTL: 86400, RefreshTokenAbsoluteTTL: 2592000}
+
+	tests := []struct {
+		name     string
+		override *LifetimePolicy
+		want     LifetimePolicy
+	}{
+		{name: "nil", override: nil, want: base},
+		{name: "empty", override: &LifetimePolicy{}, want: base},
+		{
+			name:     "partial",
+			override: &LifetimePolicy{AccessTokenTTL: 300, RefreshTokenAbsoluteTTL: 604800},
+			want:     LifetimePolicy{AccessTokenTTL: 300, IDTokenTTL: 3600, RefreshTokenIdleTTL: 86400, RefreshTokenAbsoluteTTL: 604800},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.Override(tt.override); got != tt.want {
+				t.Errorf("Override() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package model
+
+// Resource 保護対象のAPIリソース (RFC 8707)
+type Resource struct {
+	// リソース識別子 (アクセストークンの aud に設定される絶対URI)
+	Identifier string   `json:"identifier"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+}
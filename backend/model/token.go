@@ -3,19 +3,51 @@ package model
 import "time"
 
 type TokenResponse struct {
-	IDToken      string `json:"id_token"`
+	IDToken      string `json:"id_token,omitempty"`
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	// トークン交換 (RFC 8693) で発行したトークンの種類
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
 // TokenSession はトークン情報を長期的に保存するためのモデル
+// リフレッシュトークンそのものは保存せず、保存先ではトークンのダイジェストをキーにします
 type TokenSession struct {
-	UserID       string    `json:"user_id"`
-	ClientID     string    `json:"client_id"`
-	RefreshToken string    `json:"refresh_token"`
-	CreatedAt    time.Time `json:"created_at"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	IsRevoked    bool      `json:"is_revoked"`
+	UserID    string   `json:"user_id"`
+	ClientID  string   `json:"client_id"`
+	Scope     string   `json:"scope"`
+	Resources []string `json:"resources,omitempty"`
+	// 認可リクエストの claims パラメータ。リフレッシュ時のIDトークンとアクセストークンにも引き継ぐ
+	Claims *ClaimsRequest `json:"claims,omitempty"`
+	// DPoPで束縛されている場合の公開鍵の Thumbprint
+	DPoPJKT string `json:"dpop_jkt,omitempty"`
+	// クライアント証明書で束縛されている場合の証明書の Thumbprint (x5t#S256)
+	CertificateThumbprint string    `json:"x5t_s256,omitempty"`
+	CreatedAt             time.Time `json:"created_at"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	IsRevoked             bool      `json:"is_revoked"`
+	// ローテーションしても延長しない絶対的な有効期限 (最初の発行時に決定する)
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	// 元の認証の情報。リフレッシュ時のIDトークンにも引き継ぐ
+	AuthenticationContext
+}
+
+// IntrospectionResponse トークンイントロスペクションのレスポンス (RFC 7662 Section 2.2)
+type IntrospectionResponse struct {
+	Active    bool                   `json:"active"`
+	Scope     string                 `json:"scope,omitempty"`
+	ClientID  string                 `json:"client_id,omitempty"`
+	TokenType string                 `json:"token_type,omitempty"`
+	Exp       int64                  `json:"exp,omitempty"`
+	Iat       int64                  `json:"iat,omitempty"`
+	Sub       string                 `json:"sub,omitempty"`
+	Aud       interface{}            `json:"aud,omitempty"`
+	Iss       string                 `json:"iss,omitempty"`
+	Cnf       map[string]interface{} `json:"cnf,omitempty"`
+	Act       map[string]interface{} `json:"act,omitempty"`
+	Groups    []string               `json:"groups,omitempty"`
+	Roles     []string               `json:"roles,omitempty"`
 }
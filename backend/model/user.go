@@ -7,4 +7,65 @@ type User struct {
 	ID        string    `json:"id"`
 	Email     string    `json:"email"`
 	CreatedAt time.Time `json:"created_at"`
+	// OpenID Connect の標準クレームに対応するプロフィール情報
+	UserProfile
+	// 電話番号の確認済みフラグ (確認の仕組みを導入するまでは常に false)
+	PhoneNumberVerified bool      `json:"phone_number_verified"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	// 会員ランクなどの店舗向けの属性 (ユーザー自身は編集できない)
+	// クレームマッピングの式から user.attributes として参照できる
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// 所属グループとロール (ロール割り当てAPIで管理する)
+	// アクセストークンにはクライアントごとに許可されたものだけを含める
+	Groups []string `json:"groups,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+// UserProfile ユーザー自身が編集できるプロフィール情報 (OpenID Connect Core 1.0 Section 5.1)
+type UserProfile struct {
+	Name        string   `json:"name,omitempty"`
+	GivenName   string   `json:"given_name,omitempty"`
+	FamilyName  string   `json:"family_name,omitempty"`
+	Picture     string   `json:"picture,omitempty"`
+	Locale      string   `json:"locale,omitempty"`
+	Zoneinfo    string   `json:"zoneinfo,omitempty"`
+	PhoneNumber string   `json:"phone_number,omitempty"`
+	Address     *Address `json:"address,omitempty"`
+}
+
+// Address 住所 (OpenID Connect Core 1.0 Section 5.1.1)
+type Address struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"street_address,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postal_code,omitempty"`
+	Country       string `json:"country,omitempty"`
+}
+
+// UserProfileResponse プロフィール取得・更新エンドポイントのレスポンス
+type UserProfileResponse struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	UserProfile
+	PhoneNumberVerified bool      `json:"phone_number_verified"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// UserRolesRequest ロール割り当てAPIのリクエスト
+// 対象のユーザーは user_id または email で指定し、グループとロールは送信された内容に置き換える
+type UserRolesRequest struct {
+	UserID string   `json:"user_id,omitempty"`
+	Email  string   `json:"email,omitempty"`
+	Groups []string `json:"groups"`
+	Roles  []string `json:"roles"`
+}
+
+// UserRolesResponse ロール割り当てAPIのレスポンス
+type UserRolesResponse struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Groups    []string  `json:"groups"`
+	Roles     []string  `json:"roles"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
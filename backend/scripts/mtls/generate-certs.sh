@@ -0,0 +1,47 @@
+#!/bin/sh
+# mTLS クライアント認証 (RFC 8705) をローカルで検証するための証明書を生成します
+#
+#   ./scripts/mtls/generate-certs.sh [出力先ディレクトリ (デフォルト: ./certs)]
+#
+# 生成されるファイル:
+#   ca.pem / ca-key.pem                  ローカルCA (MTLS_CA_FILE に指定)
+#   server.pem / server-key.pem          localhost 用のサーバー証明書 (TLS_CERT_FILE / TLS_KEY_FILE に指定)
+#   client.pem / client-key.pem          ローカルCAが発行したクライアント証明書 (tls_client_auth 用)
+#   self-signed.pem / self-signed-key.pem 自己署名のクライアント証明書 (self_signed_tls_client_auth 用)
+set -eu
+
+OUT_DIR="${1:-./certs}"
+CLIENT_CN="${CLIENT_CN:-partner-a}"
+DAYS="${DAYS:-30}"
+
+mkdir -p "$OUT_DIR"
+cd "$OUT_DIR"
+
+# ローカルCA
+openssl req -x509 -newkey rsa:2048 -nodes -days "$DAYS" \
+  -keyout ca-key.pem -out ca.pem \
+  -subj "/O=SSO Demo Local CA/CN=SSO Demo Local CA" \
+  -addext "basicConstraints=critical,CA:TRUE" \
+  -addext "keyUsage=critical,keyCertSign,cRLSign"
+
+# サーバー証明書
+openssl req -newkey rsa:2048 -nodes -keyout server-key.pem -out server.csr -subj "/CN=localhost"
+printf "subjectAltName=DNS:localhost,IP:127.0.0.1\nextendedKeyUsage=serverAuth\n" > server.ext
+openssl x509 -req -in server.csr -CA ca.pem -CAkey ca-key.pem -CAcreateserial \
+  -days "$DAYS" -out server.pem -extfile server.ext
+
+# クライアント証明書 (tls_client_auth)
+openssl req -newkey rsa:2048 -nodes -keyout client-key.pem -out client.csr -subj "/O=Example Corp/CN=$CLIENT_CN"
+printf "subjectAltName=DNS:%s.example.com\nextendedKeyUsage=clientAuth\n" "$CLIENT_CN" > client.ext
+openssl x509 -req -in client.csr -CA ca.pem -CAkey ca-key.pem -CAcreateserial \
+  -days "$DAYS" -out client.pem -extfile client.ext
+
+# 自己署名のクライアント証明書 (self_signed_tls_client_auth)
+# 公開鍵はクライアント定義の jwks に登録する
+openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days "$DAYS" \
+  -keyout self-signed-key.pem -out self-signed.pem -subj "/CN=$CLIENT_CN-self-signed"
+
+rm -f server.csr server.ext client.csr client.ext ca.srl
+
+echo "Generated certificates in $OUT_DIR"
+echo "tls_client_auth_subject_dn: $(openssl x509 -in client.pem -noout -subject -nameopt RFC2253 | sed 's/^subject=//')"
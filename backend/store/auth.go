@@ -2,25 +2,28 @@ package store
 
 import (
 	"backend/model"
-	"fmt"
-	"time"
+	"context"
 )
 
 // SaveAuthSession 認証セッションを保存
-func SaveAuthSession(sessionID string, session model.AuthSession) error {
-	// 認証セッションは10分間有効
-	return SaveSession("auth_session", sessionID, session, 24*time.Hour)
+// 有効期限はセッションの ExpiresAt に合わせるため、延長する場合も同じ関数で保存し直します
+func (s *RedisStore) SaveAuthSession(ctx context.Context, sessionID string, session model.AuthSession) error {
+	ttl, err := expirationOf(session.ExpiresAt, "auth session")
+	if err != nil {
+		return err
+	}
+	return SaveSession(ctx, "auth_session", secretID(sessionID), session, ttl)
 }
 
 // GetAuthSession 認証セッションを取得
-func GetAuthSession(sessionID string) (*model.AuthSession, error) {
+func (s *RedisStore) GetAuthSession(ctx context.Context, sessionID string) (*model.AuthSession, error) {
 	if len(sessionID) != 64 {
-		return nil, fmt.Errorf("invalid session id format")
+		return nil, notFound("invalid session id format")
 	}
-	return GetSession[model.AuthSession]("auth_session", sessionID)
+	return getSecretRecord[model.AuthSession](ctx, "auth_session", sessionID)
 }
 
 // DeleteAuthSession 認証セッションを削除
-func DeleteAuthSession(sessionID string) error {
-	return DeleteSession("auth_session", sessionID)
+func (s *RedisStore) DeleteAuthSession(ctx context.Context, sessionID string) error {
+	return deleteSecretRecord(ctx, "auth_session", sessionID)
 }
@@ -2,24 +2,28 @@ package store
 
 import (
 	"backend/model"
-	"fmt"
+	"context"
 	"time"
 )
 
+// authorizationCodeExpiration 認可コードの有効期間
+// 認可コードはすぐに交換されるため、クライアントごとには設定しない (RFC 6749 Section 4.1.2 では最長10分を推奨)
+const authorizationCodeExpiration = 5 * time.Minute
+
 // AuthorizeSessionの保存・取得用ラッパー関数
-func SaveAuthorizeSession(sessionID string, session model.AuthorizeSession) error {
-	return SaveSession("authorize_session", sessionID, session, 5*time.Minute)
+func (s *RedisStore) SaveAuthorizeSession(ctx context.Context, sessionID string, session model.AuthorizeSession) error {
+	return SaveSession(ctx, "authorize_session", secretID(sessionID), session, authorizationCodeExpiration)
 }
 
 // AuthorizeSessionの取得用ラッパー関数
-func GetAuthorizeSession(sessionID string) (*model.AuthorizeSession, error) {
+func (s *RedisStore) GetAuthorizeSession(ctx context.Context, sessionID string) (*model.AuthorizeSession, error) {
 	if len(sessionID) != 64 {
-		return nil, fmt.Errorf("invalid session id format")
+		return nil, notFound("invalid session id format")
 	}
-	return GetSession[model.AuthorizeSession]("authorize_session", sessionID)
+	return getSecretRecord[model.AuthorizeSession](ctx, "authorize_session", sessionID)
 }
 
 // AuthorizeSessionの削除用ラッパー関数
-func DeleteAuthorizeSession(sessionID string) error {
-	return DeleteSession("authorize_session", sessionID)
+func (s *RedisStore) DeleteAuthorizeSession(ctx context.Context, sessionID string) error {
+	return deleteSecretRecord(ctx, "authorize_session", sessionID)
 }
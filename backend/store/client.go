@@ -0,0 +1,104 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// storedClient 保存用のクライアント情報
+// セクター識別子URIから取得したリダイレクトURIはクライアント定義のJSONに含まれないため、別の項目として保存する
+type storedClient struct {
+	model.Client
+	SectorRedirectURIs []string `json:"sector_redirect_uris,omitempty"`
+}
+
+func newStoredClient(client model.Client) storedClient {
+	return storedClient{Client: client, SectorRedirectURIs: client.SectorRedirectURIs}
+}
+
+func (c storedClient) client() model.Client {
+	client := c.Client
+	client.SectorRedirectURIs = c.SectorRedirectURIs
+	return client
+}
+
+func marshalClient(client model.Client) ([]byte, error) {
+	return json.Marshal(newStoredClient(client))
+}
+
+// clientListKey 登録済みのクライアントIDの一覧 (SET) のキー
+const clientListKey = "clients"
+
+// clientKeyID クライアント情報のキーに使用するIDを返します
+// Cluster モードではクライアント一覧と同じハッシュタグ ({clients}) を付け、一覧と同じスロットに配置します
+// (ハッシュタグのないキーはキー全体でスロットが決まるため、clients と {clients} は同じスロットになります)
+func clientKeyID(clientID string) string {
+	return ownedID(clientListKey, clientID)
+}
+
+func unmarshalClient(data []byte) (*model.Client, error) {
+	var stored storedClient
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	client := stored.client()
+	return &client, nil
+}
+
+// クライアントIDから登録済みのクライアントを取得する
+func (s *RedisStore) GetClient(ctx context.Context, clientID string) (*model.Client, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	data, err := redisReadClient.Get(ctx, redisKey("client", clientKeyID(clientID))).Bytes()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	stored, err := unmarshalRecord[storedClient](ctx, "client", clientID, data)
+	if err != nil {
+		return nil, err
+	}
+	client := stored.client()
+	return &client, nil
+}
+
+// 登録済みのクライアントをすべて取得する
+func (s *RedisStore) ListClients(ctx context.Context) ([]model.Client, error) {
+	membersCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	clientIDs, err := redisReadClient.SMembers(membersCtx, clientListKey).Result()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	slices.Sort(clientIDs)
+
+	clients := make([]model.Client, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		client, err := s.GetClient(ctx, clientID)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, nil
+}
+
+// クライアントを登録する (同じクライアントIDの登録は置き換える)
+func (s *RedisStore) SaveClient(ctx context.Context, client model.Client) error {
+	data, err := encodeRecord(ctx, "client", client.ClientID, newStoredClient(client))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	// クライアントとクライアント一覧は同じスロットにあるため、Cluster モードでもまとめて更新できる
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisKey("client", clientKeyID(client.ClientID)), data, 0) // 有効期限なし
+		pipe.SAdd(ctx, clientListKey, client.ClientID)
+		return nil
+	})
+	return storeError(err)
+}
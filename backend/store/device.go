@@ -0,0 +1,136 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// デバイス認可セッションに関するキー (セッション・ユーザーコードの索引・ポーリングの記録) の所有者は、ユーザーコードです
+// デバイスコードの先頭にユーザーコードから求めたタグ (DeviceCodeTag) を付けて発行し、
+// デバイスコードとユーザーコードのどちらからも同じハッシュタグを求めて、Cluster モードでも同じスロットに配置します
+
+// DeviceCodeTag デバイスコードの先頭に付けるタグをユーザーコードから求めます
+func DeviceCodeTag(userCode string) string {
+	return slotTag(userCode)
+}
+
+// deviceSessionID デバイスコードからデバイス認可セッションのキーに使用するIDを返します
+func deviceSessionID(deviceCode string) string {
+	return ownedID(idSlotTag(deviceCode), secretID(deviceCode))
+}
+
+// deviceUserCodeID ユーザーコードの索引のキーに使用するIDを返します
+func deviceUserCodeID(userCode string) string {
+	return ownedID(DeviceCodeTag(userCode), userCode)
+}
+
+// SaveDeviceSession デバイス認可セッションを保存します
+// ユーザーコードからセッションを引けるように索引も合わせて保存します
+// デバイスコードは秘密の値のため、セッションのキーと索引の値にはダイジェストを使用します (secret.go)
+// 有効期限はセッションの ExpiresAt に合わせます。保存済みのセッションの変更には UpdateDeviceSession を使用します
+func (s *RedisStore) SaveDeviceSession(ctx context.Context, session model.DeviceSession) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return expired("device session expired at %s", session.ExpiresAt.Format(time.RFC3339))
+	}
+
+	data, err := encodeRecord(ctx, "device_session", recordID("device_session", deviceSessionID(session.DeviceCode)), session)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisKey("device_session", deviceSessionID(session.DeviceCode)), data, ttl)
+		pipe.Set(ctx, redisKey("device_user_code", deviceUserCodeID(session.UserCode)), secretID(session.DeviceCode), ttl)
+		return nil
+	})
+	return storeError(err)
+}
+
+// GetDeviceSession デバイスコードからデバイス認可セッションを取得します
+func (s *RedisStore) GetDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	return GetSession[model.DeviceSession](ctx, "device_session", deviceSessionID(deviceCode))
+}
+
+// GetDeviceSessionByUserCode ユーザーコードからデバイス認可セッションを取得します
+func (s *RedisStore) GetDeviceSessionByUserCode(ctx context.Context, userCode string) (*model.DeviceSession, error) {
+	getCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	deviceCodeID, err := redisClient.Get(getCtx, redisKey("device_user_code", deviceUserCodeID(userCode))).Result()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return GetSession[model.DeviceSession](ctx, "device_session", ownedID(DeviceCodeTag(userCode), deviceCodeID))
+}
+
+// UpdateDeviceSession デバイスコードのデバイス認可セッションを update で変更して保存します
+// 取得してから保存するまでの間に他のリクエストが変更した場合は、その変更を反映したセッションで update をやり直します
+func (s *RedisStore) UpdateDeviceSession(ctx context.Context, deviceCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	return updateSession(ctx, "device_session", deviceSessionID(deviceCode), update)
+}
+
+// UpdateDeviceSessionByUserCode ユーザーコードのデバイス認可セッションを update で変更して保存します
+func (s *RedisStore) UpdateDeviceSessionByUserCode(ctx context.Context, userCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error) {
+	getCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	deviceCodeID, err := redisClient.Get(getCtx, redisKey("device_user_code", deviceUserCodeID(userCode))).Result()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return updateSession(ctx, "device_session", ownedID(DeviceCodeTag(userCode), deviceCodeID), update)
+}
+
+// ConsumeDeviceSession デバイス認可セッションを取得し、同時に削除します
+// デバイスコードは一度だけ使用できるため、GETDEL で取得と削除を不可分に行います (RFC 8628 Section 3.5)
+// 他のリクエストが先に使用した場合は ErrNotFound を返します
+func (s *RedisStore) ConsumeDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	getCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	val, err := redisClient.GetDel(getCtx, redisKey("device_session", deviceSessionID(deviceCode))).Bytes()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	session, err := unmarshalRecord[model.DeviceSession](ctx, "device_session", recordID("device_session", deviceSessionID(deviceCode)), val)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DeleteDeviceSession(ctx, *session); err != nil {
+		log.Printf("Warning: Failed to delete device user code: %v", err)
+	}
+	return session, nil
+}
+
+// DeleteDeviceSession デバイス認可セッションとユーザーコードの索引を削除します
+func (s *RedisStore) DeleteDeviceSession(ctx context.Context, session model.DeviceSession) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisKey("device_session", deviceSessionID(session.DeviceCode)))
+		pipe.Del(ctx, redisKey("device_user_code", deviceUserCodeID(session.UserCode)))
+		return nil
+	})
+	return storeError(err)
+}
+
+// MarkDevicePolled トークンエンドポイントへのポーリングを記録します
+// 前回のポーリングからポーリング間隔が経過していない場合は false を返します
+func (s *RedisStore) MarkDevicePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	polled, err := redisClient.SetNX(ctx, redisKey("device_poll", deviceSessionID(deviceCode)), 1, interval).Result()
+	return polled, storeError(err)
+}
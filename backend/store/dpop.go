@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// MarkDPoPProofUsed DPoP証明の jti を使用済みとして記録します
+// 同じ鍵・同じ jti の証明が有効期間内に既に使われている場合は false を返します
+func (s *RedisStore) MarkDPoPProofUsed(ctx context.Context, jkt string, jti string, expiration time.Duration) (bool, error) {
+	hash := sha256.Sum256([]byte(jkt + ":" + jti))
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	fresh, err := redisClient.SetNX(ctx, redisKey("dpop_jti", hex.EncodeToString(hash[:])), 1, expiration).Result()
+	return fresh, storeError(err)
+}
+
+// MarkRequestObjectUsed リクエストオブジェクトの jti を使用済みとして記録します
+// 同じクライアント・同じ jti のリクエストオブジェクトが有効期間内に既に使われている場合は false を返します
+func (s *RedisStore) MarkRequestObjectUsed(ctx context.Context, clientID string, jti string, expiration time.Duration) (bool, error) {
+	hash := sha256.Sum256([]byte(clientID + ":" + jti))
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	fresh, err := redisClient.SetNX(ctx, redisKey("request_object_jti", hex.EncodeToString(hash[:])), 1, expiration).Result()
+	return fresh, storeError(err)
+}
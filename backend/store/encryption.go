@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// 個人情報やサーバーの秘密鍵を含むレコードのエンベロープ暗号化
+//
+// レコードごとに生成したデータキー (AES-256) で本体を AES-GCM で暗号化し、データキーは KMS の鍵 (KEK) で暗号化して一緒に保存します
+// KEK を切り替えた後は cmd/migraterecords で古い KEK のレコードを現在の KEK で暗号化し直します
+// (古い KEK は、すべてのレコードを暗号化し直すまで KMS に残してください)
+//
+// メールアドレスのインデックス (user_email:*) は、平文の代わりに HMAC のブラインドインデックスをキーにします
+
+// encryptedRecordPrefixes 暗号化するレコードの prefix
+// ユーザー情報のほか、トークンの署名とリクエストオブジェクトの復号に使用する秘密鍵 (key) も暗号化します
+var encryptedRecordPrefixes = []string{"key", "user"}
+
+// recordKMS レコードの暗号化に使用する KMS (未設定の場合は暗号化しない)
+var recordKMS KMS
+
+// KMS データキーを暗号化する鍵 (KEK) を管理するサービス
+// KEK そのものは取り出さず、データキーの暗号化・復号とブラインドインデックスの計算のみを依頼します
+type KMS interface {
+	// CurrentKeyID 新しいデータキーの暗号化に使用する KEK のID
+	CurrentKeyID() string
+	// WrapKey 現在の KEK でデータキーを暗号化し、使用した KEK のIDを返します
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey keyID の KEK で暗号化されたデータキーを復号します
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// MAC ブラインドインデックスに使用する HMAC-SHA256 を計算します
+	// 鍵を変更するとインデックスを引けなくなるため、KEK とは別に固定の鍵を使用します
+	MAC(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// SetKMS レコードの暗号化に使用する KMS を設定します
+// InitRedis と OpenPostgres は STORE_ENCRYPTION_KEY_FILE が設定されている場合に LocalKMS を設定します
+func SetKMS(kms KMS) {
+	recordKMS = kms
+}
+
+// encryptedRecord 暗号化したレコード
+type encryptedRecord struct {
+	KeyID      string `json:"kid"` // データキーの暗号化に使用した KEK のID
+	DataKey    []byte `json:"dk"`  // KEK で暗号化したデータキー
+	Nonce      []byte `json:"iv"`
+	Ciphertext []byte `json:"ct"`
+	// 追加認証データがレコードのキー (prefix:id) か。false のレコード (以前の形式) は prefix のみを使用している
+	RecordKeyBound bool `json:"rk,omitempty"`
+}
+
+func encryptsRecord(prefix string) bool {
+	return recordKMS != nil && slices.Contains(encryptedRecordPrefixes, prefix)
+}
+
+// encryptRecord レコードの本体を新しいデータキーで暗号化します
+// 暗号文を別の種類のレコードや別のユーザーのレコードとして読み出せないよう、レコードのキー (recordKey) を追加認証データにします
+func encryptRecord(ctx context.Context, key string, data []byte) (*encryptedRecord, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := recordKMS.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	nonce, ciphertext, err := sealAESGCM(dataKey, data, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedRecord{KeyID: keyID, DataKey: wrapped, Nonce: nonce, Ciphertext: ciphertext, RecordKeyBound: true}, nil
+}
+
+// decryptRecord 暗号化したレコードの本体を復号します
+// 以前の形式のレコードは prefix を追加認証データにして復号します (cmd/migraterecords で現在の形式に書き換える)
+func decryptRecord(ctx context.Context, prefix string, id string, record *encryptedRecord) ([]byte, error) {
+	if recordKMS == nil {
+		return nil, errors.New("encrypted record found but no KMS is configured")
+	}
+	dataKey, err := recordKMS.UnwrapKey(ctx, record.KeyID, record.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	additionalData := prefix
+	if record.RecordKeyBound {
+		additionalData = recordKey(prefix, id)
+	}
+	return openAESGCM(dataKey, record.Nonce, record.Ciphertext, []byte(additionalData))
+}
+
+// emailIndexID メールアドレスのインデックスのキーに使用するIDを返します
+// KMS が設定されている場合は正規化したメールアドレスの HMAC (hmac:<16進数>)、それ以外は正規化したメールアドレスです
+func emailIndexID(ctx context.Context, email string) (string, error) {
+	normalized := NormalizeEmail(email)
+	if recordKMS == nil {
+		return normalized, nil
+	}
+	mac, err := recordKMS.MAC(ctx, []byte(normalized))
+	if err != nil {
+		return "", fmt.Errorf("failed to compute blind index: %w", err)
+	}
+	return "hmac:" + hex.EncodeToString(mac), nil
+}
+
+// legacyEmailIndexIDs ブラインドインデックスを導入する前 (および正規化を導入する前) のインデックスのID
+// 移行が済んでいないユーザーを引けるよう、emailIndexID で見つからない場合に参照します
+func legacyEmailIndexIDs(email string) []string {
+	normalized := NormalizeEmail(email)
+	var ids []string
+	if recordKMS != nil {
+		ids = append(ids, normalized)
+	}
+	if email != normalized {
+		ids = append(ids, email)
+	}
+	return ids
+}
+
+func sealAESGCM(key []byte, plaintext []byte, additionalData []byte) (nonce []byte, ciphertext []byte, err error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key []byte, nonce []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LocalKMS ファイルから読み込んだ鍵で動作する KMS
+// 鍵ファイルは次の形式の JSON で、鍵はいずれも Base64 でエンコードした32バイトです
+//
+//	{
+//	  "current": "2026-10",
+//	  "keys": {"2026-04": "...", "2026-10": "..."},
+//	  "index_key": "..."
+//	}
+//
+// KEK を切り替える場合は keys に新しい鍵を追加して current を変更します
+type LocalKMS struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+type localKMSFile struct {
+	Current  string            `json:"current"`
+	Keys     map[string]string `json:"keys"`
+	IndexKey string            `json:"index_key"`
+}
+
+// NewLocalKMS 鍵ファイルを読み込みます
+func NewLocalKMS(path string) (*LocalKMS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file localKMSFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid key file: %w", err)
+	}
+
+	kms := &LocalKMS{current: file.Current, keys: map[string][]byte{}}
+	for keyID, encoded := range file.Keys {
+		if kms.keys[keyID], err = decodeLocalKey(encoded); err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", keyID, err)
+		}
+	}
+	if _, ok := kms.keys[kms.current]; !ok {
+		return nil, fmt.Errorf("current key %q is not defined", kms.current)
+	}
+	if kms.indexKey, err = decodeLocalKey(file.IndexKey); err != nil {
+		return nil, fmt.Errorf("invalid index_key: %w", err)
+	}
+	return kms, nil
+}
+
+func decodeLocalKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// CurrentKeyID 新しいデータキーの暗号化に使用する KEK のID
+func (k *LocalKMS) CurrentKeyID() string {
+	return k.current
+}
+
+// WrapKey 現在の KEK でデータキーを暗号化します (AES-GCM、KEK のIDを追加認証データにします)
+func (k *LocalKMS) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	nonce, ciphertext, err := sealAESGCM(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", nil, err
+	}
+	return k.current, append(nonce, ciphertext...), nil
+}
+
+// UnwrapKey keyID の KEK で暗号化されたデータキーを復号します
+func (k *LocalKMS) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %s", keyID)
+	}
+	const nonceSize = 12
+	if len(wrapped) < nonceSize {
+		return nil, errors.New("wrapped key is too short")
+	}
+	return openAESGCM(key, wrapped[:nonceSize], wrapped[nonceSize:], []byte(keyID))
+}
+
+// MAC ブラインドインデックスに使用する HMAC-SHA256 を計算します
+func (k *LocalKMS) MAC(ctx context.Context, data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
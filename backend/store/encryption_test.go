@@ -0,0 +1,245 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend/model"
+)
+
+func TestEncryptedRecordRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	setTestKMS(t, newTestKMS(t, "k1", "k1"))
+	user := model.User{ID: "u1", Email: "alice@example.com", UserProfile: model.UserProfile{Name: "Alice"}}
+
+	encoded, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+	if bytes.Contains(encoded, []byte("alice@example.com")) || bytes.Contains(encoded, []byte("Alice")) {
+		t.Errorf("encoded record contains plaintext: %s", encoded)
+	}
+	envelope, err := parseRecord(encoded)
+	if err != nil {
+		t.Fatalf("parseRecord() error = %v", err)
+	}
+	if envelope.Encrypted == nil || envelope.Encrypted.KeyID != "k1" {
+		t.Fatalf("envelope = %+v, want encrypted with k1", envelope)
+	}
+
+	decoded, err := unmarshalRecord[model.User](ctx, "user", user.ID, encoded)
+	if err != nil {
+		t.Fatalf("unmarshalRecord() error = %v", err)
+	}
+	if decoded.Email != user.Email || decoded.Name != user.Name {
+		t.Errorf("unmarshalRecord() = %+v, want %+v", decoded, user)
+	}
+
+	// 暗号文を別の種類のレコードや別のユーザーのレコードとして読み出せない (レコードのキーは追加認証データ)
+	if _, err := decodeRecord(ctx, "key", user.ID, encoded); err == nil {
+		t.Error("decodeRecord() with another prefix succeeded")
+	}
+	if _, err := decodeRecord(ctx, "user", "u2", encoded); err == nil {
+		t.Error("decodeRecord() with another id succeeded")
+	}
+
+	// 暗号化の対象でないレコードは平文で保存する
+	client, err := encodeRecord(ctx, "client", "c1", map[string]string{"client_id": "c1"})
+	if err != nil {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+	assertJSONEqual(t, client, `{"v":2,"data":{"client_id":"c1"}}`)
+}
+
+func TestEncryptedRecordKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	keys := map[string][]byte{"k1": randomTestKey(t), "k2": randomTestKey(t)}
+	user := model.User{ID: "u1", Email: "alice@example.com"}
+
+	setTestKMS(t, &LocalKMS{current: "k1", keys: map[string][]byte{"k1": keys["k1"]}, indexKey: randomTestKey(t)})
+	plaintext, err := json.Marshal(recordEnvelope{Version: currentRecordVersion, Data: mustMarshal(t, user)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRecord, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+
+	// k2 に切り替えた後も、k1 を残している間は k1 のレコードを読み出せる
+	setTestKMS(t, &LocalKMS{current: "k2", keys: keys, indexKey: randomTestKey(t)})
+	newRecord, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+
+	// 追加認証データが prefix のみの以前の形式のレコード
+	prefixBound, err := encryptRecord(ctx, "user", mustMarshal(t, user))
+	if err != nil {
+		t.Fatalf("encryptRecord() error = %v", err)
+	}
+	prefixBound.RecordKeyBound = false
+	prefixRecord, err := json.Marshal(recordEnvelope{Version: currentRecordVersion, Encrypted: prefixBound})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		raw         []byte
+		wantRewrite bool
+	}{
+		{name: "plaintext", raw: plaintext, wantRewrite: true},
+		{name: "old key", raw: oldRecord, wantRewrite: true},
+		{name: "prefix only additional data", raw: prefixRecord, wantRewrite: true},
+		{name: "current key", raw: newRecord, wantRewrite: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := parseRecord(tt.raw)
+			if err != nil {
+				t.Fatalf("parseRecord() error = %v", err)
+			}
+			if got := recordNeedsRewrite("user", envelope); got != tt.wantRewrite {
+				t.Errorf("recordNeedsRewrite() = %v, want %v", got, tt.wantRewrite)
+			}
+			decoded, err := unmarshalRecord[model.User](ctx, "user", user.ID, tt.raw)
+			if err != nil {
+				t.Fatalf("unmarshalRecord() error = %v", err)
+			}
+			if decoded.Email != user.Email {
+				t.Errorf("Email = %s, want %s", decoded.Email, user.Email)
+			}
+		})
+	}
+
+	// k1 を削除した後は、k1 のレコードを読み出せない
+	setTestKMS(t, &LocalKMS{current: "k2", keys: map[string][]byte{"k2": keys["k2"]}, indexKey: randomTestKey(t)})
+	if _, err := decodeRecord(ctx, "user", user.ID, oldRecord); err == nil {
+		t.Error("decodeRecord() with a removed key succeeded")
+	}
+	if _, err := decodeRecord(ctx, "user", user.ID, newRecord); err != nil {
+		t.Errorf("decodeRecord() error = %v", err)
+	}
+
+	// KMS を設定していない場合は、暗号化されたレコードを読み出せない
+	setTestKMS(t, nil)
+	if _, err := decodeRecord(ctx, "user", user.ID, newRecord); err == nil {
+		t.Error("decodeRecord() without KMS succeeded")
+	}
+}
+
+func TestEmailIndexID(t *testing.T) {
+	ctx := context.Background()
+
+	setTestKMS(t, nil)
+	plain, err := emailIndexID(ctx, " Alice@Example.com")
+	if err != nil {
+		t.Fatalf("emailIndexID() error = %v", err)
+	}
+	if plain != "alice@example.com" {
+		t.Errorf("emailIndexID() without KMS = %s, want alice@example.com", plain)
+	}
+
+	setTestKMS(t, newTestKMS(t, "k1", "k1"))
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{name: "normalized", email: "alice@example.com"},
+		{name: "upper case", email: "ALICE@EXAMPLE.COM"},
+		{name: "full width at sign", email: "alice＠example.com"},
+		{name: "surrounding spaces", email: " alice@example.com "},
+	}
+	want, err := emailIndexID(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("emailIndexID() error = %v", err)
+	}
+	if !strings.HasPrefix(want, "hmac:") || strings.Contains(want, "alice") {
+		t.Fatalf("emailIndexID() = %s, want a blind index", want)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := emailIndexID(ctx, tt.email)
+			if err != nil {
+				t.Fatalf("emailIndexID() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("emailIndexID(%q) = %s, want %s", tt.email, got, want)
+			}
+		})
+	}
+}
+
+func TestNewLocalKMS(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(randomTestKey(t))
+	short := base64.StdEncoding.EncodeToString(make([]byte, 16))
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{name: "valid", file: `{"current":"k1","keys":{"k1":"` + key + `"},"index_key":"` + key + `"}`},
+		{name: "unknown current key", file: `{"current":"k2","keys":{"k1":"` + key + `"},"index_key":"` + key + `"}`, wantErr: true},
+		{name: "short key", file: `{"current":"k1","keys":{"k1":"` + short + `"},"index_key":"` + key + `"}`, wantErr: true},
+		{name: "invalid base64", file: `{"current":"k1","keys":{"k1":"!"},"index_key":"` + key + `"}`, wantErr: true},
+		{name: "missing index key", file: `{"current":"k1","keys":{"k1":"` + key + `"}}`, wantErr: true},
+		{name: "invalid json", file: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewLocalKMS(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLocalKMS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// setTestKMS テストの間だけレコードの暗号化に使用する KMS を変更します
+func setTestKMS(t *testing.T, kms KMS) {
+	t.Helper()
+	previous := recordKMS
+	recordKMS = kms
+	t.Cleanup(func() { recordKMS = previous })
+}
+
+// newTestKMS 乱数の鍵で LocalKMS を作成します
+func newTestKMS(t *testing.T, current string, keyIDs ...string) *LocalKMS {
+	t.Helper()
+	kms := &LocalKMS{current: current, keys: map[string][]byte{}, indexKey: randomTestKey(t)}
+	for _, keyID := range keyIDs {
+		kms.keys[keyID] = randomTestKey(t)
+	}
+	return kms
+}
+
+func randomTestKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func mustMarshal(t *testing.T, value interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+)
+
+// 保存先の操作で返すエラー
+// 呼び出し元は errors.Is で判定し、利用者の誤り (見つからない) と保存先の障害を区別します
+var (
+	// ErrNotFound 指定したデータが存在しない (保存先の有効期限で削除された場合や、形式が不正なIDを含む)
+	ErrNotFound = errors.New("not found")
+	// ErrExpired データは存在するが、データ自身の有効期限 (ExpiresAt) を過ぎている
+	ErrExpired = errors.New("expired")
+	// ErrConflict 一意であるべき値 (メールアドレスなど) が既存のデータと重複した
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable 保存先に接続できない、または保存先でエラーが発生した
+	ErrUnavailable = errors.New("store unavailable")
+	// ErrTimeout 保存先の操作が制限時間内に完了しなかった
+	ErrTimeout = errors.New("store operation timed out")
+)
+
+// 1回の操作の制限時間の既定値
+// 呼び出し元のコンテキストの期限がこれより短い場合はそちらが優先されます
+const defaultOperationTimeout = 2 * time.Second
+
+// operationTimeout 1回の操作の制限時間 (STORE_OPERATION_TIMEOUT で変更できます)
+var operationTimeout = defaultOperationTimeout
+
+// withTimeout 1回の操作の制限時間を設定したコンテキストを返します
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, operationTimeout)
+}
+
+// storeError Redis・PostgreSQL のエラーを保存先のエラーに変換します
+// 元のエラーも errors.Is / errors.As で判定できるように保持します
+func storeError(err error) error {
+	var netErr net.Error
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, redis.Nil), errors.Is(err, pgx.ErrNoRows):
+		return ErrNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == "23505": // unique_violation
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case errors.Is(err, context.Canceled):
+		// 呼び出し元 (HTTPリクエスト) が中断された場合はそのまま返す
+		return err
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+}
+
+// notFound 見つからなかったデータを示すエラーを返します
+func notFound(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, fmt.Sprintf(format, args...))
+}
+
+// expired 有効期限を過ぎたデータを示すエラーを返します
+func expired(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrExpired, fmt.Sprintf(format, args...))
+}
+
+// expirationOf 有効期限 (ExpiresAt) までの期間を保存先の有効期限として返します
+// 既に過ぎている場合は ErrExpired を返します
+func expirationOf(expiresAt time.Time, kind string) (time.Duration, error) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return 0, expired("%s expired at %s", kind, expiresAt.Format(time.RFC3339))
+	}
+	return ttl, nil
+}
+
+// checkTokenSessionExpiry リフレッシュトークンのセッションが有効期限を過ぎている場合は ErrExpired を返します
+// 保存先には有効期限を過ぎた後もしばらく残すため (expiredTokenSessionRetention)、取得時に確認します
+func checkTokenSessionExpiry(session model.TokenSession) error {
+	if !session.ExpiresAt.IsZero() && !time.Now().Before(session.ExpiresAt) {
+		return expired("token session expired at %s", session.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -2,28 +2,306 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	redisClient *redis.Client
-	ctx         = context.Background()
+	// 書き込みと、書き込み直後に読み出す一時データ (セッション・コード・トークン) に使用する接続
+	redisClient redis.UniversalClient
+	// ユーザーやクライアントなど、多少の複製遅延を許容できる参照に使用する接続
+	// レプリカからの読み出しが無効な場合は redisClient と同じ接続
+	redisReadClient redis.UniversalClient
+	// Cluster モードで接続しているか
+	redisClusterMode bool
 )
 
+// Redis の接続方式
+const (
+	redisModeStandalone = "standalone"
+	redisModeSentinel   = "sentinel"
+	redisModeCluster    = "cluster"
+)
+
+// RedisStore Redis を保存先とするリポジトリ
+// InitRedis で初期化した接続を使用します
+type RedisStore struct{}
+
+// InitRedis 環境変数の設定に従って Redis に接続します
+//
+//   - REDIS_MODE: standalone (既定), sentinel, cluster
+//   - REDIS_ADDR: 接続先 (sentinel の場合は Sentinel、cluster の場合はノードのカンマ区切り)
+//   - REDIS_SENTINEL_MASTER / REDIS_SENTINEL_PASSWORD: Sentinel で監視するマスター名とパスワード
+//   - REDIS_READ_FROM_REPLICAS: true の場合、参照をレプリカに振り分ける
+//   - REDIS_READER_ADDR: standalone の場合の読み出し用エンドポイント (ElastiCache のリーダーエンドポイントなど)
+//   - REDIS_POOL_SIZE / REDIS_MIN_IDLE_CONNS / REDIS_MAX_RETRIES: 接続プールの設定
+//   - REDIS_DIAL_TIMEOUT / REDIS_READ_TIMEOUT / REDIS_WRITE_TIMEOUT / REDIS_POOL_TIMEOUT: タイムアウト (例: 500ms)
+//
+// レコードの保存形式と暗号化の設定 (STORE_LEGACY_RECORD_FORMAT / STORE_ENCRYPTION_KEY_FILE) は loadRecordSettings を参照してください
 func InitRedis() error {
-	tlsConfig := &tls.Config{}
-	if os.Getenv("REDIS_AUTH_TOKEN") == "" {
-		tlsConfig = nil
-	}
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:      os.Getenv("REDIS_ADDR"),
-		Password:  os.Getenv("REDIS_AUTH_TOKEN"),
-		DB:        0,
-		TLSConfig: tlsConfig,
-	})
-
-	return redisClient.Ping(ctx).Err()
+	options, err := redisOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	addrs := splitAddrs(os.Getenv("REDIS_ADDR"))
+	readFromReplicas := os.Getenv("REDIS_READ_FROM_REPLICAS") == "true"
+	if err := loadRecordSettings(); err != nil {
+		return err
+	}
+
+	mode := envOrDefault("REDIS_MODE", redisModeStandalone)
+	switch mode {
+	case redisModeStandalone:
+		redisClient = redis.NewClient(options.standalone(firstAddr(addrs)))
+		redisReadClient = redisClient
+		if readerAddr := os.Getenv("REDIS_READER_ADDR"); readerAddr != "" && readFromReplicas {
+			redisReadClient = redis.NewClient(options.standalone(readerAddr))
+		}
+
+	case redisModeSentinel:
+		masterName := os.Getenv("REDIS_SENTINEL_MASTER")
+		if masterName == "" {
+			return fmt.Errorf("REDIS_SENTINEL_MASTER environment variable is not set")
+		}
+		// フェイルオーバー時は Sentinel から新しいマスターを取得して再接続する
+		redisClient = redis.NewFailoverClient(options.failover(masterName, addrs))
+		redisReadClient = redisClient
+		if readFromReplicas {
+			failover := options.failover(masterName, addrs)
+			failover.ReplicaOnly = true
+			redisReadClient = redis.NewFailoverClusterClient(failover)
+		}
+
+	case redisModeCluster:
+		redisClusterMode = true
+		redisClient = redis.NewClusterClient(options.cluster(addrs))
+		redisReadClient = redisClient
+		if readFromReplicas {
+			cluster := options.cluster(addrs)
+			cluster.ReadOnly = true
+			cluster.RouteRandomly = true
+			redisReadClient = redis.NewClusterClient(cluster)
+		}
+
+	default:
+		return fmt.Errorf("unsupported REDIS_MODE: %s", mode)
+	}
+
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		return storeError(err)
+	}
+	return storeError(redisReadClient.Ping(ctx).Err())
+}
+
+// redisOptions 接続方式に依らない接続の設定
+type redisOptions struct {
+	password         string
+	sentinelPassword string
+	tlsConfig        *tls.Config
+	poolSize         int
+	minIdleConns     int
+	maxRetries       int
+	dialTimeout      time.Duration
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	poolTimeout      time.Duration
+}
+
+func redisOptionsFromEnv() (*redisOptions, error) {
+	options := &redisOptions{
+		password:         os.Getenv("REDIS_AUTH_TOKEN"),
+		sentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+	}
+	// 認証トークンを使用する場合 (ElastiCache の転送中の暗号化) は TLS で接続する
+	if options.password != "" {
+		options.tlsConfig = &tls.Config{}
+	}
+
+	var err error
+	if options.poolSize, err = envInt("REDIS_POOL_SIZE"); err != nil {
+		return nil, err
+	}
+	if options.minIdleConns, err = envInt("REDIS_MIN_IDLE_CONNS"); err != nil {
+		return nil, err
+	}
+	if options.maxRetries, err = envInt("REDIS_MAX_RETRIES"); err != nil {
+		return nil, err
+	}
+	if options.dialTimeout, err = envDuration("REDIS_DIAL_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if options.readTimeout, err = envDuration("REDIS_READ_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if options.writeTimeout, err = envDuration("REDIS_WRITE_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	if options.poolTimeout, err = envDuration("REDIS_POOL_TIMEOUT"); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (o *redisOptions) standalone(addr string) *redis.Options {
+	return &redis.Options{
+		Addr:         addr,
+		Password:     o.password,
+		DB:           0,
+		TLSConfig:    o.tlsConfig,
+		PoolSize:     o.poolSize,
+		MinIdleConns: o.minIdleConns,
+		MaxRetries:   o.maxRetries,
+		DialTimeout:  o.dialTimeout,
+		ReadTimeout:  o.readTimeout,
+		WriteTimeout: o.writeTimeout,
+		PoolTimeout:  o.poolTimeout,
+	}
+}
+
+func (o *redisOptions) failover(masterName string, sentinelAddrs []string) *redis.FailoverOptions {
+	return &redis.FailoverOptions{
+		MasterName:       masterName,
+		SentinelAddrs:    sentinelAddrs,
+		SentinelPassword: o.sentinelPassword,
+		Password:         o.password,
+		DB:               0,
+		TLSConfig:        o.tlsConfig,
+		PoolSize:         o.poolSize,
+		MinIdleConns:     o.minIdleConns,
+		MaxRetries:       o.maxRetries,
+		DialTimeout:      o.dialTimeout,
+		ReadTimeout:      o.readTimeout,
+		WriteTimeout:     o.writeTimeout,
+		PoolTimeout:      o.poolTimeout,
+	}
+}
+
+func (o *redisOptions) cluster(addrs []string) *redis.ClusterOptions {
+	return &redis.ClusterOptions{
+		Addrs:        addrs,
+		Password:     o.password,
+		TLSConfig:    o.tlsConfig,
+		PoolSize:     o.poolSize,
+		MinIdleConns: o.minIdleConns,
+		MaxRetries:   o.maxRetries,
+		DialTimeout:  o.dialTimeout,
+		ReadTimeout:  o.readTimeout,
+		WriteTimeout: o.writeTimeout,
+		PoolTimeout:  o.poolTimeout,
+	}
+}
+
+// redisKey キーを組み立てます
+// Cluster モードでは id をハッシュタグ ({id}) にして、キーごとにスロットを分散します
+// ownedID で所有者のハッシュタグを付けた id はそのまま使用し、所有者が同じキーを同じスロットに配置します
+// standalone / sentinel では既存のデータと同じ prefix:id の形式のままです
+func redisKey(prefix string, id string) string {
+	if redisClusterMode && !strings.HasPrefix(id, "{") {
+		return prefix + ":{" + id + "}"
+	}
+	return prefix + ":" + id
+}
+
+// ownedID Cluster モードで id に所有者のハッシュタグを付けます ({tag}:id)
+// 同じ tag のキーは同じスロットに配置されるため、MULTI や Lua スクリプトでまとめて更新できます
+// standalone / sentinel では id をそのまま返します
+func ownedID(tag string, id string) string {
+	if redisClusterMode {
+		return "{" + tag + "}:" + id
+	}
+	return id
+}
+
+// slotTagLength slotTag の長さ
+const slotTagLength = 4
+
+// slotTag 値から所有者のハッシュタグに使用する短い値 (16進数4桁) を返します
+// 作成時に ID の先頭に埋め込み、ID と値のどちらからも同じハッシュタグを求められるようにします (ユーザーID・デバイスコード)
+func slotTag(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:slotTagLength/2])
+}
+
+// idSlotTag 先頭に slotTag を埋め込んだ ID からハッシュタグを返します
+// 埋め込む前に作成された ID では先頭の4文字をハッシュタグとして使用します (同じ ID のキーは同じスロットになります)
+func idSlotTag(id string) string {
+	if len(id) < slotTagLength {
+		return id
+	}
+	return id[:slotTagLength]
+}
+
+// redisKeyID redisKey で組み立てたキーから id を取り出します (ハッシュタグは取り除きます)
+func redisKeyID(prefix string, key string) (string, bool) {
+	id, ok := strings.CutPrefix(key, prefix+":")
+	if !ok || !redisClusterMode || !strings.HasPrefix(id, "{") {
+		return id, ok
+	}
+	tag, rest, ok := strings.Cut(id[1:], "}")
+	if !ok {
+		return id, true
+	}
+	if rest == "" {
+		return tag, true
+	}
+	return strings.TrimPrefix(rest, ":"), true
+}
+
+// recordID redisKey(prefix, id) に保存するレコードのID (recordKey に使用する、ハッシュタグを除いたID) を返します
+func recordID(prefix string, id string) string {
+	recordID, _ := redisKeyID(prefix, redisKey(prefix, id))
+	return recordID
+}
+
+func splitAddrs(value string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func firstAddr(addrs []string) string {
+	if len(addrs) == 0 {
+		return ""
+	}
+	return addrs[0]
+}
+
+// envInt 整数の環境変数を読み込みます。未設定の場合は 0 (go-redis の既定値) を返します
+func envInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// envDuration 時間の環境変数を読み込みます。未設定の場合は 0 (go-redis の既定値) を返します
+func envDuration(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
 }
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+)
+
+// 用途ごとの鍵を取得し、未登録の場合は登録する
+// SETNX で登録するため、同時に起動したインスタンスも同じ鍵を使用する
+func (s *RedisStore) GetOrCreateKey(ctx context.Context, key model.Key) (*model.Key, error) {
+	data, err := encodeRecord(ctx, "key", key.Use, key)
+	if err != nil {
+		return nil, err
+	}
+	setCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	if _, err := redisClient.SetNX(setCtx, redisKey("key", key.Use), data, 0).Result(); err != nil { // 有効期限なし
+		return nil, storeError(err)
+	}
+	return GetSession[model.Key](ctx, "key", key.Use)
+}
@@ -0,0 +1,513 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore プロセス内のメモリを保存先とするリポジトリ
+// ローカル開発と動作確認用で、プロセスの終了時にすべてのデータが失われます
+// Redis と同じキーと有効期限で、JSONに変換した値を保持します
+// 操作はプロセス内で完了するため、ctx による中断や制限時間は適用しません
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	data []byte
+	// 有効期限 (ゼロ値の場合は無期限)
+	expiresAt time.Time
+}
+
+// NewMemoryStore 空の MemoryStore を作成します
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+// set 値を保存します。expiration が 0 の場合は無期限です
+// 呼び出し元で mu をロックしている必要があります
+func (s *MemoryStore) set(key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	entry := memoryEntry{data: data}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+// lookup 有効期限内の値を取得します。期限切れの値は削除します
+// 呼び出し元で mu をロックしている必要があります
+func (s *MemoryStore) lookup(key string) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && !time.Now().Before(entry.expiresAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+// get 値を取得して value に読み込みます。見つからない場合は false を返します
+// 呼び出し元で mu をロックしている必要があります
+func (s *MemoryStore) get(key string, value interface{}) (bool, error) {
+	entry, ok := s.lookup(key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(entry.data, value)
+}
+
+func memoryGet[T any](s *MemoryStore, prefix string, id string) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var value T
+	found, err := s.get(prefix+":"+id, &value)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return &value, nil
+}
+
+func (s *MemoryStore) save(key string, value interface{}, expiration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(key, value, expiration)
+}
+
+func (s *MemoryStore) delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// setNX 値が存在しない場合のみ保存し、保存したかどうかを返します
+func (s *MemoryStore) setNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup(key); ok {
+		return false, nil
+	}
+	return true, s.set(key, value, expiration)
+}
+
+// ユーザーIDからユーザー情報を取得する
+func (s *MemoryStore) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return memoryGet[model.User](s, "user", userID)
+}
+
+// メールアドレスからユーザー情報を取得する
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	userID, err := memoryGet[string](s, "user_email", NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, *userID)
+}
+
+// ユーザーを登録または取得する
+// 確認と登録を同じロックの中で行うため、同じメールアドレスのユーザーが重複して作成されることはない
+func (s *MemoryStore) GetOrCreateUser(ctx context.Context, email string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userID string
+	found, err := s.get("user_email:"+NormalizeEmail(email), &userID)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		var user model.User
+		if found, err := s.get("user:"+userID, &user); err != nil {
+			return nil, err
+		} else if !found {
+			return nil, notFound("user for email: %s", email)
+		}
+		return &user, nil
+	}
+
+	newUserID, err := generateUserID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user := model.User{
+		ID:        newUserID,
+		Email:     strings.TrimSpace(email),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.set("user:"+newUserID, user, 0); err != nil {
+		return nil, err
+	}
+	if err := s.set("user_email:"+NormalizeEmail(email), newUserID, 0); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ユーザー情報を更新する (存在しないユーザーの場合は ErrNotFound を返す)
+func (s *MemoryStore) UpdateUser(ctx context.Context, user model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.lookup("user:" + user.ID); !ok {
+		return notFound("user %s", user.ID)
+	}
+	return s.set("user:"+user.ID, user, 0)
+}
+
+// ユーザー情報を変更する (確認と保存を同じロックの中で行う)
+func (s *MemoryStore) ModifyUser(ctx context.Context, userID string, update func(*model.User) error) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var user model.User
+	found, err := s.get("user:"+userID, &user)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, notFound("user %s", userID)
+	}
+	if err := update(&user); err != nil {
+		return nil, err
+	}
+	return &user, s.set("user:"+userID, user, 0)
+}
+
+// SavePairwiseSubject ペアワイズ識別子から内部のユーザーIDを引けるように保存する
+func (s *MemoryStore) SavePairwiseSubject(ctx context.Context, subject string, userID string) error {
+	return s.save("pairwise_subject:"+subject, userID, 0)
+}
+
+// ペアワイズ識別子から内部のユーザーIDを取得する
+// ペアワイズ識別子として発行されていない場合は空文字を返す
+func (s *MemoryStore) GetUserIDByPairwiseSubject(ctx context.Context, subject string) (string, error) {
+	userID, err := memoryGet[string](s, "pairwise_subject", subject)
+	if err != nil {
+		return "", nil
+	}
+	return *userID, nil
+}
+
+// クライアントIDから登録済みのクライアントを取得する
+func (s *MemoryStore) GetClient(ctx context.Context, clientID string) (*model.Client, error) {
+	stored, err := memoryGet[storedClient](s, "client", clientID)
+	if err != nil {
+		return nil, err
+	}
+	client := stored.client()
+	return &client, nil
+}
+
+// 登録済みのクライアントをすべて取得する
+func (s *MemoryStore) ListClients(ctx context.Context) ([]model.Client, error) {
+	s.mu.Lock()
+	var keys []string
+	for key := range s.entries {
+		if strings.HasPrefix(key, "client:") {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+	slices.Sort(keys)
+
+	clients := make([]model.Client, 0, len(keys))
+	for _, key := range keys {
+		client, err := s.GetClient(ctx, strings.TrimPrefix(key, "client:"))
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, nil
+}
+
+// クライアントを登録する (同じクライアントIDの登録は置き換える)
+func (s *MemoryStore) SaveClient(ctx context.Context, client model.Client) error {
+	return s.save("client:"+client.ClientID, newStoredClient(client), 0)
+}
+
+// SaveAuthSession 認証セッションを保存
+func (s *MemoryStore) SaveAuthSession(ctx context.Context, sessionID string, session model.AuthSession) error {
+	ttl, err := expirationOf(session.ExpiresAt, "auth session")
+	if err != nil {
+		return err
+	}
+	return s.save("auth_session:"+secretID(sessionID), session, ttl)
+}
+
+// GetAuthSession 認証セッションを取得
+func (s *MemoryStore) GetAuthSession(ctx context.Context, sessionID string) (*model.AuthSession, error) {
+	if len(sessionID) != 64 {
+		return nil, notFound("invalid session id format")
+	}
+	return memoryGet[model.AuthSession](s, "auth_session", secretID(sessionID))
+}
+
+// DeleteAuthSession 認証セッションを削除
+func (s *MemoryStore) DeleteAuthSession(ctx context.Context, sessionID string) error {
+	return s.delete("auth_session:" + secretID(sessionID))
+}
+
+// AuthorizeSessionの保存用ラッパー関数
+func (s *MemoryStore) SaveAuthorizeSession(ctx context.Context, sessionID string, session model.AuthorizeSession) error {
+	return s.save("authorize_session:"+secretID(sessionID), session, authorizationCodeExpiration)
+}
+
+// AuthorizeSessionの取得用ラッパー関数
+func (s *MemoryStore) GetAuthorizeSession(ctx context.Context, sessionID string) (*model.AuthorizeSession, error) {
+	if len(sessionID) != 64 {
+		return nil, notFound("invalid session id format")
+	}
+	return memoryGet[model.AuthorizeSession](s, "authorize_session", secretID(sessionID))
+}
+
+// AuthorizeSessionの削除用ラッパー関数
+func (s *MemoryStore) DeleteAuthorizeSession(ctx context.Context, sessionID string) error {
+	return s.delete("authorize_session:" + secretID(sessionID))
+}
+
+// SavePushedAuthorizationRequest PARで受け付けた認可リクエストを保存します
+func (s *MemoryStore) SavePushedAuthorizationRequest(ctx context.Context, requestURI string, request model.AuthorizationRequest, expiration time.Duration) error {
+	return s.save("par_request:"+secretID(requestURI), request, expiration)
+}
+
+// ConsumePushedAuthorizationRequest PARで受け付けた認可リクエストを取得し、同時に削除します
+func (s *MemoryStore) ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*model.AuthorizationRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var request model.AuthorizationRequest
+	found, err := s.get("par_request:"+secretID(requestURI), &request)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	delete(s.entries, "par_request:"+secretID(requestURI))
+	return &request, nil
+}
+
+// SaveDeviceSession デバイス認可セッションとユーザーコードの索引を保存します
+func (s *MemoryStore) SaveDeviceSession(ctx context.Context, session model.DeviceSession) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return expired("device session expired at %s", session.ExpiresAt.Format(time.RFC3339))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deviceCodeID := secretID(session.DeviceCode)
+	if err := s.set("device_session:"+deviceCodeID, session, ttl); err != nil {
+		return err
+	}
+	return s.set("device_user_code:"+session.UserCode, deviceCodeID, ttl)
+}
+
+// GetDeviceSession デバイスコードからデバイス認可セッションを取得します
+func (s *MemoryStore) GetDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	return memoryGet[model.DeviceSession](s, "device_session", secretID(deviceCode))
+}
+
+// GetDeviceSessionByUserCode ユーザーコードからデバイス認可セッションを取得します
+func (s *MemoryStore) GetDeviceSessionByUserCode(ctx context.Context, userCode string) (*model.DeviceSession, error) {
+	deviceCodeID, err := memoryGet[string](s, "device_user_code", userCode)
+	if err != nil {
+		return nil, err
+	}
+	return memoryGet[model.DeviceSession](s, "device_session", *deviceCodeID)
+}
+
+// UpdateDeviceSession デバイスコードのデバイス認可セッションを update で変更して保存します
+func (s *MemoryStore) UpdateDeviceSession(ctx context.Context, deviceCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateDeviceSession(secretID(deviceCode), update)
+}
+
+// UpdateDeviceSessionByUserCode ユーザーコードのデバイス認可セッションを update で変更して保存します
+func (s *MemoryStore) UpdateDeviceSessionByUserCode(ctx context.Context, userCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deviceCodeID string
+	found, err := s.get("device_user_code:"+userCode, &deviceCodeID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return s.updateDeviceSession(deviceCodeID, update)
+}
+
+// updateDeviceSession 有効期限を保ったままデバイス認可セッションを変更します
+// 呼び出し元で mu をロックしている必要があります
+func (s *MemoryStore) updateDeviceSession(deviceCodeID string, update func(*model.DeviceSession) error) (*model.DeviceSession, error) {
+	key := "device_session:" + deviceCodeID
+	entry, ok := s.lookup(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var session model.DeviceSession
+	if err := json.Unmarshal(entry.data, &session); err != nil {
+		return nil, err
+	}
+	if err := update(&session); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	s.entries[key] = memoryEntry{data: data, expiresAt: entry.expiresAt}
+	return &session, nil
+}
+
+// ConsumeDeviceSession デバイス認可セッションを取得し、同時に削除します
+func (s *MemoryStore) ConsumeDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error) {
+	if len(deviceCode) != 64 {
+		return nil, notFound("invalid device code format")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var session model.DeviceSession
+	found, err := s.get("device_session:"+secretID(deviceCode), &session)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	delete(s.entries, "device_session:"+secretID(deviceCode))
+	delete(s.entries, "device_user_code:"+session.UserCode)
+	return &session, nil
+}
+
+// DeleteDeviceSession デバイス認可セッションとユーザーコードの索引を削除します
+func (s *MemoryStore) DeleteDeviceSession(ctx context.Context, session model.DeviceSession) error {
+	return s.delete("device_session:"+secretID(session.DeviceCode), "device_user_code:"+session.UserCode)
+}
+
+// MarkDevicePolled トークンエンドポイントへのポーリングを記録します
+func (s *MemoryStore) MarkDevicePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error) {
+	return s.setNX("device_poll:"+secretID(deviceCode), 1, interval)
+}
+
+// TokenSessionの保存用ラッパー関数
+func (s *MemoryStore) SaveTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error {
+	ttl, err := tokenSessionExpiration(session)
+	if err != nil {
+		return err
+	}
+	return s.save("token_session:"+secretID(tokenID), session, ttl)
+}
+
+// TokenSessionの取得用ラッパー関数
+func (s *MemoryStore) GetTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error) {
+	session, err := memoryGet[model.TokenSession](s, "token_session", secretID(tokenID))
+	if err != nil {
+		return model.TokenSession{}, err
+	}
+	return *session, checkTokenSessionExpiry(*session)
+}
+
+// TokenSessionの更新用ラッパー関数 (既存の有効期限を保持する)
+func (s *MemoryStore) UpdateTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	key := "token_session:" + secretID(tokenID)
+	entry, ok := s.lookup(key)
+	if !ok {
+		entry.expiresAt = session.ExpiresAt.Add(expiredTokenSessionRetention)
+	}
+	entry.data = data
+	s.entries[key] = entry
+	return nil
+}
+
+// TokenSessionの削除用ラッパー関数
+func (s *MemoryStore) DeleteTokenSession(ctx context.Context, tokenID string) error {
+	return s.delete("token_session:" + secretID(tokenID))
+}
+
+// ConsumeTokenSession トークンセッションを取得し、同時に削除します
+func (s *MemoryStore) ConsumeTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var session model.TokenSession
+	found, err := s.get("token_session:"+secretID(tokenID), &session)
+	if err != nil {
+		return model.TokenSession{}, err
+	}
+	if !found {
+		return model.TokenSession{}, ErrNotFound
+	}
+	delete(s.entries, "token_session:"+secretID(tokenID))
+	return session, checkTokenSessionExpiry(session)
+}
+
+// SaveUserInfoClaims アクセストークンに対して要求された UserInfo のクレームを保存します
+func (s *MemoryStore) SaveUserInfoClaims(ctx context.Context, tokenID string, claims map[string]*model.ClaimRequest, expiration time.Duration) error {
+	return s.save("userinfo_claims:"+tokenID, claims, expiration)
+}
+
+// GetUserInfoClaims アクセストークンに対して要求された UserInfo のクレームを取得します
+func (s *MemoryStore) GetUserInfoClaims(ctx context.Context, tokenID string) (map[string]*model.ClaimRequest, error) {
+	claims, err := memoryGet[map[string]*model.ClaimRequest](s, "userinfo_claims", tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return *claims, nil
+}
+
+// MarkDPoPProofUsed DPoP証明の jti を使用済みとして記録します
+func (s *MemoryStore) MarkDPoPProofUsed(ctx context.Context, jkt string, jti string, expiration time.Duration) (bool, error) {
+	hash := sha256.Sum256([]byte(jkt + ":" + jti))
+	return s.setNX("dpop_jti:"+hex.EncodeToString(hash[:]), 1, expiration)
+}
+
+// MarkRequestObjectUsed リクエストオブジェクトの jti を使用済みとして記録します
+func (s *MemoryStore) MarkRequestObjectUsed(ctx context.Context, clientID string, jti string, expiration time.Duration) (bool, error) {
+	hash := sha256.Sum256([]byte(clientID + ":" + jti))
+	return s.setNX("request_object_jti:"+hex.EncodeToString(hash[:]), 1, expiration)
+}
+
+// 用途ごとの鍵を取得し、未登録の場合は登録する
+func (s *MemoryStore) GetOrCreateKey(ctx context.Context, key model.Key) (*model.Key, error) {
+	if _, err := s.setNX("key:"+key.Use, key, 0); err != nil {
+		return nil, err
+	}
+	return memoryGet[model.Key](s, "key", key.Use)
+}
@@ -0,0 +1,38 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"backend/store"
+	"backend/store/storetest"
+)
+
+// TestMemoryStore メモリの実装に共通のテストスイート (store/storetest) を実行します
+func TestMemoryStore(t *testing.T) {
+	s := store.NewMemoryStore()
+	testRepositories(t, &store.Repositories{Users: s, Clients: s, Sessions: s, Codes: s, Tokens: s, Keys: s})
+}
+
+// testRepositories 設定されているリポジトリごとに共通のテストスイートをサブテストとして実行します
+// nil のリポジトリ (その保存先が対応していないもの) は実行しません
+func testRepositories(t *testing.T, repos *store.Repositories) {
+	t.Helper()
+	ctx := context.Background()
+	run := func(name string, enabled bool, test func() error) {
+		if !enabled {
+			return
+		}
+		t.Run(name, func(t *testing.T) {
+			if err := test(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	run("Users", repos.Users != nil, func() error { return storetest.TestUserRepository(ctx, repos.Users) })
+	run("Clients", repos.Clients != nil, func() error { return storetest.TestClientRepository(ctx, repos.Clients) })
+	run("Sessions", repos.Sessions != nil, func() error { return storetest.TestSessionRepository(ctx, repos.Sessions) })
+	run("Codes", repos.Codes != nil, func() error { return storetest.TestCodeRepository(ctx, repos.Codes) })
+	run("Tokens", repos.Tokens != nil, func() error { return storetest.TestTokenRepository(ctx, repos.Tokens) })
+	run("Keys", repos.Keys != nil, func() error { return storetest.TestKeyRepository(ctx, repos.Keys) })
+}
@@ -0,0 +1,239 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 移行の進捗 (SCAN のカーソル) の保存期間
+const recordMigrationCheckpointExpiration = 7 * 24 * time.Hour
+
+// errInvalidRecord 保存されたレコードを読み出せない
+var errInvalidRecord = errors.New("invalid record")
+
+// RecordMigrationOptions レコードの移行の設定
+type RecordMigrationOptions struct {
+	// DryRun 書き換えと進捗の保存を行わず、書き換えが必要なレコードを数える (保存された進捗は使用しない)
+	DryRun bool
+	// BatchSize 1回の SCAN で走査するキーの数の目安 (COUNT)
+	BatchSize int64
+	// Restart 保存された進捗を破棄して最初から走査する
+	Restart bool
+}
+
+// RecordMigrationStats prefix ごとの移行の結果
+type RecordMigrationStats struct {
+	Prefix   string
+	Scanned  int // 走査したキー
+	Migrated int // 現在のバージョンで保存し直したキー (DryRun の場合は保存し直すキー)
+	Invalid  int // 読み出せなかったキー
+	Resumed  int // 前回の進捗から再開したノード
+}
+
+// MigrateRecords エンベロープで保存するすべてのレコードを走査し、古いバージョンのレコードを現在のバージョンで保存し直します
+// 暗号化の対象のレコードは、平文のレコードと古い鍵 (KEK) で暗号化されたレコードを現在の鍵で暗号化し直します
+// サービスを止めずに実行できるよう、SCAN で少しずつ走査し、レコードごとに WATCH で他のインスタンスの更新と衝突しないようにします
+// ノードごとの進捗を Redis に保存するため、中断した場合も次回の実行で続きから再開します
+func (s *RedisStore) MigrateRecords(ctx context.Context, options RecordMigrationOptions) ([]RecordMigrationStats, error) {
+	if writeLegacyRecords && !options.DryRun {
+		return nil, errors.New("STORE_LEGACY_RECORD_FORMAT is enabled; records cannot be migrated yet")
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+
+	results := make([]RecordMigrationStats, 0, len(versionedRecordPrefixes))
+	for _, prefix := range versionedRecordPrefixes {
+		stats := RecordMigrationStats{Prefix: prefix}
+		var mu sync.Mutex
+		err := forEachNode(ctx, func(ctx context.Context, client *redis.Client) error {
+			return migrateNodeRecords(ctx, client, prefix, options, &stats, &mu)
+		})
+		results = append(results, stats)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// migrateNodeRecords 1つのノードの prefix のレコードを移行します
+func migrateNodeRecords(ctx context.Context, client *redis.Client, prefix string, options RecordMigrationOptions, stats *RecordMigrationStats, mu *sync.Mutex) error {
+	checkpoint := fmt.Sprintf("record_migration:v%d:%s:%s", currentRecordVersion, prefix, client.Options().Addr)
+	if encryptsRecord(prefix) {
+		// 鍵を切り替えた後は、同じバージョンでも最初から走査し直す
+		checkpoint = fmt.Sprintf("record_migration:v%d:%s@%s:%s", currentRecordVersion, prefix, recordKMS.CurrentKeyID(), client.Options().Addr)
+	}
+
+	cursor, done, err := loadMigrationCheckpoint(ctx, checkpoint, options)
+	if err != nil || done {
+		return err
+	}
+	if cursor != 0 {
+		mu.Lock()
+		stats.Resumed++
+		mu.Unlock()
+	}
+
+	for {
+		scanCtx, cancel := withTimeout(ctx)
+		keys, next, err := client.Scan(scanCtx, cursor, prefix+":*", options.BatchSize).Result()
+		cancel()
+		if err != nil {
+			return storeError(err)
+		}
+
+		for _, key := range keys {
+			migrated, err := migrateKey(ctx, client, prefix, key, options.DryRun)
+			invalid := errors.Is(err, errInvalidRecord)
+			if err != nil && !invalid {
+				return err
+			}
+			if invalid {
+				log.Printf("Skipped invalid record %s: %v", key, err)
+			}
+			mu.Lock()
+			stats.Scanned++
+			if migrated {
+				stats.Migrated++
+			}
+			if invalid {
+				stats.Invalid++
+			}
+			mu.Unlock()
+		}
+
+		cursor = next
+		if !options.DryRun {
+			if err := saveMigrationCheckpoint(ctx, checkpoint, cursor); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// loadMigrationCheckpoint 保存された進捗を読み出します
+// 走査を完了している場合は done を返します
+func loadMigrationCheckpoint(ctx context.Context, checkpoint string, options RecordMigrationOptions) (cursor uint64, done bool, err error) {
+	if options.DryRun || options.Restart {
+		return 0, false, nil
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	saved, err := redisClient.Get(ctx, checkpoint).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, storeError(err)
+	}
+	if saved == "done" {
+		return 0, true, nil
+	}
+	cursor, err = strconv.ParseUint(saved, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid checkpoint %s: %w", checkpoint, err)
+	}
+	return cursor, false, nil
+}
+
+// saveMigrationCheckpoint 次に走査するカーソルを保存します (0 は走査の完了)
+func saveMigrationCheckpoint(ctx context.Context, checkpoint string, cursor uint64) error {
+	state := strconv.FormatUint(cursor, 10)
+	if cursor == 0 {
+		state = "done"
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storeError(redisClient.Set(ctx, checkpoint, state, recordMigrationCheckpointExpiration).Err())
+}
+
+// migrateKey キーが秘密の値そのもの (secret.go) の場合はダイジェストのキーに移し、それ以外はレコードを現在のバージョンで保存し直します
+func migrateKey(ctx context.Context, client *redis.Client, prefix string, key string, dryRun bool) (bool, error) {
+	secret, legacy := legacySecretKey(prefix, key)
+	if !legacy {
+		return migrateRecord(ctx, client, prefix, key, dryRun)
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	err := rekeySecretRecord(ctx, prefix, secret)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// 走査中に削除された、または他のインスタンスが移した
+		return false, nil
+	case errors.Is(err, ErrUnavailable), errors.Is(err, ErrTimeout):
+		return false, err
+	case err != nil:
+		return false, fmt.Errorf("%w: %w", errInvalidRecord, err)
+	}
+	return true, nil
+}
+
+// migrateRecord レコードが古いバージョンの場合 (暗号化の対象では、平文または現在の鍵で暗号化されていない場合も) は、
+// 有効期限を保ったまま現在の形式で保存し直します
+// 読み出してから保存するまでに他のインスタンスが更新した場合は、その更新を上書きしないように読み出しからやり直します
+func migrateRecord(ctx context.Context, client *redis.Client, prefix string, key string, dryRun bool) (bool, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		migrated := false
+		watchCtx, cancel := withTimeout(ctx)
+		err := client.Watch(watchCtx, func(tx *redis.Tx) error {
+			raw, err := tx.Get(watchCtx, key).Bytes()
+			if err != nil {
+				return err
+			}
+			envelope, err := parseRecord(raw)
+			if err != nil {
+				return fmt.Errorf("%w: %w", errInvalidRecord, err)
+			}
+			if !recordNeedsRewrite(prefix, envelope) {
+				return nil
+			}
+			migrated = true
+			if dryRun {
+				return nil
+			}
+
+			id, _ := redisKeyID(prefix, key)
+			data, err := decodeRecord(ctx, prefix, id, raw)
+			if err != nil {
+				return fmt.Errorf("%w: %w", errInvalidRecord, err)
+			}
+			encoded, err := encodeRecordData(ctx, prefix, id, data)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(watchCtx, func(pipe redis.Pipeliner) error {
+				pipe.Set(watchCtx, key, encoded, redis.KeepTTL)
+				return nil
+			})
+			return err
+		}, key)
+		cancel()
+
+		switch {
+		case errors.Is(err, redis.TxFailedErr):
+			continue
+		case errors.Is(err, redis.Nil):
+			// 走査中に削除された (有効期限切れを含む)
+			return false, nil
+		case errors.Is(err, errInvalidRecord):
+			return false, err
+		case err != nil:
+			return false, storeError(err)
+		}
+		return migrated, nil
+	}
+	return false, fmt.Errorf("%w: %s was modified concurrently", ErrConflict, key)
+}
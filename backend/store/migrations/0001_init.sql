@@ -0,0 +1,29 @@
+-- ユーザーアカウント
+CREATE TABLE users (
+    id         TEXT PRIMARY KEY,
+    email      TEXT NOT NULL UNIQUE,
+    data       JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- ペアワイズ識別子と内部のユーザーIDの対応
+CREATE TABLE pairwise_subjects (
+    subject TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- OAuthクライアントの登録情報
+CREATE TABLE clients (
+    client_id  TEXT PRIMARY KEY,
+    data       JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- サーバーの鍵 (用途ごとに1つ)
+CREATE TABLE keys (
+    use         TEXT PRIMARY KEY,
+    kid         TEXT NOT NULL UNIQUE,
+    private_key BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,11 @@
+-- email 列を正規化したメールアドレス (store.NormalizeEmail) に変換する
+-- 大文字・小文字や Unicode の表記の違いで別のユーザーが作成されないようにするため
+-- 正規化すると別のユーザーと重複する行は変換しないため、該当するユーザーは手動で統合してください
+UPDATE users u
+SET email = lower(normalize(btrim(u.email), NFKC))
+WHERE u.email <> lower(normalize(btrim(u.email), NFKC))
+  AND NOT EXISTS (
+    SELECT 1 FROM users o
+    WHERE o.id <> u.id
+      AND lower(normalize(btrim(o.email), NFKC)) = lower(normalize(btrim(u.email), NFKC))
+  );
@@ -0,0 +1,5 @@
+-- サーバーの秘密鍵をレコードの形式 (store/record.go) で保存する列を追加する
+-- KMS が設定されている場合、秘密鍵は KEK で暗号化したデータキーで暗号化される (store/encryption.go)
+-- 既存の行は private_key (平文の PKCS#8) のまま読み出せるため、cmd/migraterecords -store postgres で移行してください
+ALTER TABLE keys ADD COLUMN private_key_record JSONB;
+ALTER TABLE keys ALTER COLUMN private_key DROP NOT NULL;
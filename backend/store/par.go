@@ -0,0 +1,19 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"time"
+)
+
+// SavePushedAuthorizationRequest PARで受け付けた認可リクエストを保存します
+// request_uri は秘密の値として扱い、ダイジェストをキーにします (secret.go)
+func (s *RedisStore) SavePushedAuthorizationRequest(ctx context.Context, requestURI string, request model.AuthorizationRequest, expiration time.Duration) error {
+	return SaveSession(ctx, "par_request", secretID(requestURI), request, expiration)
+}
+
+// ConsumePushedAuthorizationRequest PARで受け付けた認可リクエストを取得し、同時に削除します
+// request_uri は一度だけ使用できるため、GETDEL で取得と削除を不可分に行います (RFC 9126 Section 4)
+func (s *RedisStore) ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*model.AuthorizationRequest, error) {
+	return consumeSession[model.AuthorizationRequest](ctx, "par_request", secretID(requestURI))
+}
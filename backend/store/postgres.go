@@ -0,0 +1,573 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore PostgreSQL を保存先とするリポジトリ
+// ユーザー・クライアント・鍵など、失われてはならない永続データを保存します
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+//go:embed migrations/*.sql
+var postgresMigrations embed.FS
+
+// OpenPostgres PostgreSQL に接続し、未適用のマイグレーションを適用します
+func OpenPostgres(databaseURL string) (*PostgresStore, error) {
+	if databaseURL == "" {
+		return nil, errors.New("DATABASE_URL environment variable is not set")
+	}
+	if err := loadRecordSettings(); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+
+	s := &PostgresStore{pool: pool}
+	if err := s.Migrate(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close 接続を閉じます
+func (s *PostgresStore) Close() {
+	s.pool.Close()
+}
+
+// Migrate migrations ディレクトリのSQLをファイル名の順に適用します
+// 適用済みのバージョンは schema_migrations に記録し、複数のインスタンスが同時に起動しても一度だけ適用されるように
+// アドバイザリロックを取得した1つのトランザクションで実行します
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	files, err := fs.Glob(postgresMigrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`); err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			var applied bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, file).Scan(&applied); err != nil {
+				return err
+			}
+			if applied {
+				continue
+			}
+
+			migration, err := postgresMigrations.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, string(migration)); err != nil {
+				return fmt.Errorf("failed to apply migration %s: %w", file, err)
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, file); err != nil {
+				return err
+			}
+			log.Printf("Applied migration: %s", file)
+		}
+		return nil
+	})
+}
+
+// ユーザーIDからユーザー情報を取得する
+func (s *PostgresStore) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return s.queryUser(ctx, `SELECT id, data FROM users WHERE id = $1`, userID)
+}
+
+// メールアドレスからユーザー情報を取得する
+// email 列には Redis のインデックスと同じID (KMS が設定されている場合はブラインドインデックス) を保存する
+// 見つからない場合は、ブラインドインデックスを導入する前の形式 (正規化したメールアドレス) の行を参照する
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	indexID, err := emailIndexID(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range append([]string{indexID}, legacyEmailIndexIDs(email)...) {
+		user, err := s.queryUser(ctx, `SELECT id, data FROM users WHERE email = $1`, id)
+		if !errors.Is(err, ErrNotFound) {
+			return user, err
+		}
+	}
+	return nil, notFound("user for email")
+}
+
+func (s *PostgresStore) queryUser(ctx context.Context, query string, arg string) (*model.User, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var userID string
+	var data []byte
+	if err := s.pool.QueryRow(ctx, query, arg).Scan(&userID, &data); err != nil {
+		return nil, storeError(err)
+	}
+	return unmarshalRecord[model.User](ctx, "user", userID, data)
+}
+
+// ユーザーを登録または取得する
+// email 列の一意制約により、同時に登録された場合も作成されるユーザーは1人になる
+// 以前の形式の行で登録済みのユーザーを重複して作成しないよう、先に以前の形式も含めて確認する
+func (s *PostgresStore) GetOrCreateUser(ctx context.Context, email string) (*model.User, error) {
+	existing, err := s.GetUserByEmail(ctx, email)
+	if !errors.Is(err, ErrNotFound) {
+		return existing, err
+	}
+
+	indexID, err := emailIndexID(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	newUserID, err := generateUserID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user := model.User{
+		ID:        newUserID,
+		Email:     strings.TrimSpace(email),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	data, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	insertCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	if _, err := s.pool.Exec(insertCtx,
+		`INSERT INTO users (id, email, data, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (email) DO NOTHING`,
+		user.ID, indexID, data, now); err != nil {
+		return nil, storeError(err)
+	}
+	return s.GetUserByEmail(ctx, email)
+}
+
+// ユーザー情報を更新する
+// 以前の形式の行も、現在の形式 (暗号化とブラインドインデックス) で保存し直す
+func (s *PostgresStore) UpdateUser(ctx context.Context, user model.User) error {
+	data, indexID, err := encodeUserRow(ctx, user)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE users SET email = $2, data = $3, updated_at = $4 WHERE id = $1`,
+		user.ID, indexID, data, user.UpdatedAt)
+	if err != nil {
+		return storeError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("user %s", user.ID)
+	}
+	return nil
+}
+
+// ユーザー情報を変更する
+// SELECT ... FOR UPDATE で行をロックし、読み出してから保存するまでの他の変更を待たせる
+func (s *PostgresStore) ModifyUser(ctx context.Context, userID string, update func(*model.User) error) (*model.User, error) {
+	var user model.User
+	// 保存先以外のエラー (レコードの変換や update のエラー)
+	var recordErr error
+	txCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	err := pgx.BeginFunc(txCtx, s.pool, func(tx pgx.Tx) error {
+		var data []byte
+		if err := tx.QueryRow(txCtx, `SELECT data FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&data); err != nil {
+			return err
+		}
+		stored, err := unmarshalRecord[model.User](ctx, "user", userID, data)
+		if err != nil {
+			recordErr = err
+			return err
+		}
+		user = *stored
+		if recordErr = update(&user); recordErr != nil {
+			return recordErr
+		}
+		data, indexID, err := encodeUserRow(ctx, user)
+		if err != nil {
+			recordErr = err
+			return err
+		}
+		_, err = tx.Exec(txCtx,
+			`UPDATE users SET email = $2, data = $3, updated_at = $4 WHERE id = $1`,
+			userID, indexID, data, user.UpdatedAt)
+		return err
+	})
+	if recordErr != nil {
+		return nil, recordErr
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &user, nil
+}
+
+// encodeUserRow ユーザー情報を users テーブルに保存する形式 (data 列と email 列の値) に変換する
+func encodeUserRow(ctx context.Context, user model.User) ([]byte, string, error) {
+	data, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		return nil, "", err
+	}
+	indexID, err := emailIndexID(ctx, user.Email)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, indexID, nil
+}
+
+// SavePairwiseSubject ペアワイズ識別子から内部のユーザーIDを引けるように保存する
+func (s *PostgresStore) SavePairwiseSubject(ctx context.Context, subject string, userID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO pairwise_subjects (subject, user_id) VALUES ($1, $2)
+		ON CONFLICT (subject) DO UPDATE SET user_id = EXCLUDED.user_id`,
+		subject, userID)
+	return storeError(err)
+}
+
+// ペアワイズ識別子から内部のユーザーIDを取得する
+// ペアワイズ識別子として発行されていない場合は空文字を返す
+func (s *PostgresStore) GetUserIDByPairwiseSubject(ctx context.Context, subject string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var userID string
+	err := s.pool.QueryRow(ctx, `SELECT user_id FROM pairwise_subjects WHERE subject = $1`, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return userID, storeError(err)
+}
+
+// クライアントIDから登録済みのクライアントを取得する
+func (s *PostgresStore) GetClient(ctx context.Context, clientID string) (*model.Client, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	var data []byte
+	if err := s.pool.QueryRow(ctx, `SELECT data FROM clients WHERE client_id = $1`, clientID).Scan(&data); err != nil {
+		return nil, storeError(err)
+	}
+	return unmarshalClient(data)
+}
+
+// 登録済みのクライアントをすべて取得する
+func (s *PostgresStore) ListClients(ctx context.Context) ([]model.Client, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT data FROM clients ORDER BY client_id`)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer rows.Close()
+
+	clients := []model.Client{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, storeError(err)
+		}
+		client, err := unmarshalClient(data)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, storeError(rows.Err())
+}
+
+// クライアントを登録する (同じクライアントIDの登録は置き換える)
+func (s *PostgresStore) SaveClient(ctx context.Context, client model.Client) error {
+	data, err := marshalClient(client)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = s.pool.Exec(ctx,
+		`INSERT INTO clients (client_id, data, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (client_id) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		client.ClientID, data)
+	return storeError(err)
+}
+
+// 用途ごとの鍵を取得し、未登録の場合は登録する
+// 秘密鍵はレコードの形式で private_key_record 列に保存する (KMS が設定されている場合は暗号化する)
+func (s *PostgresStore) GetOrCreateKey(ctx context.Context, key model.Key) (*model.Key, error) {
+	record, err := encodeRecord(ctx, "key", key.Use, key)
+	if err != nil {
+		return nil, err
+	}
+	queryCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	if _, err := s.pool.Exec(queryCtx,
+		`INSERT INTO keys (use, kid, private_key_record, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (use) DO NOTHING`,
+		key.Use, key.KeyID, record, key.CreatedAt); err != nil {
+		return nil, storeError(err)
+	}
+
+	stored, _, err := scanKey(ctx, s.pool.QueryRow(queryCtx,
+		`SELECT use, kid, private_key, private_key_record, created_at FROM keys WHERE use = $1`, key.Use))
+	return stored, err
+}
+
+// scanKey keys テーブルの行から鍵を読み出します
+// private_key_record 列のない行 (移行前の行) は private_key 列の平文の秘密鍵を使用します
+// 2つ目の戻り値は、行を現在の形式で保存し直す必要があるか (MigrateRecords) です
+func scanKey(ctx context.Context, row pgx.Row) (*model.Key, bool, error) {
+	var key model.Key
+	var record []byte
+	if err := row.Scan(&key.Use, &key.KeyID, &key.PrivateKey, &record, &key.CreatedAt); err != nil {
+		return nil, false, storeError(err)
+	}
+	if record == nil {
+		return &key, true, nil
+	}
+	envelope, err := parseRecord(record)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", errInvalidRecord, err)
+	}
+	stored, err := unmarshalRecord[model.Key](ctx, "key", key.Use, record)
+	if err != nil {
+		return nil, false, err
+	}
+	return stored, recordNeedsRewrite("key", envelope), nil
+}
+
+// MigrateRecords users テーブルのユーザー情報と keys テーブルの鍵を現在の形式で保存し直します (cmd/migraterecords)
+// 古いバージョンや暗号化されていない行、現在の鍵 (KEK) 以外で暗号化された行のほか、
+// email 列が現在の形式のインデックスでないユーザーと、private_key 列に平文の秘密鍵が残っている鍵が対象です
+// 行ごとに SELECT ... FOR UPDATE でロックして書き換えるため、サービスを止めずに実行できます
+// 進捗は保存しないため、中断した場合は最初から走査し直します (書き換え済みの行は書き換えません)
+func (s *PostgresStore) MigrateRecords(ctx context.Context, options RecordMigrationOptions) ([]RecordMigrationStats, error) {
+	if writeLegacyRecords && !options.DryRun {
+		return nil, errors.New("STORE_LEGACY_RECORD_FORMAT is enabled; records cannot be migrated yet")
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+
+	results := make([]RecordMigrationStats, 0, 2)
+	stats, err := s.migrateUsers(ctx, options)
+	results = append(results, stats)
+	if err != nil {
+		return results, err
+	}
+	stats, err = s.migrateKeys(ctx, options)
+	results = append(results, stats)
+	return results, err
+}
+
+// migrateUsers users テーブルの行を ID の順に走査して保存し直します
+func (s *PostgresStore) migrateUsers(ctx context.Context, options RecordMigrationOptions) (RecordMigrationStats, error) {
+	stats := RecordMigrationStats{Prefix: "user"}
+	lastID := ""
+	for {
+		userIDs, err := s.userIDsAfter(ctx, lastID, options.BatchSize)
+		if err != nil {
+			return stats, err
+		}
+		if len(userIDs) == 0 {
+			return stats, nil
+		}
+		for _, userID := range userIDs {
+			migrated, err := s.migrateUser(ctx, userID, options.DryRun)
+			invalid := errors.Is(err, errInvalidRecord)
+			if err != nil && !invalid {
+				return stats, err
+			}
+			if invalid {
+				log.Printf("Skipped invalid user %s: %v", userID, err)
+				stats.Invalid++
+			}
+			stats.Scanned++
+			if migrated {
+				stats.Migrated++
+			}
+		}
+		lastID = userIDs[len(userIDs)-1]
+	}
+}
+
+// migrateKeys keys テーブルの行を保存し直します (用途ごとに1行のため、まとめて走査します)
+func (s *PostgresStore) migrateKeys(ctx context.Context, options RecordMigrationOptions) (RecordMigrationStats, error) {
+	stats := RecordMigrationStats{Prefix: "key"}
+	queryCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.pool.Query(queryCtx, `SELECT use FROM keys ORDER BY use`)
+	if err != nil {
+		return stats, storeError(err)
+	}
+	uses, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return stats, storeError(err)
+	}
+	for _, use := range uses {
+		migrated, err := s.migrateKey(ctx, use, options.DryRun)
+		invalid := errors.Is(err, errInvalidRecord)
+		if err != nil && !invalid {
+			return stats, err
+		}
+		if invalid {
+			log.Printf("Skipped invalid key %s: %v", use, err)
+			stats.Invalid++
+		}
+		stats.Scanned++
+		if migrated {
+			stats.Migrated++
+		}
+	}
+	return stats, nil
+}
+
+// migrateKey 1つの鍵の行を現在の形式で保存し直し、private_key 列の平文の秘密鍵を削除します
+func (s *PostgresStore) migrateKey(ctx context.Context, use string, dryRun bool) (bool, error) {
+	migrated := false
+	// 保存先以外のエラー (レコードの変換のエラー)
+	var recordErr error
+	txCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	err := pgx.BeginFunc(txCtx, s.pool, func(tx pgx.Tx) error {
+		key, needsRewrite, err := scanKey(ctx, tx.QueryRow(txCtx,
+			`SELECT use, kid, private_key, private_key_record, created_at FROM keys WHERE use = $1 FOR UPDATE`, use))
+		if errors.Is(err, ErrNotFound) {
+			// 走査中に削除された
+			return pgx.ErrNoRows
+		}
+		if err != nil {
+			// scanKey は保存先のエラーも変換して返す
+			recordErr = err
+			return err
+		}
+		if !needsRewrite {
+			return nil
+		}
+		migrated = true
+		if dryRun {
+			return nil
+		}
+		record, err := encodeRecord(ctx, "key", key.Use, key)
+		if err != nil {
+			recordErr = err
+			return err
+		}
+		_, err = tx.Exec(txCtx, `UPDATE keys SET private_key = NULL, private_key_record = $2 WHERE use = $1`, use, record)
+		return err
+	})
+
+	switch {
+	case recordErr != nil:
+		return false, recordErr
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, storeError(err)
+	}
+	return migrated, nil
+}
+
+// userIDsAfter lastID より後のユーザーIDを ID の順に最大 limit 件返します
+func (s *PostgresStore) userIDsAfter(ctx context.Context, lastID string, limit int64) ([]string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT id FROM users WHERE id > $1 ORDER BY id LIMIT $2`, lastID, limit)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	userIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	return userIDs, storeError(err)
+}
+
+// migrateUser 1人のユーザーの行を現在の形式で保存し直します
+// 別のユーザーが同じメールアドレスのインデックスで登録済みの場合 (重複したユーザー) は、手動で統合するため書き換えません
+func (s *PostgresStore) migrateUser(ctx context.Context, userID string, dryRun bool) (bool, error) {
+	migrated := false
+	// 保存先以外のエラー (レコードの変換のエラー)
+	var recordErr error
+	txCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	err := pgx.BeginFunc(txCtx, s.pool, func(tx pgx.Tx) error {
+		var data []byte
+		var email string
+		if err := tx.QueryRow(txCtx, `SELECT data, email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&data, &email); err != nil {
+			return err
+		}
+		envelope, err := parseRecord(data)
+		if err != nil {
+			recordErr = fmt.Errorf("%w: %w", errInvalidRecord, err)
+			return recordErr
+		}
+		user, err := unmarshalRecord[model.User](ctx, "user", userID, data)
+		if err != nil {
+			recordErr = fmt.Errorf("%w: %w", errInvalidRecord, err)
+			return recordErr
+		}
+		indexID, err := emailIndexID(ctx, user.Email)
+		if err != nil {
+			recordErr = err
+			return err
+		}
+		if !recordNeedsRewrite("user", envelope) && email == indexID {
+			return nil
+		}
+		migrated = true
+		if dryRun {
+			return nil
+		}
+		encoded, err := encodeRecord(ctx, "user", userID, user)
+		if err != nil {
+			recordErr = err
+			return err
+		}
+		_, err = tx.Exec(txCtx, `UPDATE users SET email = $2, data = $3 WHERE id = $1`, userID, indexID, encoded)
+		return err
+	})
+
+	switch {
+	case recordErr != nil:
+		return false, recordErr
+	case errors.Is(err, pgx.ErrNoRows):
+		// 走査中に削除された
+		return false, nil
+	case errors.Is(storeError(err), ErrConflict):
+		return false, fmt.Errorf("%w: another user has the same email index: %w", errInvalidRecord, err)
+	case err != nil:
+		return false, storeError(err)
+	}
+	return migrated, nil
+}
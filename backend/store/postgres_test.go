@@ -0,0 +1,25 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"backend/store"
+)
+
+// TestPostgresStore PostgreSQL の実装に共通のテストスイート (store/storetest) を実行します
+// DATABASE_URL が設定されている場合のみ実行します
+// PostgreSQL は永続データのみに対応しているため、ユーザー・クライアント・鍵のリポジトリのみを検証します
+// (セッション・認可コード・トークンは Redis またはメモリに保存します)
+func TestPostgresStore(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	s, err := store.OpenPostgres(databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to initialize PostgreSQL: %v", err)
+	}
+	t.Cleanup(s.Close)
+	testRepositories(t, &store.Repositories{Users: s, Clients: s, Keys: s})
+}
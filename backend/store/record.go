@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Redis に JSON で保存するレコードの形式
+// PostgreSQL のユーザー情報 (users テーブルの data 列) とサーバーの鍵 (keys テーブルの private_key_record 列) も同じ形式で保存します
+//
+// レコードは {"v": バージョン, "data": 本体} のエンベロープで保存し、読み出し時にバージョンを確認します
+// エンベロープのないレコード (導入前に保存されたもの) はバージョン 0 として扱います
+//
+// 項目の追加だけであれば、バージョンを上げる必要はありません (古いインスタンスは未知の項目を無視します)
+// 項目の名前や型を変更する場合は currentRecordVersion を上げ、recordUpgrades に旧バージョンからの変換を追加します
+// 保存済みのレコードは読み出し時に変換されるほか、cmd/migraterecords でまとめて書き換えられます
+//
+// エンベロープを読めないインスタンスが残っている間 (導入時のローリングデプロイ中) は、
+// STORE_LEGACY_RECORD_FORMAT=true でエンベロープなしの形式で保存してください
+const currentRecordVersion = 2
+
+// recordEnvelope バージョン付きのレコード
+// 暗号化するレコード (encryption.go) は本体 (data) の代わりに暗号文 (enc) を保存します
+type recordEnvelope struct {
+	Version   int              `json:"v"`
+	Data      json.RawMessage  `json:"data,omitempty"`
+	Encrypted *encryptedRecord `json:"enc,omitempty"`
+}
+
+// recordUpgrade あるバージョンのレコードの本体を次のバージョンの本体に変換します
+type recordUpgrade func(data json.RawMessage) (json.RawMessage, error)
+
+// recordUpgrades prefix ごとの変換 (キーは変換前のバージョン)
+// バージョン 0 から 1 はエンベロープの有無のみの違いのため、変換はありません
+var recordUpgrades = map[string]map[int]recordUpgrade{
+	"token_session": {
+		// バージョン 2 でリフレッシュトークンそのもの (refresh_token) を保存しないようにした (secret.go)
+		1: removeRecordFields("refresh_token"),
+	},
+}
+
+// versionedRecordPrefixes エンベロープで保存するレコードの prefix (cmd/migraterecords の対象)
+var versionedRecordPrefixes = []string{
+	"auth_session",
+	"authorize_session",
+	"client",
+	"device_session",
+	"key",
+	"par_request",
+	"token_session",
+	"user",
+	"userinfo_claims",
+}
+
+// writeLegacyRecords エンベロープなしの形式で保存するか (STORE_LEGACY_RECORD_FORMAT)
+var writeLegacyRecords bool
+
+// loadRecordSettings レコードの保存形式と暗号化の設定を環境変数から読み込みます
+// Redis と PostgreSQL のどちらに保存するレコードにも同じ設定を使用するため、InitRedis と OpenPostgres から呼び出します
+//
+//   - STORE_LEGACY_RECORD_FORMAT: true の場合、レコードをバージョンのエンベロープなしで保存する
+//   - STORE_ENCRYPTION_KEY_FILE: LocalKMS の鍵ファイル。指定した場合、ユーザー情報とサーバーの鍵を暗号化する (encryption.go)
+//
+// 以前の名前 (REDIS_LEGACY_RECORD_FORMAT / REDIS_ENCRYPTION_KEY_FILE) も使用できます
+func loadRecordSettings() error {
+	writeLegacyRecords = envWithFallback("STORE_LEGACY_RECORD_FORMAT", "REDIS_LEGACY_RECORD_FORMAT") == "true"
+	keyFile := envWithFallback("STORE_ENCRYPTION_KEY_FILE", "REDIS_ENCRYPTION_KEY_FILE")
+	if keyFile == "" {
+		log.Println("Warning: STORE_ENCRYPTION_KEY_FILE is not set; user records and server private keys are stored unencrypted")
+		return nil
+	}
+	if writeLegacyRecords {
+		// エンベロープなしの形式では暗号化したレコードを保存できない
+		return fmt.Errorf("STORE_ENCRYPTION_KEY_FILE cannot be used with STORE_LEGACY_RECORD_FORMAT")
+	}
+	if recordKMS != nil {
+		// 他の保存先の初期化で読み込み済み
+		return nil
+	}
+	kms, err := NewLocalKMS(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption key file: %w", err)
+	}
+	SetKMS(kms)
+	return nil
+}
+
+// envWithFallback 環境変数の値を返します。未設定の場合は以前の名前の環境変数の値を返します
+func envWithFallback(name string, legacyName string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(legacyName)
+}
+
+// recordKey レコードのキー (prefix:id) を返します
+// 暗号化したレコードの追加認証データに使用するため、Redis の Cluster モードのハッシュタグは含めず、保存先によらず同じ値にします
+func recordKey(prefix string, id string) string {
+	return prefix + ":" + id
+}
+
+// encodeRecord レコードを現在のバージョンのエンベロープで保存する形式に変換します
+// id は保存先のキーのID (ユーザーIDや鍵の用途) です
+func encodeRecord(ctx context.Context, prefix string, id string, value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRecordData(ctx, prefix, id, data)
+}
+
+// encodeRecordData 現在のバージョンのレコードの本体をエンベロープで保存する形式に変換します
+// 暗号化の対象のレコードは、KMS が設定されている場合に暗号化します
+func encodeRecordData(ctx context.Context, prefix string, id string, data json.RawMessage) ([]byte, error) {
+	if writeLegacyRecords {
+		return data, nil
+	}
+	envelope := recordEnvelope{Version: currentRecordVersion, Data: data}
+	if encryptsRecord(prefix) {
+		encrypted, err := encryptRecord(ctx, recordKey(prefix, id), data)
+		if err != nil {
+			return nil, err
+		}
+		envelope = recordEnvelope{Version: currentRecordVersion, Encrypted: encrypted}
+	}
+	return json.Marshal(envelope)
+}
+
+// decodeRecord 保存されたレコードの本体を現在のバージョンに変換して返します
+// 現在より新しいバージョン (ローリングデプロイ中に新しいインスタンスが保存したもの) は、そのまま返します
+func decodeRecord(ctx context.Context, prefix string, id string, raw []byte) (json.RawMessage, error) {
+	envelope, err := parseRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+	data, err := openRecord(ctx, prefix, id, envelope)
+	if err != nil {
+		return nil, err
+	}
+	for version := envelope.Version; version < currentRecordVersion; version++ {
+		upgrade, ok := recordUpgrades[prefix][version]
+		if !ok {
+			continue
+		}
+		if data, err = upgrade(data); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s record from version %d: %w", prefix, version, err)
+		}
+	}
+	return data, nil
+}
+
+// parseRecord 保存されたレコードのエンベロープを返します
+// エンベロープ導入前の形式は、バージョン 0 の本体として返します
+func parseRecord(raw []byte) (recordEnvelope, error) {
+	var envelope recordEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return recordEnvelope{}, err
+	}
+	if envelope.Version == 0 || (envelope.Data == nil && envelope.Encrypted == nil) {
+		return recordEnvelope{Data: raw}, nil
+	}
+	return envelope, nil
+}
+
+// openRecord エンベロープの本体を返します (暗号化されている場合は復号します)
+func openRecord(ctx context.Context, prefix string, id string, envelope recordEnvelope) (json.RawMessage, error) {
+	if envelope.Encrypted != nil {
+		return decryptRecord(ctx, prefix, id, envelope.Encrypted)
+	}
+	return envelope.Data, nil
+}
+
+// recordNeedsRewrite レコードを現在の形式で保存し直す必要があるか
+// 古いバージョンのほか、暗号化の対象で平文のままのレコードや、現在の鍵で暗号化されていないレコード、
+// レコードのキーを追加認証データにしていないレコードが該当します
+func recordNeedsRewrite(prefix string, envelope recordEnvelope) bool {
+	if envelope.Version < currentRecordVersion {
+		return true
+	}
+	if !encryptsRecord(prefix) {
+		return false
+	}
+	return envelope.Encrypted == nil || envelope.Encrypted.KeyID != recordKMS.CurrentKeyID() || !envelope.Encrypted.RecordKeyBound
+}
+
+// unmarshalRecord 保存されたレコードを現在のバージョンに変換して読み出します
+func unmarshalRecord[T any](ctx context.Context, prefix string, id string, raw []byte) (*T, error) {
+	data, err := decodeRecord(ctx, prefix, id, raw)
+	if err != nil {
+		return nil, err
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// removeRecordFields レコードの本体から項目を削除する変換を返します
+func removeRecordFields(names ...string) recordUpgrade {
+	return func(data json.RawMessage) (json.RawMessage, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			delete(fields, name)
+		}
+		return json.Marshal(fields)
+	}
+}
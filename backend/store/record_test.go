@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "version 0 token session drops refresh token",
+			prefix: "token_session",
+			raw:    `{"user_id":"u1","refresh_token":"rt"}`,
+			want:   `{"user_id":"u1"}`,
+		},
+		{
+			name:   "version 1 token session drops refresh token",
+			prefix: "token_session",
+			raw:    `{"v":1,"data":{"user_id":"u1","refresh_token":"rt"}}`,
+			want:   `{"user_id":"u1"}`,
+		},
+		{
+			name:   "current version is returned as is",
+			prefix: "token_session",
+			raw:    `{"v":2,"data":{"user_id":"u1","refresh_token":"rt"}}`,
+			want:   `{"user_id":"u1","refresh_token":"rt"}`,
+		},
+		{
+			name:   "newer version is returned as is",
+			prefix: "token_session",
+			raw:    `{"v":3,"data":{"user_id":"u1","renamed":"x"}}`,
+			want:   `{"user_id":"u1","renamed":"x"}`,
+		},
+		{
+			name:   "version 0 without upgrades",
+			prefix: "client",
+			raw:    `{"client_id":"c1"}`,
+			want:   `{"client_id":"c1"}`,
+		},
+		{
+			name:   "version 1 without upgrades",
+			prefix: "client",
+			raw:    `{"v":1,"data":{"client_id":"c1","refresh_token":"kept"}}`,
+			want:   `{"client_id":"c1","refresh_token":"kept"}`,
+		},
+		{
+			name:   "legacy record with a v field is not an envelope",
+			prefix: "client",
+			raw:    `{"v":1,"client_id":"c1"}`,
+			want:   `{"v":1,"client_id":"c1"}`,
+		},
+		{
+			name:    "invalid json",
+			prefix:  "client",
+			raw:     `{"v":`,
+			wantErr: true,
+		},
+		{
+			name:    "upgrade of a non-object body",
+			prefix:  "token_session",
+			raw:     `{"v":1,"data":"not an object"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeRecord(context.Background(), tt.prefix, "id", []byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestEncodeRecord(t *testing.T) {
+	ctx := context.Background()
+	value := map[string]string{"client_id": "c1"}
+
+	encoded, err := encodeRecord(ctx, "client", "c1", value)
+	if err != nil {
+		t.Fatalf("encodeRecord() error = %v", err)
+	}
+	assertJSONEqual(t, encoded, `{"v":2,"data":{"client_id":"c1"}}`)
+
+	// ローリングデプロイ中はエンベロープなしで保存し、どちらの形式も読み出せる
+	setLegacyRecordFormat(t, true)
+	legacy, err := encodeRecord(ctx, "client", "c1", value)
+	if err != nil {
+		t.Fatalf("encodeRecord() (legacy) error = %v", err)
+	}
+	assertJSONEqual(t, legacy, `{"client_id":"c1"}`)
+	for _, raw := range [][]byte{encoded, legacy} {
+		decoded, err := unmarshalRecord[map[string]string](ctx, "client", "c1", raw)
+		if err != nil {
+			t.Fatalf("unmarshalRecord(%s) error = %v", raw, err)
+		}
+		if (*decoded)["client_id"] != "c1" {
+			t.Errorf("unmarshalRecord(%s) = %v", raw, *decoded)
+		}
+	}
+}
+
+func TestRecordNeedsRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		envelope recordEnvelope
+		want     bool
+	}{
+		{name: "version 0", prefix: "client", envelope: recordEnvelope{Data: json.RawMessage(`{}`)}, want: true},
+		{name: "version 1", prefix: "client", envelope: recordEnvelope{Version: 1, Data: json.RawMessage(`{}`)}, want: true},
+		{name: "current version", prefix: "client", envelope: recordEnvelope{Version: currentRecordVersion, Data: json.RawMessage(`{}`)}},
+		{name: "newer version", prefix: "client", envelope: recordEnvelope{Version: currentRecordVersion + 1, Data: json.RawMessage(`{}`)}},
+		{name: "plaintext user without KMS", prefix: "user", envelope: recordEnvelope{Version: currentRecordVersion, Data: json.RawMessage(`{}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recordNeedsRewrite(tt.prefix, tt.envelope); got != tt.want {
+				t.Errorf("recordNeedsRewrite() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// setLegacyRecordFormat テストの間だけ STORE_LEGACY_RECORD_FORMAT の設定を変更します
+func setLegacyRecordFormat(t *testing.T, legacy bool) {
+	t.Helper()
+	previous := writeLegacyRecords
+	writeLegacyRecords = legacy
+	t.Cleanup(func() { writeLegacyRecords = previous })
+}
+
+// assertJSONEqual JSON として同じ値か (項目の順序は比較しない) を確認します
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid json %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid json %s: %v", want, err)
+	}
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
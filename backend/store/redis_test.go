@@ -0,0 +1,22 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"backend/store"
+)
+
+// TestRedisStore Redis の実装に共通のテストスイート (store/storetest) を実行します
+// REDIS_ADDR が設定されている場合のみ実行します (接続の設定は InitRedis と同じ環境変数で指定します)
+// 乱数のIDでデータを作成するため、本番とは別の検証用の Redis を指定してください
+func TestRedisStore(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	if err := store.InitRedis(); err != nil {
+		t.Fatalf("Failed to initialize Redis: %v", err)
+	}
+	s := &store.RedisStore{}
+	testRepositories(t, &store.Repositories{Users: s, Clients: s, Sessions: s, Codes: s, Tokens: s, Keys: s})
+}
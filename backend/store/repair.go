@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// UserIndexIssue Redis のユーザー情報 (user:*) とメールアドレスのインデックス (user_email:*) の不整合
+type UserIndexIssue struct {
+	User model.User
+	// IndexedUserID 現在の形式のインデックス (KMS が設定されている場合はブラインドインデックス) が指すユーザーID (インデックスがない場合は空)
+	IndexedUserID string
+	// LegacyIndex 以前の形式 (平文や正規化前のメールアドレス) のインデックスが残っており、このユーザーを指しているか
+	LegacyIndex bool
+}
+
+// Orphaned インデックスが別のユーザーを指しており、ログインで到達できないユーザーか
+// 正規化を導入する前に同時に作成されたユーザーや、大文字・小文字だけが異なるメールアドレスで作成されたユーザーが該当します
+func (i UserIndexIssue) Orphaned() bool {
+	return i.IndexedUserID != "" && i.IndexedUserID != i.User.ID
+}
+
+// FindUserIndexIssues すべてのユーザー情報を走査し、現在の形式のインデックスが自身を指していないユーザーを fn に渡します
+// インデックスがないユーザー (以前の形式のインデックスのみのユーザーを含む) と、以前の形式のインデックスが残っているユーザーも渡します
+func (s *RedisStore) FindUserIndexIssues(ctx context.Context, fn func(ctx context.Context, issue UserIndexIssue) error) error {
+	return scanKeys(ctx, "user:*", func(ctx context.Context, key string) error {
+		getCtx, cancel := withTimeout(ctx)
+		defer cancel()
+		data, err := redisClient.Get(getCtx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// 走査中に削除された
+			return nil
+		}
+		if err != nil {
+			return storeError(err)
+		}
+		userID, _ := redisKeyID("user", key)
+		user, err := unmarshalRecord[model.User](ctx, "user", userID, data)
+		if err != nil {
+			return fmt.Errorf("invalid user %s: %w", key, err)
+		}
+
+		indexID, err := emailIndexID(ctx, user.Email)
+		if err != nil {
+			return err
+		}
+		indexedUserID, err := lookupEmailIndex(ctx, indexID)
+		if err != nil {
+			return err
+		}
+		legacyIndex := false
+		for _, id := range legacyEmailIndexIDs(user.Email) {
+			legacyUserID, err := lookupEmailIndex(ctx, id)
+			if err != nil {
+				return err
+			}
+			legacyIndex = legacyIndex || legacyUserID == user.ID
+		}
+		if indexedUserID == user.ID && !legacyIndex {
+			return nil
+		}
+		return fn(ctx, UserIndexIssue{User: *user, IndexedUserID: indexedUserID, LegacyIndex: legacyIndex})
+	})
+}
+
+// RestoreUserEmailIndex インデックスのないユーザーについて、現在の形式のインデックスを登録し、以前の形式のインデックスを削除します
+// 他のユーザーが先に登録した場合は false を返します
+func (s *RedisStore) RestoreUserEmailIndex(ctx context.Context, user model.User) (bool, error) {
+	indexID, err := emailIndexID(ctx, user.Email)
+	if err != nil {
+		return false, err
+	}
+	setCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	restored, err := redisClient.SetNX(setCtx, redisKey("user_email", emailIndexKeyID(indexID)), user.ID, 0).Result()
+	if err != nil || !restored {
+		return false, storeError(err)
+	}
+	return true, s.DeleteLegacyEmailIndex(ctx, user)
+}
+
+// DeleteLegacyEmailIndex 以前の形式のインデックスのうち、このユーザーを指しているものを削除します
+// ブラインドインデックスの導入後に、平文のメールアドレスを含むキーを残さないために使用します
+func (s *RedisStore) DeleteLegacyEmailIndex(ctx context.Context, user model.User) error {
+	for _, id := range legacyEmailIndexIDs(user.Email) {
+		legacyUserID, err := lookupEmailIndex(ctx, id)
+		if err != nil {
+			return err
+		}
+		if legacyUserID != user.ID {
+			continue
+		}
+		delCtx, cancel := withTimeout(ctx)
+		err = redisClient.Del(delCtx, redisKey("user_email", emailIndexKeyID(id))).Err()
+		cancel()
+		if err != nil {
+			return storeError(err)
+		}
+	}
+	return nil
+}
+
+// DeleteOrphanedUser ログインで到達できないユーザーを削除します
+// 削除する直前にインデックスを確認し、インデックスが指しているユーザーの場合は削除しません
+func (s *RedisStore) DeleteOrphanedUser(ctx context.Context, user model.User) error {
+	indexID, err := emailIndexID(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+	indexedUserID, err := lookupEmailIndex(ctx, indexID)
+	if err != nil {
+		return err
+	}
+	if indexedUserID == "" || indexedUserID == user.ID {
+		return fmt.Errorf("user %s is not orphaned", user.ID)
+	}
+	if err := s.DeleteLegacyEmailIndex(ctx, user); err != nil {
+		return err
+	}
+	return DeleteSession(ctx, "user", userKeyID(user.ID))
+}
+
+// lookupEmailIndex インデックスが指すユーザーIDを返します (インデックスがない場合は空)
+func lookupEmailIndex(ctx context.Context, indexID string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	userID, err := redisClient.Get(ctx, redisKey("user_email", emailIndexKeyID(indexID))).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", storeError(err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"os"
+	"testing"
+)
+
+// 正規化を導入する前に登録時の表記で保存されたインデックスは、repairusers -reindex (RestoreUserEmailIndex) で現在の形式に登録し直す
+// 登録し直した後は、異なる表記で入力したメールアドレスでも以前のユーザーに到達し、新しいユーザーは作成されない
+func TestRestoreUserEmailIndexNormalizesLegacyIndex(t *testing.T) {
+	if os.Getenv("REDIS_ADDR") == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	if err := InitRedis(); err != nil {
+		t.Fatalf("Failed to initialize Redis: %v", err)
+	}
+	ctx := context.Background()
+	s := &RedisStore{}
+
+	userID, err := generateUserID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := "Legacy-" + userID[:8] + "@Example.com"
+	legacy := model.User{ID: userID, Email: email}
+	data, err := encodeRecord(ctx, "user", userID, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redisClient.Set(ctx, redisKey("user", userKeyID(userID)), data, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisClient.Set(ctx, redisKey("user_email", emailIndexKeyID(email)), userID, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		indexID, _ := emailIndexID(ctx, email)
+		redisClient.Del(ctx, redisKey("user", userKeyID(userID)), redisKey("user_email", emailIndexKeyID(email)), redisKey("user_email", emailIndexKeyID(indexID)))
+	})
+
+	restored, err := s.RestoreUserEmailIndex(ctx, legacy)
+	if err != nil || !restored {
+		t.Fatalf("RestoreUserEmailIndex() = %v, %v, want true", restored, err)
+	}
+	if id, err := lookupEmailIndex(ctx, email); err != nil || id != "" {
+		t.Errorf("legacy index = %q, %v, want deleted", id, err)
+	}
+	user, err := s.GetOrCreateUser(ctx, NormalizeEmail(email))
+	if err != nil {
+		t.Fatalf("GetOrCreateUser() error = %v", err)
+	}
+	if user.ID != userID {
+		t.Errorf("GetOrCreateUser() id = %s, want the legacy user %s", user.ID, userID)
+	}
+}
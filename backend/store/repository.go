@@ -0,0 +1,175 @@
+package store
+
+import (
+	"backend/model"
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// UserRepository ユーザーアカウントとペアワイズ識別子の保存先 (永続データ)
+type UserRepository interface {
+	GetUserByID(ctx context.Context, userID string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// メールアドレスのユーザーを取得し、存在しない場合は作成する
+	GetOrCreateUser(ctx context.Context, email string) (*model.User, error)
+	// 存在しないユーザーの場合は ErrNotFound、メールアドレスが他のユーザーと重複する場合は ErrConflict を返す
+	UpdateUser(ctx context.Context, user model.User) error
+	// 保存先の最新のユーザー情報を update で変更して保存する (レプリカからは読み出さない)
+	// 読み出してから保存するまでの他の変更を上書きしない。update がエラーを返した場合は保存せずに返す
+	ModifyUser(ctx context.Context, userID string, update func(*model.User) error) (*model.User, error)
+	SavePairwiseSubject(ctx context.Context, subject string, userID string) error
+	// ペアワイズ識別子として発行されていない場合は空文字を返す
+	GetUserIDByPairwiseSubject(ctx context.Context, subject string) (string, error)
+}
+
+// ClientRepository OAuthクライアントの登録情報の保存先 (永続データ)
+type ClientRepository interface {
+	GetClient(ctx context.Context, clientID string) (*model.Client, error)
+	ListClients(ctx context.Context) ([]model.Client, error)
+	// 同じクライアントIDの登録がある場合は置き換える
+	SaveClient(ctx context.Context, client model.Client) error
+}
+
+// SessionRepository ログインによる認証セッションの保存先 (一時データ)
+// セッションIDそのものは保存せず、ダイジェストをキーにする (認可コード・リフレッシュトークンも同様)
+type SessionRepository interface {
+	// 有効期限はセッションの ExpiresAt に合わせる (既に過ぎている場合は ErrExpired を返す)
+	SaveAuthSession(ctx context.Context, sessionID string, session model.AuthSession) error
+	GetAuthSession(ctx context.Context, sessionID string) (*model.AuthSession, error)
+	DeleteAuthSession(ctx context.Context, sessionID string) error
+}
+
+// CodeRepository 認可コード・PARの request_uri・デバイスコードの保存先 (一時データ)
+type CodeRepository interface {
+	SaveAuthorizeSession(ctx context.Context, sessionID string, session model.AuthorizeSession) error
+	GetAuthorizeSession(ctx context.Context, sessionID string) (*model.AuthorizeSession, error)
+	DeleteAuthorizeSession(ctx context.Context, sessionID string) error
+	SavePushedAuthorizationRequest(ctx context.Context, requestURI string, request model.AuthorizationRequest, expiration time.Duration) error
+	// 取得と同時に削除し、同じ request_uri は一度だけ取得できる
+	ConsumePushedAuthorizationRequest(ctx context.Context, requestURI string) (*model.AuthorizationRequest, error)
+	// 有効期限はセッションの ExpiresAt に合わせる (既に過ぎている場合は ErrExpired を返す)
+	SaveDeviceSession(ctx context.Context, session model.DeviceSession) error
+	GetDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error)
+	GetDeviceSessionByUserCode(ctx context.Context, userCode string) (*model.DeviceSession, error)
+	// 保存済みのセッションを update で変更して保存する (有効期限は変わらない)
+	// 他のリクエストによる変更を上書きしないよう、最新のセッションに対して update を呼び出す (update がエラーを返した場合は保存せずに返す)
+	UpdateDeviceSession(ctx context.Context, deviceCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error)
+	UpdateDeviceSessionByUserCode(ctx context.Context, userCode string, update func(*model.DeviceSession) error) (*model.DeviceSession, error)
+	// 取得と同時に削除し、同じデバイスコードは一度だけ取得できる
+	ConsumeDeviceSession(ctx context.Context, deviceCode string) (*model.DeviceSession, error)
+	DeleteDeviceSession(ctx context.Context, session model.DeviceSession) error
+	// 前回のポーリングから interval が経過していない場合は false を返す
+	MarkDevicePolled(ctx context.Context, deviceCode string, interval time.Duration) (bool, error)
+}
+
+// TokenRepository リフレッシュトークンのセッション、アクセストークンごとの情報と、DPoP証明・リクエストオブジェクトの使用履歴の保存先 (一時データ)
+type TokenRepository interface {
+	// ErrExpired を返せるよう、セッションの ExpiresAt を過ぎた後もしばらく保存しておく
+	SaveTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error
+	// セッションの ExpiresAt を過ぎている場合は、セッションとともに ErrExpired を返す
+	GetTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error)
+	// 既存の有効期限を保持したまま更新する
+	UpdateTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error
+	DeleteTokenSession(ctx context.Context, tokenID string) error
+	// 取得と同時に削除し、同じリフレッシュトークンは一度だけローテーションできる
+	// 他のリクエストが先に使用した場合は ErrNotFound を返す
+	ConsumeTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error)
+	// 同じ鍵・同じ jti の証明が有効期間内に既に使われている場合は false を返す
+	MarkDPoPProofUsed(ctx context.Context, jkt string, jti string, expiration time.Duration) (bool, error)
+	// 同じクライアント・同じ jti のリクエストオブジェクトが有効期間内に既に使われている場合は false を返す
+	MarkRequestObjectUsed(ctx context.Context, clientID string, jti string, expiration time.Duration) (bool, error)
+	// アクセストークン (jti) ごとの UserInfo に対するクレームの要求。保存されていない場合は ErrNotFound を返す
+	SaveUserInfoClaims(ctx context.Context, tokenID string, claims map[string]*model.ClaimRequest, expiration time.Duration) error
+	GetUserInfoClaims(ctx context.Context, tokenID string) (map[string]*model.ClaimRequest, error)
+}
+
+// KeyRepository サーバーの鍵の保存先 (永続データ)
+type KeyRepository interface {
+	// 用途ごとの鍵を取得し、未登録の場合は key を登録する
+	// 複数のインスタンスが同時に登録した場合も、全員が最初に登録された鍵を受け取る
+	GetOrCreateKey(ctx context.Context, key model.Key) (*model.Key, error)
+}
+
+// Repositories ハンドラーが使用するリポジトリ一式
+// いずれのメソッドも ctx がキャンセルされるか、1回の操作の制限時間 (STORE_OPERATION_TIMEOUT) を過ぎると中断し、
+// 見つからない場合 (形式が不正なIDを含む) は ErrNotFound、保存先の障害は ErrUnavailable、制限時間の超過は ErrTimeout を返す
+type Repositories struct {
+	Users    UserRepository
+	Clients  ClientRepository
+	Sessions SessionRepository
+	Codes    CodeRepository
+	Tokens   TokenRepository
+	Keys     KeyRepository
+}
+
+// 保存先の種類
+const (
+	BackendRedis    = "redis"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+// Open 環境変数で指定された保存先に接続し、リポジトリを作成します
+// DURABLE_STORE (redis, postgres, memory) はユーザー・クライアント・鍵の保存先、
+// EPHEMERAL_STORE (redis, memory) はセッション・コード・トークンの保存先で、いずれも省略時は redis です
+// postgres の場合は DATABASE_URL に接続し、未適用のマイグレーションを適用します
+// STORE_OPERATION_TIMEOUT (例: 500ms) で1回の操作の制限時間を変更できます (既定値は2秒)
+func Open() (*Repositories, error) {
+	timeout, err := envDuration("STORE_OPERATION_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		operationTimeout = timeout
+	}
+
+	durable := envOrDefault("DURABLE_STORE", BackendRedis)
+	ephemeral := envOrDefault("EPHEMERAL_STORE", BackendRedis)
+
+	var redisStore *RedisStore
+	if durable == BackendRedis || ephemeral == BackendRedis {
+		if err := InitRedis(); err != nil {
+			return nil, fmt.Errorf("failed to initialize Redis: %w", err)
+		}
+		redisStore = &RedisStore{}
+	}
+	var memoryStore *MemoryStore
+	if durable == BackendMemory || ephemeral == BackendMemory {
+		memoryStore = NewMemoryStore()
+	}
+
+	repos := &Repositories{}
+	switch ephemeral {
+	case BackendRedis:
+		repos.Sessions, repos.Codes, repos.Tokens = redisStore, redisStore, redisStore
+	case BackendMemory:
+		repos.Sessions, repos.Codes, repos.Tokens = memoryStore, memoryStore, memoryStore
+	default:
+		return nil, fmt.Errorf("unsupported EPHEMERAL_STORE: %s", ephemeral)
+	}
+
+	switch durable {
+	case BackendRedis:
+		repos.Users, repos.Clients, repos.Keys = redisStore, redisStore, redisStore
+	case BackendMemory:
+		repos.Users, repos.Clients, repos.Keys = memoryStore, memoryStore, memoryStore
+	case BackendPostgres:
+		postgresStore, err := OpenPostgres(os.Getenv("DATABASE_URL"))
+		if err != nil {
+			return nil, err
+		}
+		repos.Users, repos.Clients, repos.Keys = postgresStore, postgresStore, postgresStore
+	default:
+		return nil, fmt.Errorf("unsupported DURABLE_STORE: %s", durable)
+	}
+	return repos, nil
+}
+
+func envOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
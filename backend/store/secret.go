@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 秘密の値 (リフレッシュトークン・認可コード・認証セッションID・デバイスコード・PARの request_uri) はキーに含めず、SHA-256 のダイジェストをキーにします
+// 保存先やバックアップを読み取れても、キーからセッションを乗っ取ることはできません
+//
+// いずれの値も十分な長さの乱数または署名付きのトークンのため、鍵付きの HMAC ではなく SHA-256 を使用します
+// (鍵のローテーションで既存のセッションが失われることもありません)
+// 提示された値はダイジェストにしてから照合するため、照合にかかる時間から値を推測することもできません
+const secretDigestPrefix = "sha256:"
+
+// secretKeyPrefixes 秘密の値のダイジェストをキーにするレコードの prefix
+var secretKeyPrefixes = []string{"auth_session", "authorize_session", "device_session", "par_request", "token_session"}
+
+// secretID 秘密の値からキーに使用するIDを返します (sha256:<16進数>)
+func secretID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return secretDigestPrefix + hex.EncodeToString(sum[:])
+}
+
+// getSecretRecord 秘密の値のダイジェストをキーとするレコードを取得します
+// 見つからない場合は、ダイジェストを導入する前に秘密の値そのものをキーとして保存されたレコードをダイジェストのキーに移してから取得します
+func getSecretRecord[T any](ctx context.Context, prefix string, secret string) (*T, error) {
+	record, err := GetSession[T](ctx, prefix, secretID(secret))
+	if !errors.Is(err, ErrNotFound) {
+		return record, err
+	}
+	if err := rekeySecretRecord(ctx, prefix, secret); err != nil {
+		return nil, err
+	}
+	return GetSession[T](ctx, prefix, secretID(secret))
+}
+
+// consumeSecretRecord 秘密の値のダイジェストをキーとするレコードを取得し、同時に削除します
+// 見つからない場合は getSecretRecord と同じく、秘密の値そのものをキーとするレコードをダイジェストのキーに移してから取得します
+func consumeSecretRecord[T any](ctx context.Context, prefix string, secret string) (*T, error) {
+	record, err := consumeSession[T](ctx, prefix, secretID(secret))
+	if !errors.Is(err, ErrNotFound) {
+		return record, err
+	}
+	if err := rekeySecretRecord(ctx, prefix, secret); err != nil {
+		return nil, err
+	}
+	return consumeSession[T](ctx, prefix, secretID(secret))
+}
+
+// rekeySecretRecord 秘密の値をキーとするレコードを、有効期限を引き継いでダイジェストのキーに移します
+// 移す前のキーを WATCH し、ダイジェストのキーへの保存と移す前のキーの削除を MULTI でまとめて行います
+// 他のインスタンスが先に移した場合は、その後の更新 (取り消しなど) を上書きしないように既存のレコードを優先します
+// 移すレコードがない場合は ErrNotFound を返します
+//
+// Cluster モードへの対応はダイジェストのキーを導入した後のため、Cluster モードには移すレコードがありません
+// (2つのキーは異なるスロットに配置されるため、MULTI も使用できません)
+func rekeySecretRecord(ctx context.Context, prefix string, secret string) error {
+	if redisClusterMode {
+		return notFound("%s record", prefix)
+	}
+	legacyKey := redisKey(prefix, secret)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		// 保存先以外のエラー (レコードの変換のエラー)
+		var recordErr error
+		watchCtx, cancel := withTimeout(ctx)
+		err := redisClient.Watch(watchCtx, func(tx *redis.Tx) error {
+			raw, err := tx.Get(watchCtx, legacyKey).Bytes()
+			if err != nil {
+				return err
+			}
+			ttl, err := tx.PTTL(watchCtx, legacyKey).Result()
+			if err != nil {
+				return err
+			}
+			if ttl == -2 {
+				// 取得した直後に有効期限が切れた
+				return redis.Nil
+			}
+			if ttl < 0 {
+				ttl = 0 // 有効期限なし
+			}
+			encoded, err := rekeyedRecord(ctx, prefix, secret, raw)
+			if err != nil {
+				recordErr = err
+				return err
+			}
+			_, err = tx.TxPipelined(watchCtx, func(pipe redis.Pipeliner) error {
+				pipe.SetNX(watchCtx, redisKey(prefix, secretID(secret)), encoded, ttl)
+				pipe.Del(watchCtx, legacyKey)
+				return nil
+			})
+			return err
+		}, legacyKey)
+		cancel()
+
+		switch {
+		case recordErr != nil:
+			return recordErr
+		case errors.Is(err, redis.TxFailedErr):
+			continue
+		case err != nil:
+			return storeError(err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s record was modified concurrently", ErrConflict, prefix)
+}
+
+// rekeyedRecord 秘密の値をキーとするレコードを、ダイジェストのキーに保存する形式に変換します
+func rekeyedRecord(ctx context.Context, prefix string, secret string, raw []byte) ([]byte, error) {
+	// 移す前の token_session には値そのもの (refresh_token) も保存されているため、提示された値と定数時間で照合する
+	// (暗号化の対象ではないため、本体はエンベロープから直接読み出せる)
+	legacy, err := parseRecord(raw)
+	if err != nil {
+		return nil, err
+	}
+	var embedded struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if legacy.Data != nil {
+		if err := json.Unmarshal(legacy.Data, &embedded); err != nil {
+			return nil, err
+		}
+	}
+	if embedded.RefreshToken != "" && subtle.ConstantTimeCompare([]byte(embedded.RefreshToken), []byte(secret)) != 1 {
+		return nil, notFound("%s record does not match the presented value", prefix)
+	}
+
+	data, err := decodeRecord(ctx, prefix, recordID(prefix, secret), raw)
+	if err != nil {
+		return nil, err
+	}
+	return encodeRecordData(ctx, prefix, recordID(prefix, secretID(secret)), data)
+}
+
+// deleteSecretRecord 秘密の値のダイジェストをキーとするレコードを削除します
+// 取り消したトークンが使用できないよう、ダイジェストのキーに移す前のレコードも削除します
+func deleteSecretRecord(ctx context.Context, prefix string, secret string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisKey(prefix, secretID(secret)))
+		pipe.Del(ctx, redisKey(prefix, secret))
+		return nil
+	})
+	return storeError(err)
+}
+
+// legacySecretKey キーが秘密の値そのものをキーとするレコード (ダイジェストを導入する前の形式) の場合は、その値を返します
+func legacySecretKey(prefix string, key string) (string, bool) {
+	if !slices.Contains(secretKeyPrefixes, prefix) {
+		return "", false
+	}
+	id, ok := redisKeyID(prefix, key)
+	if !ok {
+		return "", false
+	}
+	if strings.HasPrefix(id, secretDigestPrefix) {
+		return "", false
+	}
+	return id, true
+}
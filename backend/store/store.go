@@ -1,42 +1,144 @@
 package store
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 // SaveSession はセッションをRedisに保存します
-func SaveSession[T any](prefix string, sessionID string, session T, expiration time.Duration) error {
-	sessionJSON, err := json.Marshal(session)
+func SaveSession[T any](ctx context.Context, prefix string, sessionID string, session T, expiration time.Duration) error {
+	sessionJSON, err := encodeRecord(ctx, prefix, recordID(prefix, sessionID), session)
 	if err != nil {
 		return err
 	}
 
-	return redisClient.Set(ctx, prefix+":"+sessionID, sessionJSON, expiration).Err()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storeError(redisClient.Set(ctx, redisKey(prefix, sessionID), sessionJSON, expiration).Err())
 }
 
 // GetSession はRedisからセッションを取得します
-func GetSession[T any](prefix string, sessionID string) (*T, error) {
-	val, err := redisClient.Get(ctx, prefix+":"+sessionID).Result()
-	if err == redis.Nil {
-		return nil, fmt.Errorf("session not found")
-	}
+// 存在しない場合は ErrNotFound を返します
+func GetSession[T any](ctx context.Context, prefix string, sessionID string) (*T, error) {
+	return getSessionFrom[T](ctx, redisClient, prefix, sessionID)
+}
+
+// lookupSession は GetSession と同じく取得しますが、読み出し用の接続 (レプリカ) を使用します
+// 保存直後に読み出す可能性のある一時データには使用しないでください
+func lookupSession[T any](ctx context.Context, prefix string, sessionID string) (*T, error) {
+	return getSessionFrom[T](ctx, redisReadClient, prefix, sessionID)
+}
+
+func getSessionFrom[T any](ctx context.Context, client redis.Cmdable, prefix string, sessionID string) (*T, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	val, err := client.Get(ctx, redisKey(prefix, sessionID)).Bytes()
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
 
-	var session T
-	if err := json.Unmarshal([]byte(val), &session); err != nil {
-		return nil, err
+	return unmarshalRecord[T](ctx, prefix, recordID(prefix, sessionID), val)
+}
+
+// consumeSession はRedisからセッションを取得し、同時に削除します (GETDEL)
+// 存在しない場合 (他のリクエストが先に取得した場合を含む) は ErrNotFound を返します
+func consumeSession[T any](ctx context.Context, prefix string, sessionID string) (*T, error) {
+	getCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	val, err := redisClient.GetDel(getCtx, redisKey(prefix, sessionID)).Bytes()
+	if err != nil {
+		return nil, storeError(err)
 	}
 
-	return &session, nil
+	return unmarshalRecord[T](ctx, prefix, recordID(prefix, sessionID), val)
+}
+
+// updateSession はRedisのセッションを読み出して update で変更し、有効期限を保ったまま保存し直します
+// 読み出してから保存するまでに他のインスタンスが更新した場合は、その更新を上書きしないように読み出しからやり直します
+// update がエラーを返した場合は保存せず、そのエラーを返します
+func updateSession[T any](ctx context.Context, prefix string, sessionID string, update func(*T) error) (*T, error) {
+	key := redisKey(prefix, sessionID)
+	for attempt := 0; attempt < 3; attempt++ {
+		var session *T
+		// 保存先以外のエラー (レコードの変換や update のエラー)
+		var recordErr error
+		watchCtx, cancel := withTimeout(ctx)
+		err := redisClient.Watch(watchCtx, func(tx *redis.Tx) error {
+			raw, err := tx.Get(watchCtx, key).Bytes()
+			if err != nil {
+				return err
+			}
+			if session, recordErr = unmarshalRecord[T](ctx, prefix, recordID(prefix, sessionID), raw); recordErr != nil {
+				return recordErr
+			}
+			if recordErr = update(session); recordErr != nil {
+				return recordErr
+			}
+			encoded, err := encodeRecord(ctx, prefix, recordID(prefix, sessionID), session)
+			if err != nil {
+				recordErr = err
+				return err
+			}
+			_, err = tx.TxPipelined(watchCtx, func(pipe redis.Pipeliner) error {
+				pipe.Set(watchCtx, key, encoded, redis.KeepTTL)
+				return nil
+			})
+			return err
+		}, key)
+		cancel()
+
+		switch {
+		case recordErr != nil:
+			return nil, recordErr
+		case errors.Is(err, redis.TxFailedErr):
+			continue
+		case err != nil:
+			return nil, storeError(err)
+		}
+		return session, nil
+	}
+	return nil, fmt.Errorf("%w: %s:%s was modified concurrently", ErrConflict, prefix, sessionID)
 }
 
 // DeleteSession はRedisからセッションを削除します
-func DeleteSession(prefix string, sessionID string) error {
-	return redisClient.Del(ctx, prefix+":"+sessionID).Err()
+func DeleteSession(ctx context.Context, prefix string, sessionID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storeError(redisClient.Del(ctx, redisKey(prefix, sessionID)).Err())
+}
+
+// scanKeys pattern に一致するキーを SCAN で列挙し、fn に渡します
+// Cluster モードではすべてのマスターノードを走査します。fn が同時に呼び出されることはありません
+func scanKeys(ctx context.Context, pattern string, fn func(ctx context.Context, key string) error) error {
+	var mu sync.Mutex
+	return forEachNode(ctx, func(ctx context.Context, client *redis.Client) error {
+		iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			err := fn(ctx, iter.Val())
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return storeError(iter.Err())
+	})
+}
+
+// forEachNode キーを保持するノード (Cluster モードではすべてのマスター) ごとに fn を呼び出します
+// Cluster モードでは fn が同時に呼び出されます
+func forEachNode(ctx context.Context, fn func(ctx context.Context, client *redis.Client) error) error {
+	switch client := redisClient.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachMaster(ctx, fn)
+	case *redis.Client:
+		return fn(ctx, client)
+	default:
+		return fmt.Errorf("unsupported redis client: %T", redisClient)
+	}
 }
@@ -0,0 +1,635 @@
+// Package storetest はリポジトリの実装が満たすべき振る舞いを検証する共通のテストスイートです
+// Redis・PostgreSQL・メモリのいずれの実装にも同じ検証を行い、保存先を切り替えても動作が変わらないことを確認します
+//
+// 検証では乱数のIDを使用してデータを作成するため、本番とは別の検証用の保存先に対して実行してください
+// go test ./store で実行されるほか (memory_test.go・redis_test.go・postgres_test.go)、cmd/storeconformance からも実行できます
+package storetest
+
+import (
+	"backend/model"
+	"backend/store"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestRepositories 設定されているすべてのリポジトリを検証します
+// nil のリポジトリ (その保存先が対応していないもの) は検証しません
+func TestRepositories(ctx context.Context, repos *store.Repositories) error {
+	var errs []error
+	if repos.Users != nil {
+		errs = append(errs, TestUserRepository(ctx, repos.Users))
+	}
+	if repos.Clients != nil {
+		errs = append(errs, TestClientRepository(ctx, repos.Clients))
+	}
+	if repos.Sessions != nil {
+		errs = append(errs, TestSessionRepository(ctx, repos.Sessions))
+	}
+	if repos.Codes != nil {
+		errs = append(errs, TestCodeRepository(ctx, repos.Codes))
+	}
+	if repos.Tokens != nil {
+		errs = append(errs, TestTokenRepository(ctx, repos.Tokens))
+	}
+	if repos.Keys != nil {
+		errs = append(errs, TestKeyRepository(ctx, repos.Keys))
+	}
+	return errors.Join(errs...)
+}
+
+// TestUserRepository ユーザーの作成・取得・更新とペアワイズ識別子の対応を検証します
+func TestUserRepository(ctx context.Context, repo store.UserRepository) error {
+	c := &checker{name: "users"}
+	email := randomID()[:16] + "@example.com"
+
+	created, err := repo.GetOrCreateUser(ctx, email)
+	if !c.noError("GetOrCreateUser", err) {
+		return c.err()
+	}
+	c.equal("GetOrCreateUser email", created.Email, email)
+	c.check("GetOrCreateUser id", created.ID != "", "empty user id")
+
+	again, err := repo.GetOrCreateUser(ctx, email)
+	if c.noError("GetOrCreateUser (existing)", err) {
+		c.equal("GetOrCreateUser (existing) id", again.ID, created.ID)
+	}
+
+	byID, err := repo.GetUserByID(ctx, created.ID)
+	if c.noError("GetUserByID", err) {
+		c.equal("GetUserByID email", byID.Email, email)
+	}
+	byEmail, err := repo.GetUserByEmail(ctx, email)
+	if c.noError("GetUserByEmail", err) {
+		c.equal("GetUserByEmail id", byEmail.ID, created.ID)
+	}
+
+	_, err = repo.GetUserByID(ctx, randomID())
+	c.isError("GetUserByID (unknown)", err, store.ErrNotFound)
+	_, err = repo.GetUserByEmail(ctx, randomID()[:16]+"@example.com")
+	c.isError("GetUserByEmail (unknown)", err, store.ErrNotFound)
+
+	// 大文字・小文字や Unicode の表記 (全角の＠) だけが異なるメールアドレスは同じユーザーになる
+	variant := strings.Replace(strings.ToUpper(email), "@", "＠", 1)
+	sameUser, err := repo.GetOrCreateUser(ctx, variant)
+	if c.noError("GetOrCreateUser (normalized)", err) {
+		c.equal("GetOrCreateUser (normalized) id", sameUser.ID, created.ID)
+	}
+	byVariant, err := repo.GetUserByEmail(ctx, " "+variant)
+	if c.noError("GetUserByEmail (normalized)", err) {
+		c.equal("GetUserByEmail (normalized) id", byVariant.ID, created.ID)
+	}
+
+	// 同じメールアドレスで同時に作成しても、作成されるユーザーは1人になる
+	concurrentEmail := randomID()[:16] + "@example.com"
+	userIDs := make([]string, 8)
+	createErrs := make([]error, len(userIDs))
+	var wg sync.WaitGroup
+	for i := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := repo.GetOrCreateUser(ctx, concurrentEmail)
+			if err != nil {
+				createErrs[i] = err
+				return
+			}
+			userIDs[i] = user.ID
+		}()
+	}
+	wg.Wait()
+	if c.noError("GetOrCreateUser (concurrent)", errors.Join(createErrs...)) {
+		indexed, err := repo.GetUserByEmail(ctx, concurrentEmail)
+		if c.noError("GetUserByEmail (concurrent)", err) {
+			for _, userID := range userIDs {
+				c.equal("GetOrCreateUser (concurrent) id", userID, indexed.ID)
+			}
+		}
+	}
+
+	updated := *created
+	updated.Name = "Conformance User"
+	updated.Roles = []string{"store-1:admin"}
+	updated.Attributes = map[string]interface{}{"tier": "gold"}
+	updated.UpdatedAt = time.Now()
+	if c.noError("UpdateUser", repo.UpdateUser(ctx, updated)) {
+		got, err := repo.GetUserByID(ctx, created.ID)
+		if c.noError("GetUserByID (updated)", err) {
+			c.equal("UpdateUser name", got.Name, updated.Name)
+			c.equal("UpdateUser roles", got.Roles, updated.Roles)
+			c.equal("UpdateUser attributes", got.Attributes, updated.Attributes)
+		}
+	}
+
+	unknown := updated
+	unknown.ID = randomID()
+	c.isError("UpdateUser (unknown)", repo.UpdateUser(ctx, unknown), store.ErrNotFound)
+
+	modified, err := repo.ModifyUser(ctx, created.ID, func(user *model.User) error {
+		user.Groups = []string{"staff"}
+		return nil
+	})
+	if c.noError("ModifyUser", err) {
+		c.equal("ModifyUser name", modified.Name, updated.Name)
+		c.equal("ModifyUser groups", modified.Groups, []string{"staff"})
+	}
+	errRejected := errors.New("rejected")
+	_, err = repo.ModifyUser(ctx, created.ID, func(user *model.User) error {
+		user.Groups = nil
+		return errRejected
+	})
+	c.isError("ModifyUser (rejected)", err, errRejected)
+	_, err = repo.ModifyUser(ctx, randomID(), func(user *model.User) error { return nil })
+	c.isError("ModifyUser (unknown)", err, store.ErrNotFound)
+
+	// 同時に変更しても、成功した変更はいずれも失われない (競合で失敗した変更は ErrConflict を返す)
+	added := make([]bool, 4)
+	modifyErrs := make([]error, len(added))
+	var modifyWG sync.WaitGroup
+	for i := range added {
+		modifyWG.Add(1)
+		go func() {
+			defer modifyWG.Done()
+			_, err := repo.ModifyUser(ctx, created.ID, func(user *model.User) error {
+				user.Groups = append(user.Groups, fmt.Sprintf("group-%d", i))
+				return nil
+			})
+			if err != nil && !errors.Is(err, store.ErrConflict) {
+				modifyErrs[i] = err
+			}
+			added[i] = err == nil
+		}()
+	}
+	modifyWG.Wait()
+	if c.noError("ModifyUser (concurrent)", errors.Join(modifyErrs...)) {
+		got, err := repo.GetUserByID(ctx, created.ID)
+		if c.noError("GetUserByID (modified)", err) {
+			c.equal("ModifyUser (concurrent) groups", len(got.Groups), 1+countTrue(added))
+		}
+	}
+
+	subject := randomID()
+	if c.noError("SavePairwiseSubject", repo.SavePairwiseSubject(ctx, subject, created.ID)) {
+		userID, err := repo.GetUserIDByPairwiseSubject(ctx, subject)
+		if c.noError("GetUserIDByPairwiseSubject", err) {
+			c.equal("GetUserIDByPairwiseSubject", userID, created.ID)
+		}
+	}
+	userID, err := repo.GetUserIDByPairwiseSubject(ctx, randomID())
+	if c.noError("GetUserIDByPairwiseSubject (unknown)", err) {
+		c.equal("GetUserIDByPairwiseSubject (unknown)", userID, "")
+	}
+	return c.err()
+}
+
+// TestClientRepository クライアントの登録・置き換え・一覧を検証します
+func TestClientRepository(ctx context.Context, repo store.ClientRepository) error {
+	c := &checker{name: "clients"}
+	client := model.Client{
+		ClientID:                "conformance-" + randomID()[:16],
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		RedirectURIs:            []string{"https://store.example.com/callback"},
+		AllowedRoles:            []string{"store-1:*"},
+		SubjectType:             "pairwise",
+		SectorIdentifierURI:     "https://store.example.com/sector.json",
+		SectorRedirectURIs:      []string{"https://store.example.com/callback"},
+		ClaimsMapping: []model.ClaimMapping{
+			{Claim: "tier", Expression: "user.attributes.tier"},
+		},
+	}
+
+	if !c.noError("SaveClient", repo.SaveClient(ctx, client)) {
+		return c.err()
+	}
+	got, err := repo.GetClient(ctx, client.ClientID)
+	if c.noError("GetClient", err) {
+		c.equal("GetClient", *got, client)
+	}
+
+	client.GrantTypes = []string{"authorization_code"}
+	if c.noError("SaveClient (replace)", repo.SaveClient(ctx, client)) {
+		got, err := repo.GetClient(ctx, client.ClientID)
+		if c.noError("GetClient (replaced)", err) {
+			c.equal("GetClient (replaced)", *got, client)
+		}
+	}
+
+	clients, err := repo.ListClients(ctx)
+	if c.noError("ListClients", err) {
+		count := 0
+		for _, listed := range clients {
+			if listed.ClientID == client.ClientID {
+				count++
+				c.equal("ListClients entry", listed, client)
+			}
+		}
+		c.equal("ListClients count", count, 1)
+	}
+
+	_, err = repo.GetClient(ctx, randomID())
+	c.isError("GetClient (unknown)", err, store.ErrNotFound)
+	return c.err()
+}
+
+// TestSessionRepository 認証セッションの保存・取得・削除を検証します
+func TestSessionRepository(ctx context.Context, repo store.SessionRepository) error {
+	c := &checker{name: "sessions"}
+	sessionID := randomID()
+	now := time.Now().Truncate(time.Second)
+	session := model.AuthSession{
+		SessionID:             sessionID,
+		UserID:                randomID(),
+		Email:                 "user@example.com",
+		CreatedAt:             now,
+		ExpiresAt:             now.Add(time.Hour),
+		IsLoggedIn:            true,
+		AuthenticationContext: model.NewAuthenticationContext(now, model.AMRPassword),
+	}
+
+	if !c.noError("SaveAuthSession", repo.SaveAuthSession(ctx, sessionID, session)) {
+		return c.err()
+	}
+	got, err := repo.GetAuthSession(ctx, sessionID)
+	if c.noError("GetAuthSession", err) {
+		c.equal("GetAuthSession", normalize(*got), normalize(session))
+	}
+
+	_, err = repo.GetAuthSession(ctx, "short")
+	c.isError("GetAuthSession (invalid id)", err, store.ErrNotFound)
+	_, err = repo.GetAuthSession(ctx, randomID())
+	c.isError("GetAuthSession (unknown)", err, store.ErrNotFound)
+
+	if c.noError("DeleteAuthSession", repo.DeleteAuthSession(ctx, sessionID)) {
+		_, err := repo.GetAuthSession(ctx, sessionID)
+		c.isError("GetAuthSession (deleted)", err, store.ErrNotFound)
+	}
+	return c.err()
+}
+
+// TestCodeRepository 認可コード・PAR・デバイスコードの保存と一度限りの使用を検証します
+func TestCodeRepository(ctx context.Context, repo store.CodeRepository) error {
+	c := &checker{name: "codes"}
+	now := time.Now().Truncate(time.Second)
+
+	code := randomID()
+	authorizeSession := model.AuthorizeSession{
+		AuthorizationCode: code,
+		UserID:            randomID(),
+		ClientID:          "demo-store-1",
+		CodeChallenge:     "challenge",
+		Scope:             "openid profile",
+		RedirectURI:       "https://store.example.com/callback",
+		Claims: &model.ClaimsRequest{
+			IDToken: map[string]*model.ClaimRequest{"acr": {Essential: true}},
+		},
+		CreatedAt: now,
+	}
+	if c.noError("SaveAuthorizeSession", repo.SaveAuthorizeSession(ctx, code, authorizeSession)) {
+		got, err := repo.GetAuthorizeSession(ctx, code)
+		if c.noError("GetAuthorizeSession", err) {
+			c.equal("GetAuthorizeSession", normalize(*got), normalize(authorizeSession))
+		}
+		if c.noError("DeleteAuthorizeSession", repo.DeleteAuthorizeSession(ctx, code)) {
+			_, err := repo.GetAuthorizeSession(ctx, code)
+			c.isError("GetAuthorizeSession (deleted)", err, store.ErrNotFound)
+		}
+	}
+	_, err := repo.GetAuthorizeSession(ctx, "short")
+	c.isError("GetAuthorizeSession (invalid id)", err, store.ErrNotFound)
+
+	requestURI := "urn:ietf:params:oauth:request_uri:" + randomID()
+	request := model.AuthorizationRequest{ClientID: "demo-store-1", Scope: "openid"}
+	if c.noError("SavePushedAuthorizationRequest", repo.SavePushedAuthorizationRequest(ctx, requestURI, request, time.Minute)) {
+		got, err := repo.ConsumePushedAuthorizationRequest(ctx, requestURI)
+		if c.noError("ConsumePushedAuthorizationRequest", err) {
+			c.equal("ConsumePushedAuthorizationRequest", normalize(*got), normalize(request))
+		}
+		_, err = repo.ConsumePushedAuthorizationRequest(ctx, requestURI)
+		c.isError("ConsumePushedAuthorizationRequest (consumed)", err, store.ErrNotFound)
+	}
+
+	expiringURI := "urn:ietf:params:oauth:request_uri:" + randomID()
+	if c.noError("SavePushedAuthorizationRequest (expiring)", repo.SavePushedAuthorizationRequest(ctx, expiringURI, request, 100*time.Millisecond)) {
+		time.Sleep(300 * time.Millisecond)
+		_, err := repo.ConsumePushedAuthorizationRequest(ctx, expiringURI)
+		c.isError("ConsumePushedAuthorizationRequest (expired)", err, store.ErrNotFound)
+	}
+
+	userCode := "CONF-" + randomID()[:4]
+	deviceSession := model.DeviceSession{
+		DeviceCode: deviceCode(userCode),
+		UserCode:   userCode,
+		ClientID:   "demo-store-1",
+		Scope:      "openid",
+		Status:     model.DeviceAuthorizationPending,
+		Interval:   5,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(10 * time.Minute),
+	}
+	if c.noError("SaveDeviceSession", repo.SaveDeviceSession(ctx, deviceSession)) {
+		got, err := repo.GetDeviceSession(ctx, deviceSession.DeviceCode)
+		if c.noError("GetDeviceSession", err) {
+			c.equal("GetDeviceSession", normalize(*got), normalize(deviceSession))
+		}
+		got, err = repo.GetDeviceSessionByUserCode(ctx, deviceSession.UserCode)
+		if c.noError("GetDeviceSessionByUserCode", err) {
+			c.equal("GetDeviceSessionByUserCode", got.DeviceCode, deviceSession.DeviceCode)
+		}
+
+		polled, err := repo.MarkDevicePolled(ctx, deviceSession.DeviceCode, time.Minute)
+		if c.noError("MarkDevicePolled", err) {
+			c.equal("MarkDevicePolled (first)", polled, true)
+		}
+		polled, err = repo.MarkDevicePolled(ctx, deviceSession.DeviceCode, time.Minute)
+		if c.noError("MarkDevicePolled", err) {
+			c.equal("MarkDevicePolled (too soon)", polled, false)
+		}
+
+		errNotPending := errors.New("not pending")
+		approve := func(session *model.DeviceSession) error {
+			if session.Status != model.DeviceAuthorizationPending {
+				return errNotPending
+			}
+			session.Status = model.DeviceAuthorizationApproved
+			session.UserID = "user-1"
+			return nil
+		}
+		got, err = repo.UpdateDeviceSessionByUserCode(ctx, deviceSession.UserCode, approve)
+		if c.noError("UpdateDeviceSessionByUserCode", err) {
+			c.equal("UpdateDeviceSessionByUserCode", got.Status, model.DeviceAuthorizationApproved)
+		}
+		_, err = repo.UpdateDeviceSessionByUserCode(ctx, deviceSession.UserCode, approve)
+		c.isError("UpdateDeviceSessionByUserCode (not pending)", err, errNotPending)
+		got, err = repo.UpdateDeviceSession(ctx, deviceSession.DeviceCode, func(session *model.DeviceSession) error {
+			session.Interval += 5
+			return nil
+		})
+		if c.noError("UpdateDeviceSession", err) {
+			c.equal("UpdateDeviceSession (status kept)", got.Status, model.DeviceAuthorizationApproved)
+			c.equal("UpdateDeviceSession (interval)", got.Interval, 10)
+		}
+
+		got, err = repo.ConsumeDeviceSession(ctx, deviceSession.DeviceCode)
+		if c.noError("ConsumeDeviceSession", err) {
+			c.equal("ConsumeDeviceSession", got.UserID, "user-1")
+		}
+		_, err = repo.ConsumeDeviceSession(ctx, deviceSession.DeviceCode)
+		c.isError("ConsumeDeviceSession (consumed)", err, store.ErrNotFound)
+		_, err = repo.GetDeviceSessionByUserCode(ctx, deviceSession.UserCode)
+		c.isError("GetDeviceSessionByUserCode (consumed)", err, store.ErrNotFound)
+		_, err = repo.UpdateDeviceSession(ctx, deviceSession.DeviceCode, approve)
+		c.isError("UpdateDeviceSession (consumed)", err, store.ErrNotFound)
+	}
+
+	deviceSession.UserCode = "CONF-" + randomID()[:4]
+	deviceSession.DeviceCode = deviceCode(deviceSession.UserCode)
+	if c.noError("SaveDeviceSession", repo.SaveDeviceSession(ctx, deviceSession)) {
+		if c.noError("DeleteDeviceSession", repo.DeleteDeviceSession(ctx, deviceSession)) {
+			_, err := repo.GetDeviceSession(ctx, deviceSession.DeviceCode)
+			c.isError("GetDeviceSession (deleted)", err, store.ErrNotFound)
+			_, err = repo.GetDeviceSessionByUserCode(ctx, deviceSession.UserCode)
+			c.isError("GetDeviceSessionByUserCode (deleted)", err, store.ErrNotFound)
+		}
+	}
+
+	// 同じデバイスコードで同時にトークンを要求しても、取得できるのは1回だけ
+	deviceSession.UserCode = "CONF-" + randomID()[:4]
+	deviceSession.DeviceCode = deviceCode(deviceSession.UserCode)
+	if c.noError("SaveDeviceSession", repo.SaveDeviceSession(ctx, deviceSession)) {
+		consumed := make([]bool, 8)
+		consumeErrs := make([]error, len(consumed))
+		var wg sync.WaitGroup
+		for i := range consumed {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.ConsumeDeviceSession(ctx, deviceSession.DeviceCode)
+				if err != nil && !errors.Is(err, store.ErrNotFound) {
+					consumeErrs[i] = err
+				}
+				consumed[i] = err == nil
+			}()
+		}
+		wg.Wait()
+		if c.noError("ConsumeDeviceSession (concurrent)", errors.Join(consumeErrs...)) {
+			c.equal("ConsumeDeviceSession (concurrent) count", countTrue(consumed), 1)
+		}
+	}
+
+	expired := deviceSession
+	expired.DeviceCode = deviceCode(expired.UserCode)
+	expired.ExpiresAt = now.Add(-time.Minute)
+	c.isError("SaveDeviceSession (expired)", repo.SaveDeviceSession(ctx, expired), store.ErrExpired)
+	return c.err()
+}
+
+// TestTokenRepository リフレッシュトークンのセッションとDPoP証明の使用履歴を検証します
+func TestTokenRepository(ctx context.Context, repo store.TokenRepository) error {
+	c := &checker{name: "tokens"}
+	now := time.Now().Truncate(time.Second)
+	tokenID := randomID()
+	session := model.TokenSession{
+		UserID:                randomID(),
+		ClientID:              "demo-store-1",
+		Scope:                 "openid offline_access",
+		Resources:             []string{"https://api.example.com/orders"},
+		DPoPJKT:               "jkt",
+		CreatedAt:             now,
+		ExpiresAt:             now.Add(30 * 24 * time.Hour),
+		AuthenticationContext: model.NewAuthenticationContext(now, model.AMRPassword),
+	}
+
+	if !c.noError("SaveTokenSession", repo.SaveTokenSession(ctx, tokenID, session)) {
+		return c.err()
+	}
+	got, err := repo.GetTokenSession(ctx, tokenID)
+	if c.noError("GetTokenSession", err) {
+		c.equal("GetTokenSession", normalize(got), normalize(session))
+	}
+
+	session.IsRevoked = true
+	if c.noError("UpdateTokenSession", repo.UpdateTokenSession(ctx, tokenID, session)) {
+		got, err := repo.GetTokenSession(ctx, tokenID)
+		if c.noError("GetTokenSession (updated)", err) {
+			c.equal("UpdateTokenSession is_revoked", got.IsRevoked, true)
+		}
+	}
+
+	_, err = repo.GetTokenSession(ctx, randomID())
+	c.isError("GetTokenSession (unknown)", err, store.ErrNotFound)
+
+	expiredID := randomID()
+	expired := session
+	expired.IsRevoked = false
+	expired.ExpiresAt = now.Add(-time.Minute)
+	if c.noError("SaveTokenSession (expired)", repo.SaveTokenSession(ctx, expiredID, expired)) {
+		got, err := repo.GetTokenSession(ctx, expiredID)
+		if c.isError("GetTokenSession (expired)", err, store.ErrExpired) {
+			c.equal("GetTokenSession (expired) client_id", got.ClientID, expired.ClientID)
+		}
+	}
+
+	if c.noError("DeleteTokenSession", repo.DeleteTokenSession(ctx, tokenID)) {
+		_, err := repo.GetTokenSession(ctx, tokenID)
+		c.isError("GetTokenSession (deleted)", err, store.ErrNotFound)
+	}
+
+	consumedID := randomID()
+	if c.noError("SaveTokenSession (consume)", repo.SaveTokenSession(ctx, consumedID, expired)) {
+		got, err := repo.ConsumeTokenSession(ctx, consumedID)
+		if c.isError("ConsumeTokenSession (expired)", err, store.ErrExpired) {
+			c.equal("ConsumeTokenSession (expired) client_id", got.ClientID, expired.ClientID)
+		}
+	}
+	expired.ExpiresAt = now.Add(time.Hour)
+	if c.noError("SaveTokenSession (consume)", repo.SaveTokenSession(ctx, consumedID, expired)) {
+		got, err := repo.ConsumeTokenSession(ctx, consumedID)
+		if c.noError("ConsumeTokenSession", err) {
+			c.equal("ConsumeTokenSession", normalize(got), normalize(expired))
+		}
+		_, err = repo.ConsumeTokenSession(ctx, consumedID)
+		c.isError("ConsumeTokenSession (consumed)", err, store.ErrNotFound)
+		_, err = repo.GetTokenSession(ctx, consumedID)
+		c.isError("GetTokenSession (consumed)", err, store.ErrNotFound)
+	}
+
+	accessTokenID := randomID()
+	requested := map[string]*model.ClaimRequest{"email": {Essential: true}, "phone_number": nil}
+	if c.noError("SaveUserInfoClaims", repo.SaveUserInfoClaims(ctx, accessTokenID, requested, time.Minute)) {
+		got, err := repo.GetUserInfoClaims(ctx, accessTokenID)
+		if c.noError("GetUserInfoClaims", err) {
+			c.equal("GetUserInfoClaims", got, requested)
+		}
+	}
+	_, err = repo.GetUserInfoClaims(ctx, randomID())
+	c.isError("GetUserInfoClaims (unknown)", err, store.ErrNotFound)
+
+	jkt, jti := randomID(), randomID()
+	fresh, err := repo.MarkDPoPProofUsed(ctx, jkt, jti, time.Minute)
+	if c.noError("MarkDPoPProofUsed", err) {
+		c.equal("MarkDPoPProofUsed (first)", fresh, true)
+	}
+	fresh, err = repo.MarkDPoPProofUsed(ctx, jkt, jti, time.Minute)
+	if c.noError("MarkDPoPProofUsed", err) {
+		c.equal("MarkDPoPProofUsed (replay)", fresh, false)
+	}
+	fresh, err = repo.MarkDPoPProofUsed(ctx, jkt, randomID(), time.Minute)
+	if c.noError("MarkDPoPProofUsed", err) {
+		c.equal("MarkDPoPProofUsed (other jti)", fresh, true)
+	}
+
+	clientID := randomID()
+	fresh, err = repo.MarkRequestObjectUsed(ctx, clientID, jti, time.Minute)
+	if c.noError("MarkRequestObjectUsed", err) {
+		c.equal("MarkRequestObjectUsed (first)", fresh, true)
+	}
+	fresh, err = repo.MarkRequestObjectUsed(ctx, clientID, jti, time.Minute)
+	if c.noError("MarkRequestObjectUsed", err) {
+		c.equal("MarkRequestObjectUsed (replay)", fresh, false)
+	}
+	fresh, err = repo.MarkRequestObjectUsed(ctx, randomID(), jti, time.Minute)
+	if c.noError("MarkRequestObjectUsed", err) {
+		c.equal("MarkRequestObjectUsed (other client)", fresh, true)
+	}
+	return c.err()
+}
+
+// TestKeyRepository 用途ごとの鍵が最初に登録されたものに固定されることを検証します
+func TestKeyRepository(ctx context.Context, repo store.KeyRepository) error {
+	c := &checker{name: "keys"}
+	use := "conformance-" + randomID()[:16]
+	now := time.Now().Truncate(time.Second)
+	first := model.Key{KeyID: randomID(), Use: use, PrivateKey: []byte(randomID()), CreatedAt: now}
+	second := model.Key{KeyID: randomID(), Use: use, PrivateKey: []byte(randomID()), CreatedAt: now}
+
+	got, err := repo.GetOrCreateKey(ctx, first)
+	if !c.noError("GetOrCreateKey", err) {
+		return c.err()
+	}
+	c.equal("GetOrCreateKey kid", got.KeyID, first.KeyID)
+	c.equal("GetOrCreateKey private key", got.PrivateKey, first.PrivateKey)
+
+	got, err = repo.GetOrCreateKey(ctx, second)
+	if c.noError("GetOrCreateKey (existing)", err) {
+		c.equal("GetOrCreateKey (existing) kid", got.KeyID, first.KeyID)
+		c.equal("GetOrCreateKey (existing) private key", got.PrivateKey, first.PrivateKey)
+	}
+	return c.err()
+}
+
+// checker 検証の失敗を記録します
+type checker struct {
+	name     string
+	failures []error
+}
+
+func (c *checker) check(step string, ok bool, format string, args ...interface{}) bool {
+	if !ok {
+		c.failures = append(c.failures, fmt.Errorf("%s: %s: %s", c.name, step, fmt.Sprintf(format, args...)))
+	}
+	return ok
+}
+
+func (c *checker) noError(step string, err error) bool {
+	return c.check(step, err == nil, "unexpected error: %v", err)
+}
+
+// isError err が target (store.ErrNotFound など) であることを確認します
+func (c *checker) isError(step string, err error, target error) bool {
+	return c.check(step, errors.Is(err, target), "got error %v, want %v", err, target)
+}
+
+func (c *checker) equal(step string, got interface{}, want interface{}) bool {
+	return c.check(step, reflect.DeepEqual(got, want), "got %#v, want %#v", got, want)
+}
+
+// deviceCode ハンドラと同じ形式 (先頭にユーザーコードのタグを付けた64文字) のデバイスコードを返します
+func deviceCode(userCode string) string {
+	tag := store.DeviceCodeTag(userCode)
+	return tag + randomID()[len(tag):]
+}
+
+// countTrue true の数を返します
+func countTrue(values []bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *checker) err() error {
+	return errors.Join(c.failures...)
+}
+
+// normalize 保存先によって表現が変わる値 (時刻のタイムゾーンなど) を揃えるため、JSONに変換した値で比較します
+func normalize(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	normalized, _ := json.Marshal(decoded)
+	return string(normalized)
+}
+
+func randomID() string {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,22 @@
+package store
+
+import "context"
+
+// SavePairwiseSubject ペアワイズ識別子から内部のユーザーIDを引けるように保存する
+func (s *RedisStore) SavePairwiseSubject(ctx context.Context, subject string, userID string) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storeError(redisClient.Set(ctx, redisKey("pairwise_subject", subject), userID, 0).Err()) // 有効期限なし
+}
+
+// ペアワイズ識別子から内部のユーザーIDを取得する
+// ペアワイズ識別子として発行されていない場合は空文字を返す
+func (s *RedisStore) GetUserIDByPairwiseSubject(ctx context.Context, subject string) (string, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	userID, err := redisReadClient.Get(ctx, redisKey("pairwise_subject", subject)).Result()
+	if err := storeError(err); err != nil && err != ErrNotFound {
+		return "", err
+	}
+	return userID, nil
+}
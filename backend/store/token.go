@@ -2,32 +2,82 @@ package store
 
 import (
 	"backend/model"
+	"context"
 	"time"
 )
 
+// expiredTokenSessionRetention 有効期限を過ぎたトークンセッションを保存先に残す期間
+// 期限切れのリフレッシュトークンが提示された場合に、存在しないトークンと区別して ErrExpired を返せるよう残す
+const expiredTokenSessionRetention = 24 * time.Hour
+
+// tokenSessionExpiration トークンセッションの保存先の有効期限 (ExpiresAt から expiredTokenSessionRetention 後まで) を返します
+func tokenSessionExpiration(session model.TokenSession) (time.Duration, error) {
+	return expirationOf(session.ExpiresAt.Add(expiredTokenSessionRetention), "token session")
+}
+
 // TokenSessionの保存・取得用ラッパー関数
-func SaveTokenSession(tokenID string, session model.TokenSession) error {
-	// リフレッシュトークンは30日間有効
-	return SaveSession("token_session", tokenID, session, 30*24*time.Hour)
+func (s *RedisStore) SaveTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error {
+	ttl, err := tokenSessionExpiration(session)
+	if err != nil {
+		return err
+	}
+	return SaveSession(ctx, "token_session", secretID(tokenID), session, ttl)
 }
 
 // TokenSessionの取得用ラッパー関数
-func GetTokenSession(tokenID string) (model.TokenSession, error) {
-	session, err := GetSession[model.TokenSession]("token_session", tokenID)
+func (s *RedisStore) GetTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error) {
+	session, err := getSecretRecord[model.TokenSession](ctx, "token_session", tokenID)
 	if err != nil {
 		return model.TokenSession{}, err
 	}
-	return *session, nil
+	return *session, checkTokenSessionExpiry(*session)
 }
 
 // TokenSessionの更新用ラッパー関数
-func UpdateTokenSession(tokenID string, session model.TokenSession) error {
+func (s *RedisStore) UpdateTokenSession(ctx context.Context, tokenID string, session model.TokenSession) error {
 	// 既存の有効期限を保持するために現在の有効期限を取得
-	ttl, err := redisClient.TTL(ctx, "token_session:"+tokenID).Result()
+	ttlCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	ttl, err := redisClient.TTL(ttlCtx, redisKey("token_session", secretID(tokenID))).Result()
 	if err != nil {
-		// エラーが発生した場合はデフォルトの有効期限を使用
-		ttl = 30 * 24 * time.Hour
+		return storeError(err)
 	}
+	if ttl <= 0 {
+		// 有効期限が取得できない場合 (キーが存在しない・期限なし) はセッションの ExpiresAt から決める
+		if ttl, err = tokenSessionExpiration(session); err != nil {
+			return err
+		}
+	}
+
+	return SaveSession(ctx, "token_session", secretID(tokenID), session, ttl)
+}
+
+// TokenSessionの削除用ラッパー関数
+func (s *RedisStore) DeleteTokenSession(ctx context.Context, tokenID string) error {
+	return deleteSecretRecord(ctx, "token_session", tokenID)
+}
 
-	return SaveSession("token_session", tokenID, session, ttl)
+// ConsumeTokenSession トークンセッションを取得し、同時に削除します
+// リフレッシュトークンのローテーションで同じトークンを二重に使用できないよう、GETDEL で取得と削除を不可分に行います
+func (s *RedisStore) ConsumeTokenSession(ctx context.Context, tokenID string) (model.TokenSession, error) {
+	session, err := consumeSecretRecord[model.TokenSession](ctx, "token_session", tokenID)
+	if err != nil {
+		return model.TokenSession{}, err
+	}
+	return *session, checkTokenSessionExpiry(*session)
+}
+
+// SaveUserInfoClaims アクセストークン (jti) に対して claims パラメータで要求された UserInfo のクレームを保存します
+// アクセストークンに含めると内容がクライアントやリソースサーバーに見えるため、サーバー側で保持します
+func (s *RedisStore) SaveUserInfoClaims(ctx context.Context, tokenID string, claims map[string]*model.ClaimRequest, expiration time.Duration) error {
+	return SaveSession(ctx, "userinfo_claims", tokenID, claims, expiration)
+}
+
+// GetUserInfoClaims アクセストークン (jti) に対して要求された UserInfo のクレームを取得します
+func (s *RedisStore) GetUserInfoClaims(ctx context.Context, tokenID string) (map[string]*model.ClaimRequest, error) {
+	claims, err := GetSession[map[string]*model.ClaimRequest](ctx, "userinfo_claims", tokenID)
+	if err != nil {
+		return nil, err
+	}
+	return *claims, nil
 }
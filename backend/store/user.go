@@ -1,65 +1,155 @@
 package store
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"fmt"
+	"errors"
+	"strings"
 	"time"
 
 	"backend/model"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/text/unicode/norm"
 )
 
 // ユーザーIDからユーザー情報を取得する
-func GetUserByID(userID string) (*model.User, error) {
-	return GetSession[model.User]("user", userID)
+func (s *RedisStore) GetUserByID(ctx context.Context, userID string) (*model.User, error) {
+	return lookupSession[model.User](ctx, "user", userKeyID(userID))
 }
 
 // メールアドレスからユーザー情報を取得する
-func GetUserByEmail(email string) (*model.User, error) {
+func (s *RedisStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	// メールアドレスからユーザーIDを取得
-	userID, err := redisClient.Get(ctx, "user_email:"+email).Result()
+	userID, err := userIDByEmail(ctx, redisReadClient, email)
 	if err != nil {
-		return nil, fmt.Errorf("user not found for email: %s", email)
+		return nil, err
 	}
 
-	return GetUserByID(userID)
+	return s.GetUserByID(ctx, userID)
 }
 
 // ユーザーを登録または取得する
-func GetOrCreateUser(email string) (*model.User, error) {
+// メールアドレスのインデックスの SET NX とユーザー情報の保存を Lua スクリプトでまとめて行うため、
+// 同時に登録された場合も作成されるユーザーは1人になり、インデックスが指すユーザー情報は常に存在する
+func (s *RedisStore) GetOrCreateUser(ctx context.Context, email string) (*model.User, error) {
 	// 既存ユーザーを確認
-	userID, err := redisClient.Get(ctx, "user_email:"+email).Result()
+	// 作成直後のユーザーを取得する可能性があるため、マスターから読み出す
+	userID, err := userIDByEmail(ctx, redisClient, email)
 	if err == nil {
 		// 既存ユーザーが見つかった場合
-		return GetUserByID(userID)
+		return GetSession[model.User](ctx, "user", userKeyID(userID))
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
 	}
 
 	// 新しいユーザーIDを生成
-	newUserID, err := generateUserID()
+	// Cluster モードでインデックスと同じスロットに配置するため、インデックスのハッシュタグを埋め込む
+	indexID, err := emailIndexID(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	newUserID, err := generateOwnedUserID(slotTag(indexID))
 	if err != nil {
 		return nil, err
 	}
 
 	// 新しいユーザーを作成
+	now := time.Now()
 	user := model.User{
 		ID:        newUserID,
-		Email:     email,
-		CreatedAt: time.Now(),
+		Email:     strings.TrimSpace(email),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	// ユーザー情報を保存
-	if err := SaveSession("user", newUserID, user, 0); err != nil { // 有効期限なし
+	data, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
 		return nil, err
 	}
 
-	// メールアドレスとユーザーIDのマッピングを保存
-	if err := redisClient.Set(ctx, "user_email:"+email, newUserID, 0).Err(); err != nil {
-		return nil, err
+	// メールアドレスとユーザーIDのマッピングとユーザー情報を保存 (有効期限なし)
+	// 登録済みの場合は他のリクエストが先に作成したユーザーを使用する
+	setCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	keys := []string{redisKey("user_email", emailIndexKeyID(indexID)), redisKey("user", userKeyID(newUserID))}
+	created, err := createUserScript.Run(setCtx, redisClient, keys, newUserID, data).Bool()
+	if err != nil {
+		return nil, storeError(err)
+	}
+	if !created {
+		userID, err := userIDByEmail(ctx, redisClient, email)
+		if err != nil {
+			return nil, err
+		}
+		return GetSession[model.User](ctx, "user", userKeyID(userID))
 	}
 
 	return &user, nil
 }
 
+// userIDByEmail メールアドレスのインデックスからユーザーIDを取得する
+// 見つからない場合は、ブラインドインデックスや正規化を導入する前の形式で登録されたインデックスを参照する
+// 登録時の表記のままの古いインデックスは走査せず、cmd/repairusers -reindex で現在の形式に登録し直す
+func userIDByEmail(ctx context.Context, client redis.Cmdable, email string) (string, error) {
+	indexID, err := emailIndexID(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	getCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	var userID string
+	for _, id := range append([]string{indexID}, legacyEmailIndexIDs(email)...) {
+		userID, err = client.Get(getCtx, redisKey("user_email", emailIndexKeyID(id))).Result()
+		if !errors.Is(err, redis.Nil) {
+			break
+		}
+	}
+	if err != nil {
+		return "", storeError(err)
+	}
+	return userID, nil
+}
+
+// NormalizeEmail 同じアカウントとして扱うメールアドレスを同じ文字列に変換します
+// 前後の空白を除き、Unicode 正規化 (NFKC) の上で小文字にします。メールアドレスのインデックスのキーに使用します
+func NormalizeEmail(email string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimSpace(email)))
+}
+
+// createUserScript メールアドレスのインデックスが未登録の場合のみ、インデックスとユーザー情報を保存する
+// KEYS[1]: インデックス、KEYS[2]: ユーザー情報、ARGV[1]: ユーザーID、ARGV[2]: ユーザー情報
+// 保存した場合は 1、登録済みの場合は 0 を返す
+var createUserScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX") then
+	redis.call("SET", KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// userKeyID ユーザー情報のキーに使用するIDを返す
+// Cluster モードではユーザーIDの先頭に埋め込んだハッシュタグを使用し、メールアドレスのインデックスと同じスロットに配置する
+func userKeyID(userID string) string {
+	return ownedID(idSlotTag(userID), userID)
+}
+
+// emailIndexKeyID メールアドレスのインデックスのキーに使用するIDを返す
+func emailIndexKeyID(indexID string) string {
+	return ownedID(slotTag(indexID), indexID)
+}
+
+// generateOwnedUserID 先頭にハッシュタグ (slotTag) を埋め込んだユーザーIDを生成する (generateUserID と同じ32文字)
+func generateOwnedUserID(tag string) (string, error) {
+	bytes := make([]byte, (32-len(tag))/2)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return tag + hex.EncodeToString(bytes), nil
+}
+
 // ユーザーIDを生成する
 func generateUserID() (string, error) {
 	bytes := make([]byte, 16)
@@ -68,3 +158,29 @@ func generateUserID() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// ユーザー情報を更新する (存在しないユーザーの場合は ErrNotFound を返す)
+func (s *RedisStore) UpdateUser(ctx context.Context, user model.User) error {
+	data, err := encodeRecord(ctx, "user", user.ID, user)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	// SET XX で既存のユーザーのみ更新し、削除されたユーザーを作り直さない
+	updated, err := redisClient.SetXX(ctx, redisKey("user", userKeyID(user.ID)), data, 0).Result() // 有効期限なし
+	if err != nil {
+		return storeError(err)
+	}
+	if !updated {
+		return notFound("user %s", user.ID)
+	}
+	return nil
+}
+
+// ユーザー情報を変更する
+// 取得したユーザー情報を書き戻す変更 (ロールやプロフィールの更新) に使用する
+// 複製遅延のあるレプリカではなくマスターから読み出し、WATCH で他の変更を上書きしないようにする
+func (s *RedisStore) ModifyUser(ctx context.Context, userID string, update func(*model.User) error) (*model.User, error) {
+	return updateSession(ctx, "user", userKeyID(userID), update)
+}
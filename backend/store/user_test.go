@@ -0,0 +1,67 @@
+package store_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend/store"
+)
+
+// 同じメールアドレス (表記の違いを含む) で同時に GetOrCreateUser を呼び出しても、作成されるユーザーは1人になる
+func TestGetOrCreateUserConcurrent(t *testing.T) {
+	repos := map[string]store.UserRepository{"memory": store.NewMemoryStore()}
+	if os.Getenv("REDIS_ADDR") != "" {
+		if err := store.InitRedis(); err != nil {
+			t.Fatalf("Failed to initialize Redis: %v", err)
+		}
+		repos["redis"] = &store.RedisStore{}
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			suffix := make([]byte, 8)
+			if _, err := rand.Read(suffix); err != nil {
+				t.Fatal(err)
+			}
+			email := "concurrent-" + hex.EncodeToString(suffix) + "@example.com"
+			variants := []string{email, strings.ToUpper(email), " " + email, strings.Replace(email, "@", "＠", 1)}
+
+			userIDs := make([]string, 16)
+			errs := make([]error, len(userIDs))
+			var wg sync.WaitGroup
+			for i := range userIDs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					user, err := repo.GetOrCreateUser(context.Background(), variants[i%len(variants)])
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					userIDs[i] = user.ID
+				}()
+			}
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Fatalf("GetOrCreateUser(%q) error = %v", variants[i%len(variants)], err)
+				}
+			}
+			indexed, err := repo.GetUserByEmail(context.Background(), email)
+			if err != nil {
+				t.Fatalf("GetUserByEmail() error = %v", err)
+			}
+			for i, userID := range userIDs {
+				if userID != indexed.ID {
+					t.Errorf("GetOrCreateUser(%q) id = %s, want %s", variants[i%len(variants)], userID, indexed.ID)
+				}
+			}
+		})
+	}
+}
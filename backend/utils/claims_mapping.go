@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"backend/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// クレームマッピングで変更できないクレーム
+// トークンの検証や送信者制約、認可の判定に使われるため、マッピングで上書き・削除・名前変更はできません
+var protectedClaims = []string{
+	"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "typ",
+	"client_id", "scope", "cnf", "act", "nonce", "auth_time", "acr", "amr",
+	"at_hash", "c_hash", "userinfo_claims", "groups", "roles",
+}
+
+// 1回の式の評価で許容するコスト (無限ループや巨大なリストの生成を防ぐ)
+const claimsMappingCostLimit = 10000
+
+var (
+	claimsMappingEnvOnce sync.Once
+	claimsMappingEnv     *cel.Env
+	claimsMappingEnvErr  error
+
+	// コンパイル済みのCEL式 (式の文字列ごと)
+	claimsMappingPrograms sync.Map
+)
+
+// ClaimsMappingInput クレームマッピングの式から参照できる値
+// 各値は JSON で表現できる型 (NewClaimsMappingInput で作成) である必要があります
+type ClaimsMappingInput struct {
+	User    map[string]interface{}
+	Session map[string]interface{}
+	Client  map[string]interface{}
+	Scopes  []string
+}
+
+// NewClaimsMappingInput ユーザー・認証セッション・クライアントの情報から式の入力を作成します
+// user / session / client はJSONに変換して、JSONのフィールド名で参照できるようにします
+func NewClaimsMappingInput(user interface{}, session interface{}, client interface{}, scopes []string) (ClaimsMappingInput, error) {
+	var input ClaimsMappingInput
+	var err error
+	if input.User, err = toJSONMap(user); err != nil {
+		return input, err
+	}
+	if input.Session, err = toJSONMap(session); err != nil {
+		return input, err
+	}
+	if input.Client, err = toJSONMap(client); err != nil {
+		return input, err
+	}
+	input.Scopes = scopes
+	return input, nil
+}
+
+// ValidateClaimsMapping クレームマッピング規則を検証し、CEL式をコンパイルします
+func ValidateClaimsMapping(rules []model.ClaimMapping) error {
+	for i, rule := range rules {
+		if err := validateClaimMapping(rule); err != nil {
+			return fmt.Errorf("claims_mapping[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateClaimMapping(rule model.ClaimMapping) error {
+	if rule.Claim == "" {
+		return errors.New("claim is required")
+	}
+	if slices.Contains(protectedClaims, rule.Claim) {
+		return fmt.Errorf("claim %s cannot be mapped", rule.Claim)
+	}
+	for _, target := range rule.Targets {
+		if target != model.ClaimsTargetIDToken && target != model.ClaimsTargetAccessToken && target != model.ClaimsTargetUserInfo {
+			return fmt.Errorf("unknown target: %s", target)
+		}
+	}
+
+	switch rule.Action {
+	case "", model.ClaimsMappingSet:
+		if rule.Expression == "" {
+			return errors.New("expression is required for set")
+		}
+		if _, err := claimsMappingProgram(rule.Expression); err != nil {
+			return err
+		}
+	case model.ClaimsMappingRename:
+		if rule.From == "" {
+			return errors.New("from is required for rename")
+		}
+		if slices.Contains(protectedClaims, rule.From) {
+			return fmt.Errorf("claim %s cannot be mapped", rule.From)
+		}
+	case model.ClaimsMappingDrop:
+	default:
+		return fmt.Errorf("unknown action: %s", rule.Action)
+	}
+
+	if rule.Condition != "" {
+		if _, err := claimsMappingProgram(rule.Condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyClaimsMapping 対象のトークンに対してクレームマッピング規則を順に適用します
+// claims を直接変更し、式の評価に失敗した場合はエラーを返します
+func ApplyClaimsMapping(rules []model.ClaimMapping, target string, input ClaimsMappingInput, claims map[string]interface{}) error {
+	for i, rule := range rules {
+		if len(rule.Targets) > 0 && !slices.Contains(rule.Targets, target) {
+			continue
+		}
+		if err := applyClaimMapping(rule, target, input, claims); err != nil {
+			return fmt.Errorf("claims_mapping[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func applyClaimMapping(rule model.ClaimMapping, target string, input ClaimsMappingInput, claims map[string]interface{}) error {
+	if rule.Condition != "" {
+		result, err := evaluateClaimsMapping(rule.Condition, target, input, claims)
+		if err != nil {
+			return err
+		}
+		matched, ok := result.(bool)
+		if !ok {
+			return fmt.Errorf("condition must return bool: %s", rule.Condition)
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	switch rule.Action {
+	case "", model.ClaimsMappingSet:
+		value, err := evaluateClaimsMapping(rule.Expression, target, input, claims)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			delete(claims, rule.Claim)
+		} else {
+			claims[rule.Claim] = value
+		}
+	case model.ClaimsMappingRename:
+		if value, ok := claims[rule.From]; ok {
+			claims[rule.Claim] = value
+			delete(claims, rule.From)
+		}
+	case model.ClaimsMappingDrop:
+		delete(claims, rule.Claim)
+	}
+	return nil
+}
+
+// evaluateClaimsMapping CEL式を評価し、JSONで表現できる値に変換して返します
+func evaluateClaimsMapping(expression string, target string, input ClaimsMappingInput, claims map[string]interface{}) (interface{}, error) {
+	program, err := claimsMappingProgram(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := input.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	// 構造体などCELで扱えない値を含む場合があるため、JSONで表現できる値に変換して渡す
+	current, err := toJSONMap(claims)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := program.Eval(map[string]interface{}{
+		"user":    nonNilMap(input.User),
+		"session": nonNilMap(input.Session),
+		"client":  nonNilMap(input.Client),
+		"scopes":  scopes,
+		"claims":  current,
+		"token":   target,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", expression, err)
+	}
+	if result == types.NullValue {
+		return nil, nil
+	}
+
+	native, err := result.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported result type for %q: %w", expression, err)
+	}
+	return native.(*structpb.Value).AsInterface(), nil
+}
+
+// claimsMappingProgram CEL式をコンパイルし、結果をキャッシュします
+func claimsMappingProgram(expression string) (cel.Program, error) {
+	if program, ok := claimsMappingPrograms.Load(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	env, err := newClaimsMappingEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, issues.Err())
+	}
+	program, err := env.Program(ast, cel.CostLimit(claimsMappingCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, err)
+	}
+
+	claimsMappingPrograms.Store(expression, program)
+	return program, nil
+}
+
+// newClaimsMappingEnv クレームマッピングで使用するCEL環境を返します
+func newClaimsMappingEnv() (*cel.Env, error) {
+	claimsMappingEnvOnce.Do(func() {
+		claimsMappingEnv, claimsMappingEnvErr = cel.NewEnv(
+			cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("session", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("client", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("scopes", cel.ListType(cel.StringType)),
+			cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("token", cel.StringType),
+		)
+	})
+	return claimsMappingEnv, claimsMappingEnvErr
+}
+
+func nonNilMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// toJSONMap 値をJSONに変換した上で map として読み直します
+func toJSONMap(value interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(encoded, &m); err != nil {
+		return nil, err
+	}
+	return nonNilMap(m), nil
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+const (
+	// DPoP証明の iat として許容する過去方向の幅
+	DPoPProofMaxAge = 5 * time.Minute
+	// DPoP証明の iat として許容する未来方向の幅 (時計のずれ)
+	dpopProofClockSkew = 1 * time.Minute
+	// サーバーが発行する nonce の有効期限
+	dpopNonceLifetime = 5 * time.Minute
+)
+
+// DPoPSigningAlgorithms DPoP証明の署名に使用できるアルゴリズム
+var DPoPSigningAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+}
+
+// DPoPProof 検証済みのDPoP証明
+type DPoPProof struct {
+	// 証明に使われた公開鍵のJWK SHA-256 Thumbprint (RFC 7638)
+	JKT      string
+	JTI      string
+	Nonce    string
+	IssuedAt time.Time
+}
+
+// VerifyDPoPProof DPoP証明 (RFC 9449 Section 4.3) を検証します
+// accessToken が空でない場合は ath クレームとアクセストークンのハッシュが一致することも検証します
+// jti の再利用と nonce の検証は呼び出し側で行います
+func VerifyDPoPProof(proof string, method string, uri string, accessToken string) (*DPoPProof, error) {
+	var jkt string
+	claims, err := verifyToken(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected typ: %v", token.Header["typ"])
+		}
+
+		// 署名検証には証明のヘッダーに含まれる公開鍵を使用する
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		encoded, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwk.ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk header: %w", err)
+		}
+		if private, err := jwk.IsPrivateKey(key); err != nil || private {
+			return nil, errors.New("jwk header must be a public key")
+		}
+
+		thumbprint, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		jkt = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+		var raw interface{}
+		if err := jwk.Export(key, &raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}, jwt.WithValidMethods(DPoPSigningAlgorithms))
+	if err != nil {
+		return nil, err
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, fmt.Errorf("htm mismatch: %s", htm)
+	}
+	if htu, _ := claims["htu"].(string); !sameHTU(htu, uri) {
+		return nil, fmt.Errorf("htu mismatch: %s", htu)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errors.New("missing jti")
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return nil, errors.New("missing iat")
+	}
+	now := time.Now()
+	if iat.Before(now.Add(-DPoPProofMaxAge)) || iat.After(now.Add(dpopProofClockSkew)) {
+		return nil, fmt.Errorf("iat out of range: %s", iat.Time)
+	}
+
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(hash[:]) {
+			return nil, errors.New("ath mismatch")
+		}
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	return &DPoPProof{
+		JKT:      jkt,
+		JTI:      jti,
+		Nonce:    nonce,
+		IssuedAt: iat.Time,
+	}, nil
+}
+
+// sameHTU htu クレームとリクエストURIをクエリとフラグメントを除いて比較します (RFC 9449 Section 4.3)
+func sameHTU(htu string, uri string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Host, b.Host) &&
+		a.EscapedPath() == b.EscapedPath()
+}
+
+// GenerateDPoPNonce サーバー発行の DPoP nonce を生成します
+// 発行時刻とHMACから構成されるため、サーバー側で状態を保持せずに検証できます
+func GenerateDPoPNonce(secret []byte) string {
+	issuedAt := make([]byte, 8)
+	binary.BigEndian.PutUint64(issuedAt, uint64(time.Now().Unix()))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(issuedAt)
+	return base64.RawURLEncoding.EncodeToString(append(issuedAt, mac.Sum(nil)...))
+}
+
+// VerifyDPoPNonce サーバーが発行した DPoP nonce を検証します
+func VerifyDPoPNonce(secret []byte, nonce string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(decoded) != 8+sha256.Size {
+		return false
+	}
+
+	issuedAt, signature := decoded[:8], decoded[8:]
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(issuedAt)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return false
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(issuedAt)), 0)
+	return time.Since(issued) <= dpopNonceLifetime
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+const (
+	testDPoPMethod = "POST"
+	testDPoPURI    = "https://auth.example.com/api/oauth/token"
+)
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, publicJWK, jkt := newTestDPoPKey(t)
+	now := time.Now()
+	accessToken := "access-token"
+	athHash := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(athHash[:])
+
+	// claims 既定のクレーム (有効な証明) に変更を加えたクレームを返す
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"htm":   testDPoPMethod,
+			"htu":   testDPoPURI,
+			"jti":   "jti-1",
+			"iat":   now.Unix(),
+			"nonce": "server-nonce",
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+				continue
+			}
+			c[name] = value
+		}
+		return c
+	}
+	privateJWK, err := jwk.Import(key)
+	if err != nil {
+		t.Fatalf("jwk.Import() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		header      map[string]interface{}
+		claims      jwt.MapClaims
+		method      string
+		uri         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "valid", claims: claims(nil)},
+		{name: "htu with query and fragment", claims: claims(nil), uri: testDPoPURI + "?x=1#f"},
+		{name: "htu scheme and host case", claims: claims(jwt.MapClaims{"htu": "HTTPS://AUTH.example.com/api/oauth/token"})},
+		{name: "htm mismatch", claims: claims(jwt.MapClaims{"htm": "GET"}), wantErr: true},
+		{name: "htm lower case", claims: claims(jwt.MapClaims{"htm": "post"}), wantErr: true},
+		{name: "htu path mismatch", claims: claims(jwt.MapClaims{"htu": "https://auth.example.com/api/oauth/revoke"}), wantErr: true},
+		{name: "htu host mismatch", claims: claims(jwt.MapClaims{"htu": "https://evil.example.com/api/oauth/token"}), wantErr: true},
+		{name: "missing htu", claims: claims(jwt.MapClaims{"htu": nil}), wantErr: true},
+		{name: "missing jti", claims: claims(jwt.MapClaims{"jti": nil}), wantErr: true},
+		{name: "missing iat", claims: claims(jwt.MapClaims{"iat": nil}), wantErr: true},
+		{name: "iat too old", claims: claims(jwt.MapClaims{"iat": now.Add(-DPoPProofMaxAge - time.Minute).Unix()}), wantErr: true},
+		{name: "iat within clock skew", claims: claims(jwt.MapClaims{"iat": now.Add(30 * time.Second).Unix()})},
+		{name: "iat in the future", claims: claims(jwt.MapClaims{"iat": now.Add(dpopProofClockSkew + time.Minute).Unix()}), wantErr: true},
+		{name: "ath", claims: claims(jwt.MapClaims{"ath": ath}), accessToken: accessToken},
+		{name: "ath mismatch", claims: claims(jwt.MapClaims{"ath": ath}), accessToken: "other-token", wantErr: true},
+		{name: "missing ath", claims: claims(nil), accessToken: accessToken, wantErr: true},
+		{name: "wrong typ", header: map[string]interface{}{"typ": "JWT"}, claims: claims(nil), wantErr: true},
+		{name: "missing jwk", header: map[string]interface{}{"jwk": nil}, claims: claims(nil), wantErr: true},
+		{name: "private jwk", header: map[string]interface{}{"jwk": privateJWK}, claims: claims(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]interface{}{"typ": "dpop+jwt", "jwk": publicJWK}
+			for name, value := range tt.header {
+				if value == nil {
+					delete(header, name)
+					continue
+				}
+				header[name] = value
+			}
+			proof := signTestDPoPProof(t, key, header, tt.claims)
+
+			method, uri := tt.method, tt.uri
+			if method == "" {
+				method = testDPoPMethod
+			}
+			if uri == "" {
+				uri = testDPoPURI
+			}
+			verified, err := VerifyDPoPProof(proof, method, uri, tt.accessToken)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyDPoPProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if verified.JKT != jkt {
+				t.Errorf("JKT = %s, want %s", verified.JKT, jkt)
+			}
+			if verified.JTI != "jti-1" || verified.Nonce != "server-nonce" {
+				t.Errorf("JTI, Nonce = %s, %s", verified.JTI, verified.Nonce)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProofSignature(t *testing.T) {
+	key, publicJWK, _ := newTestDPoPKey(t)
+	_, otherJWK, _ := newTestDPoPKey(t)
+	claims := jwt.MapClaims{"htm": testDPoPMethod, "htu": testDPoPURI, "jti": "jti-1", "iat": time.Now().Unix()}
+
+	// ヘッダーの公開鍵と署名の鍵が一致しない
+	proof := signTestDPoPProof(t, key, map[string]interface{}{"typ": "dpop+jwt", "jwk": otherJWK}, claims)
+	if _, err := VerifyDPoPProof(proof, testDPoPMethod, testDPoPURI, ""); err == nil {
+		t.Error("VerifyDPoPProof() with a mismatched jwk succeeded")
+	}
+
+	// 許可していないアルゴリズム (HS256)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = publicJWK
+	hs256, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	if _, err := VerifyDPoPProof(hs256, testDPoPMethod, testDPoPURI, ""); err == nil {
+		t.Error("VerifyDPoPProof() with HS256 succeeded")
+	}
+}
+
+func TestVerifyDPoPNonce(t *testing.T) {
+	secret := []byte("nonce-secret")
+	valid := GenerateDPoPNonce(secret)
+	// HMAC の部分の1文字を置き換えた nonce
+	tampered := []byte(valid)
+	if tampered[20] == 'A' {
+		tampered[20] = 'B'
+	} else {
+		tampered[20] = 'A'
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		nonce  string
+		want   bool
+	}{
+		{name: "valid", secret: secret, nonce: valid, want: true},
+		{name: "other secret", secret: []byte("other-secret"), nonce: valid},
+		{name: "tampered", secret: secret, nonce: string(tampered)},
+		{name: "expired", secret: secret, nonce: testDPoPNonce(secret, time.Now().Add(-dpopNonceLifetime-time.Minute))},
+		{name: "recent", secret: secret, nonce: testDPoPNonce(secret, time.Now().Add(-time.Minute)), want: true},
+		{name: "malformed", secret: secret, nonce: "not-a-nonce"},
+		{name: "empty", secret: secret, nonce: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyDPoPNonce(tt.secret, tt.nonce); got != tt.want {
+				t.Errorf("VerifyDPoPNonce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestDPoPKey DPoP証明の署名に使用する ES256 の鍵と、ヘッダーに含める公開鍵 (JWK) とその Thumbprint を返します
+func newTestDPoPKey(t *testing.T) (*ecdsa.PrivateKey, map[string]interface{}, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	public, err := jwk.Import(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("jwk.Import() error = %v", err)
+	}
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Thumbprint() error = %v", err)
+	}
+	encoded, err := json.Marshal(public)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(encoded, &header); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return key, header, base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+// signTestDPoPProof ヘッダーとクレームを指定してDPoP証明を作成します
+func signTestDPoPProof(t *testing.T, key *ecdsa.PrivateKey, header map[string]interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	for name, value := range header {
+		token.Header[name] = value
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return signed
+}
+
+// testDPoPNonce 発行時刻を指定して DPoP nonce を作成します (GenerateDPoPNonce と同じ形式)
+func testDPoPNonce(secret []byte, issuedAt time.Time) string {
+	nonce := make([]byte, 8)
+	binary.BigEndian.PutUint64(nonce, uint64(issuedAt.Unix()))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	return base64.RawURLEncoding.EncodeToString(append(nonce, mac.Sum(nil)...))
+}
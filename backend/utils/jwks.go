@@ -1,12 +1,19 @@
 package utils
 
 import (
+	"backend/model"
+	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
+	"time"
 
+	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
@@ -16,22 +23,70 @@ var (
 	privateKey *rsa.PrivateKey
 	publicKey  *rsa.PublicKey
 	keyID      string
+
+	// リクエストオブジェクト (JWE) の復号に使用する暗号化用の鍵ペア
+	encPrivateKey *rsa.PrivateKey
+	encKeyID      string
 )
 
-// InitJWKS RSA鍵ペアを初期化し、JWKSを生成します
-func InitJWKS() error {
-	// 鍵ペアの生成
+// KeyStore サーバーの鍵の保存先 (store.KeyRepository)
+type KeyStore interface {
+	GetOrCreateKey(ctx context.Context, key model.Key) (*model.Key, error)
+}
+
+// InitJWKS 署名用と暗号化用のRSA鍵ペアを読み込みます
+// 鍵が保存されていない場合は生成して保存するため、複数のインスタンスで同じ鍵を使用します
+func InitJWKS(ctx context.Context, keys KeyStore) error {
+	// 署名用と暗号化用で鍵を分ける
 	var err error
-	privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err = loadOrCreateKey(ctx, keys, model.KeyUseSignature)
 	if err != nil {
-		return fmt.Errorf("failed to generate signing key: %w", err)
+		return fmt.Errorf("failed to load signing key: %w", err)
 	}
 	publicKey = &privateKey.PublicKey
 	keyID = generateKeyID(publicKey)
 
+	encPrivateKey, err = loadOrCreateKey(ctx, keys, model.KeyUseEncryption)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	encKeyID = generateKeyID(&encPrivateKey.PublicKey)
+
 	return nil
 }
 
+// loadOrCreateKey 用途ごとの鍵を読み込み、保存されていない場合は生成します
+func loadOrCreateKey(ctx context.Context, keys KeyStore, use string) (*rsa.PrivateKey, error) {
+	generated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(generated)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := keys.GetOrCreateKey(ctx, model.Key{
+		KeyID:      generateKeyID(&generated.PublicKey),
+		Use:        use,
+		PrivateKey: der,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected key type: %T", parsed)
+	}
+	return key, nil
+}
+
 // GetJWKS JWKSを返します
 func GetJWKS() (map[string]interface{}, error) {
 	key, err := jwk.Import(publicKey)
@@ -49,16 +104,67 @@ func GetJWKS() (map[string]interface{}, error) {
 		return nil, err
 	}
 
+	encKey, err := jwk.Import(&encPrivateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWK: %w", err)
+	}
+
+	if err := encKey.Set(jwk.KeyIDKey, encKeyID); err != nil {
+		return nil, err
+	}
+	if err := encKey.Set(jwk.AlgorithmKey, jwa.RSA_OAEP_256()); err != nil {
+		return nil, err
+	}
+	if err := encKey.Set(jwk.KeyUsageKey, "enc"); err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
-		"keys": []interface{}{key},
+		"keys": []interface{}{key, encKey},
 	}, nil
 }
 
+// ParseJWKS JSON形式のJWKSを解析します
+func ParseJWKS(data []byte) (jwk.Set, error) {
+	return jwk.Parse(data)
+}
+
+// FetchJWKS jwks_uri からJWKSを取得します
+func FetchJWKS(ctx context.Context, uri string) (jwk.Set, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
 // 鍵IDの生成
+// 公開鍵の JWK SHA-256 Thumbprint (RFC 7638) を使用するため、鍵ごとに異なる kid になります
 func generateKeyID(key *rsa.PublicKey) string {
-	publicKeyDER, err := x509.MarshalPKIXPublicKey(key)
+	publicJWK, err := jwk.Import(key)
+	if err != nil {
+		return ""
+	}
+	thumbprint, err := publicJWK.Thumbprint(crypto.SHA256)
 	if err != nil {
 		return ""
 	}
-	return base64.RawURLEncoding.EncodeToString(publicKeyDER[:8])
+	return base64.RawURLEncoding.EncodeToString(thumbprint)
 }
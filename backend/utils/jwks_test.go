@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestGenerateKeyID(t *testing.T) {
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+
+	kid := generateKeyID(&first.PublicKey)
+	// SHA-256 の base64url エンコード (パディングなし) は43文字になる
+	if len(kid) != 43 {
+		t.Errorf("generateKeyID() = %q, want a 43 character thumbprint", kid)
+	}
+	if again := generateKeyID(&first.PublicKey); again != kid {
+		t.Errorf("generateKeyID() = %q, then %q for the same key", kid, again)
+	}
+	// 同じ長さの鍵でも DER の先頭は共通のため、鍵全体から求めた値でなければ重複する
+	if other := generateKeyID(&second.PublicKey); other == kid {
+		t.Errorf("generateKeyID() = %q for two different keys", kid)
+	}
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
-	"crypto/rand"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -11,6 +11,9 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Issuer トークンの発行者識別子
+const Issuer = "https://auth.example.com"
+
 // GenerateToken JWTトークンを生成します
 func GenerateToken(claims jwt.MapClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
@@ -18,78 +21,148 @@ func GenerateToken(claims jwt.MapClaims) (string, error) {
 	return token.SignedString(privateKey)
 }
 
+// IDTokenParams IDトークンの発行パラメータ
+type IDTokenParams struct {
+	Subject   string
+	ClientID  string
+	IssuedAt  time.Time
+	ExpiresIn int64
+	// 認可リクエストで指定された nonce (リフレッシュ時は空)
+	Nonce string
+	// ユーザーが認証した時刻と方式
+	AuthTime time.Time
+	AMR      []string
+	ACR      string
+	// 同時に発行するアクセストークンと認可コード。指定した場合は at_hash / c_hash を付与します
+	AccessToken       string
+	AuthorizationCode string
+	// email や profile などのユーザーのクレーム。登録済みのクレームは上書きしません
+	Claims map[string]interface{}
+}
+
 // GenerateIDToken IDトークンを生成します
-func GenerateIDToken(userID, email string, clientID string, issuedAt time.Time, expiresIn int64) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":            userID,
-		"email":          email,
-		"email_verified": true,
-		"iat":            issuedAt.Unix(),
-		"exp":            issuedAt.Add(time.Duration(expiresIn) * time.Second).Unix(),
-		"iss":            "https://auth.example.com",
-		"aud":            clientID,
+func GenerateIDToken(params IDTokenParams) (string, error) {
+	claims := jwt.MapClaims{}
+	for name, value := range params.Claims {
+		claims[name] = value
+	}
+	claims["sub"] = params.Subject
+	claims["iat"] = params.IssuedAt.Unix()
+	claims["exp"] = params.IssuedAt.Add(time.Duration(params.ExpiresIn) * time.Second).Unix()
+	claims["iss"] = Issuer
+	claims["aud"] = params.ClientID
+	if params.Nonce != "" {
+		claims["nonce"] = params.Nonce
+	}
+	if !params.AuthTime.IsZero() {
+		claims["auth_time"] = params.AuthTime.Unix()
+	}
+	if len(params.AMR) > 0 {
+		claims["amr"] = params.AMR
+	}
+	if params.ACR != "" {
+		claims["acr"] = params.ACR
+	}
+	if params.AccessToken != "" {
+		claims["at_hash"] = tokenHash(params.AccessToken)
+	}
+	if params.AuthorizationCode != "" {
+		claims["c_hash"] = tokenHash(params.AuthorizationCode)
 	}
 
 	return GenerateToken(claims)
 }
 
-// GenerateAccessToken アクセストークンを生成します
-func GenerateAccessToken(userID string, clientID string, issuedAt time.Time, expiresIn int64) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"iat": issuedAt.Unix(),
-		"exp": issuedAt.Add(time.Duration(expiresIn) * time.Second).Unix(),
-		"iss": "https://auth.example.com",
-		"aud": clientID,
-		"typ": "Bearer",
-	}
+// tokenHash at_hash / c_hash の値を計算します (OpenID Connect Core 1.0 Section 3.1.3.6)
+// 署名アルゴリズム (RS256) に対応する SHA-256 ハッシュの左半分を base64url エンコードします
+func tokenHash(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(hash[:len(hash)/2])
+}
 
-	return GenerateToken(claims)
+// AccessTokenParams アクセストークンの発行パラメータ
+type AccessTokenParams struct {
+	Subject   string
+	ClientID  string
+	Audience  []string // 空の場合はクライアントIDを audience とします
+	Scope     string
+	IssuedAt  time.Time
+	ExpiresIn int64
+	// 委任時の実行者を表す act クレーム (RFC 8693 Section 4.1)
+	Actor map[string]interface{}
+	// 送信者制約トークンの確認クレーム cnf (RFC 7800)
+	Confirmation map[string]string
+	// クレームマッピングなどで追加するクレーム。登録済みのクレームは上書きしません
+	Claims map[string]interface{}
+	// トークンの識別子 (jti)。UserInfo に対するクレームの要求など、トークンごとにサーバー側で保存した情報の参照に使用します
+	TokenID string
+	// ユーザーの所属グループとロール (クライアントに公開するもののみ)
+	Groups []string
+	Roles  []string
 }
 
-// GenerateRefreshToken リフレッシュトークンを生成します
-func GenerateRefreshToken(userID string) (string, error) {
-	randomBytes := make([]byte, 32)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return "", err
+// GenerateAccessToken アクセストークンを生成します
+func GenerateAccessToken(params AccessTokenParams) (string, error) {
+	claims := jwt.MapClaims{}
+	for name, value := range params.Claims {
+		claims[name] = value
 	}
-
-	data := struct {
-		UserID   string    `json:"user_id"`
-		Random   []byte    `json:"random"`
-		IssuedAt time.Time `json:"issued_at"`
-	}{
-		UserID:   userID,
-		Random:   randomBytes,
-		IssuedAt: time.Now(),
+	claims["sub"] = params.Subject
+	claims["client_id"] = params.ClientID
+	claims["iat"] = params.IssuedAt.Unix()
+	claims["exp"] = params.IssuedAt.Add(time.Duration(params.ExpiresIn) * time.Second).Unix()
+	claims["iss"] = Issuer
+	claims["aud"] = audienceClaim(params.ClientID, params.Audience)
+	claims["typ"] = "Bearer"
+	if params.Scope != "" {
+		claims["scope"] = params.Scope
 	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return "", err
+	if params.Actor != nil {
+		claims["act"] = params.Actor
+	}
+	if len(params.Confirmation) > 0 {
+		claims["cnf"] = params.Confirmation
+	}
+	if params.TokenID != "" {
+		claims["jti"] = params.TokenID
+	}
+	if len(params.Groups) > 0 {
+		claims["groups"] = params.Groups
+	}
+	if len(params.Roles) > 0 {
+		claims["roles"] = params.Roles
 	}
 
-	encoded := base64.RawURLEncoding.EncodeToString(jsonData)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"token_data": encoded,
-		"iat":        time.Now().Unix(),
-	})
+	return GenerateToken(claims)
+}
 
-	return token.SignedString(privateKey)
+// audienceClaim aud クレームの値を返します
+// 単一の audience の場合は文字列、複数の場合は配列とします
+func audienceClaim(clientID string, audience []string) interface{} {
+	switch len(audience) {
+	case 0:
+		return clientID
+	case 1:
+		return audience[0]
+	default:
+		return audience
+	}
 }
 
 // IDトークンを検証してクレームを返す
 func VerifyIDToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	return verifyToken(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// 署名アルゴリズムの検証
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return publicKey, nil
 	})
+}
 
+// verifyToken JWTの署名と標準クレームを検証してクレームを返します
+func verifyToken(tokenString string, keyFunc jwt.Keyfunc, options ...jwt.ParserOption) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, keyFunc, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -105,3 +178,32 @@ func VerifyIDToken(tokenString string) (jwt.MapClaims, error) {
 
 	return claims, nil
 }
+
+// VerifyAccessToken このサーバーが発行したアクセストークンを検証してクレームを返します
+func VerifyAccessToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := verifyToken(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return publicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// IDトークンやリフレッシュトークンをアクセストークンとして受け入れない
+	if typ, _ := claims["typ"].(string); typ != "Bearer" {
+		return nil, errors.New("not an access token")
+	}
+
+	return claims, nil
+}
+
+// PairwiseSubject セクターごとのペアワイズ識別子を計算します (OpenID Connect Core 1.0 Section 8.1)
+// 同じセクターとユーザーに対しては常に同じ値になり、セクターが異なると紐付けられない値になります
+func PairwiseSubject(secret []byte, sector string, userID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sector + "\n" + userID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
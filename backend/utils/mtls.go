@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/url"
+
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// ParseClientCertificateHeader プロキシから転送されたクライアント証明書ヘッダーを解析します
+// ALB の mTLS と同じく、URLエンコードされたPEM形式 (先頭がリーフ証明書の証明書チェーン) を想定しています
+// Base64の "+" を空白として扱わないよう、パスエスケープとしてデコードします
+func ParseClientCertificateHeader(value string) ([]*x509.Certificate, error) {
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	rest := []byte(decoded)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate in header")
+	}
+	return chain, nil
+}
+
+// CertificateThumbprint 証明書のSHA-256 Thumbprint (cnf の x5t#S256) を返します (RFC 8705 Section 3.1)
+func CertificateThumbprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// CertificateKeyRegistered 証明書の公開鍵がクライアントの登録済み公開鍵 (JWKS) に含まれるかを返します
+// self_signed_tls_client_auth (RFC 8705 Section 2.2) で使用します
+func CertificateKeyRegistered(keys jwk.Set, cert *x509.Certificate) bool {
+	if keys == nil {
+		return false
+	}
+	for i := 0; i < keys.Len(); i++ {
+		key, ok := keys.Key(i)
+		if !ok {
+			continue
+		}
+		var raw interface{}
+		if err := jwk.Export(key, &raw); err != nil {
+			continue
+		}
+		if public, ok := raw.(interface{ Equal(crypto.PublicKey) bool }); ok && public.Equal(cert.PublicKey) {
+			return true
+		}
+	}
+	return false
+}
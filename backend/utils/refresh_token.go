@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+	"hash/crc32"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RefreshTokenPrefix リフレッシュトークンの接頭辞
+// シークレットスキャン (GitHub の secret scanning など) で漏洩したトークンを検出できるよう、固定の接頭辞を付けます
+const RefreshTokenPrefix = "rft_"
+
+const (
+	// リフレッシュトークンの乱数部分の長さ (256ビットを base62 で表した文字数)
+	refreshTokenBodyLength = 43
+	// チェックサム (CRC32 を base62 で表した文字数)
+	refreshTokenChecksumLength = 6
+)
+
+const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" // big.Int.Text(62) と同じ順序
+
+// GenerateRefreshToken リフレッシュトークンを生成します
+// トークンは rft_<乱数 (base62)><チェックサム (base62)> の形式で、ユーザーIDなどの情報は含みません
+// (トークンに紐付く情報はすべて保存先のトークンセッションに保存します)
+// チェックサムにより、保存先を参照せずに打ち間違いや無関係な文字列を除外でき、シークレットスキャンの誤検出も減らせます
+func GenerateRefreshToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	body := RefreshTokenPrefix + encodeBase62(randomBytes, refreshTokenBodyLength)
+	return body + refreshTokenChecksum(body), nil
+}
+
+// CheckRefreshToken 提示されたリフレッシュトークンの形式を確認します
+// 以前の形式 (署名付きの JWT) のトークンは、発行済みのトークンの有効期限 (最長30日) が切れるまで受け入れます
+// 保存先に存在するかは確認しないため、形式が正しい場合もトークンセッションを取得して確認してください
+func CheckRefreshToken(token string) error {
+	if IsLegacyRefreshToken(token) {
+		return nil
+	}
+	body, ok := strings.CutPrefix(token, RefreshTokenPrefix)
+	if !ok || len(body) != refreshTokenBodyLength+refreshTokenChecksumLength {
+		return errors.New("malformed refresh token")
+	}
+	if strings.Trim(body, base62Alphabet) != "" {
+		return errors.New("malformed refresh token")
+	}
+	split := len(token) - refreshTokenChecksumLength
+	if token[split:] != refreshTokenChecksum(token[:split]) {
+		return errors.New("refresh token checksum mismatch")
+	}
+	return nil
+}
+
+// IsLegacyRefreshToken 以前の形式 (ユーザーIDなどを含む JWT) のリフレッシュトークンか
+// 署名は検証しません (保存先にトークンセッションが存在することで有効性を確認します)
+func IsLegacyRefreshToken(token string) bool {
+	if strings.Count(token, ".") != 2 {
+		return false
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return false
+	}
+	_, ok := claims["token_data"]
+	return ok
+}
+
+// refreshTokenChecksum 接頭辞と乱数部分の CRC32 を base62 で返します
+func refreshTokenChecksum(body string) string {
+	sum := crc32.ChecksumIEEE([]byte(body))
+	return encodeBase62(big.NewInt(int64(sum)).Bytes(), refreshTokenChecksumLength)
+}
+
+// encodeBase62 バイト列を base62 で表し、先頭を 0 で埋めて length 文字にします
+func encodeBase62(data []byte, length int) string {
+	encoded := new(big.Int).SetBytes(data).Text(62)
+	if len(encoded) < length {
+		encoded = strings.Repeat("0", length-len(encoded)) + encoded
+	}
+	return encoded
+}
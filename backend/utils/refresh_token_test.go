@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	token, err := GenerateRefreshToken()
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error = %v", err)
+	}
+	// 乱数部分の1文字を置き換えたトークン (チェックサムが一致しない)
+	replaced := "0"
+	if token[10] == '0' {
+		replaced = "1"
+	}
+	tampered := token[:10] + replaced + token[11:]
+
+	legacy := signTestJWT(t, jwt.MapClaims{"token_data": map[string]interface{}{"user_id": "u1"}})
+	otherJWT := signTestJWT(t, jwt.MapClaims{"sub": "u1"})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "generated", token: token},
+		{name: "checksum mismatch", token: tampered, wantErr: true},
+		{name: "missing prefix", token: strings.TrimPrefix(token, RefreshTokenPrefix), wantErr: true},
+		{name: "wrong prefix", token: "rfx_" + strings.TrimPrefix(token, RefreshTokenPrefix), wantErr: true},
+		{name: "too short", token: token[:len(token)-1], wantErr: true},
+		{name: "too long", token: token + "0", wantErr: true},
+		{name: "invalid character", token: token[:10] + "-" + token[11:], wantErr: true},
+		{name: "empty", token: "", wantErr: true},
+		{name: "legacy JWT", token: legacy},
+		{name: "JWT without token_data", token: otherJWT, wantErr: true},
+		{name: "dotted garbage", token: "a.b.c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRefreshToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckRefreshToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateRefreshTokenFormat(t *testing.T) {
+	seen := map[string]bool{}
+	for range 100 {
+		token, err := GenerateRefreshToken()
+		if err != nil {
+			t.Fatalf("GenerateRefreshToken() error = %v", err)
+		}
+		if want := len(RefreshTokenPrefix) + refreshTokenBodyLength + refreshTokenChecksumLength; len(token) != want {
+			t.Errorf("len(token) = %d, want %d", len(token), want)
+		}
+		if seen[token] {
+			t.Errorf("duplicate token %s", token)
+		}
+		seen[token] = true
+		if err := CheckRefreshToken(token); err != nil {
+			t.Errorf("CheckRefreshToken(%s) error = %v", token, err)
+		}
+	}
+}
+
+// signTestJWT 以前の形式のリフレッシュトークンと同じ構造の JWT を作成します (署名は検証されません)
+func signTestJWT(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return token
+}
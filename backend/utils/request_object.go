@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// RequestObjectSigningAlgorithms リクエストオブジェクトの署名に使用できるアルゴリズム ("none" は受け付けない)
+var RequestObjectSigningAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+}
+
+// RequestObjectMaxLifetime リクエストオブジェクトの有効期限 (exp) として受け付ける最大の期間
+// 再利用の検出のため jti を exp まで保持するので、保持する期間に上限を設けます
+const RequestObjectMaxLifetime = 60 * time.Minute
+
+// RequestObject 検証済みのリクエストオブジェクト
+type RequestObject struct {
+	Claims    jwt.MapClaims
+	JTI       string
+	ExpiresAt time.Time
+}
+
+// VerifyRequestObject 署名付きリクエストオブジェクト (RFC 9101) を検証します
+// JWE で暗号化されている場合は、サーバーの暗号化鍵で復号してから署名を検証します
+// exp と jti は必須です。jti が使用済みでないかは呼び出し側で確認してください
+func VerifyRequestObject(requestObject string, clientID string, clientKeys jwk.Set) (*RequestObject, error) {
+	// JWE Compact Serialization は5つのパートで構成される
+	if strings.Count(requestObject, ".") == 4 {
+		decrypted, err := jwe.Decrypt([]byte(requestObject), jwe.WithKey(jwa.RSA_OAEP_256(), encPrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt request object: %w", err)
+		}
+		requestObject = string(decrypted)
+	}
+
+	claims, err := verifyToken(requestObject, func(token *jwt.Token) (interface{}, error) {
+		return lookupVerificationKey(clientKeys, token)
+	},
+		jwt.WithValidMethods(RequestObjectSigningAlgorithms),
+		jwt.WithIssuer(clientID),
+		jwt.WithAudience(Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil {
+		return nil, err
+	}
+	if time.Until(expiresAt.Time) > RequestObjectMaxLifetime {
+		return nil, fmt.Errorf("request object expires too far in the future: %s", expiresAt.Time)
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errors.New("missing jti in request object")
+	}
+
+	// client_id クレームはリクエストを送信したクライアントと一致しなければならない (RFC 9101 Section 5)
+	if claimClientID, _ := claims["client_id"].(string); claimClientID != clientID {
+		return nil, fmt.Errorf("client_id mismatch in request object: %s", claimClientID)
+	}
+
+	return &RequestObject{Claims: claims, JTI: jti, ExpiresAt: expiresAt.Time}, nil
+}
+
+// lookupVerificationKey クライアントのJWKSから署名検証用の公開鍵を取得します
+// kid が指定されていない場合は、JWKSに鍵が1つだけ登録されているときに限りその鍵を使用します
+func lookupVerificationKey(keys jwk.Set, token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, errors.New("client has no registered keys")
+	}
+
+	var key jwk.Key
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		found, ok := keys.LookupKeyID(kid)
+		if !ok {
+			return nil, fmt.Errorf("key not found: %s", kid)
+		}
+		key = found
+	} else if keys.Len() == 1 {
+		key, _ = keys.Key(0)
+	} else {
+		return nil, errors.New("missing kid in token header")
+	}
+
+	var raw interface{}
+	if err := jwk.Export(key, &raw); err != nil {
+		return nil, fmt.Errorf("failed to export key: %w", err)
+	}
+	return raw, nil
+}
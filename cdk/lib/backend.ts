@@ -288,6 +288,14 @@ export class BackendStack extends cdk.Stack {
       }),
     });
     container.addEnvironment("REDIS_ADDR", props.elasticacheStack.cacheAddr);
+    // Route user and client lookups to the reader endpoint (replicas).
+    container.addEnvironment(
+      "REDIS_READER_ADDR",
+      props.elasticacheStack.cacheReaderAddr
+    );
+    container.addEnvironment("REDIS_READ_FROM_REPLICAS", "true");
+    // Retry commands that fail while the primary is failing over.
+    container.addEnvironment("REDIS_MAX_RETRIES", "5");
     container.addEnvironment(
       "REDIS_AUTH_TOKEN",
       props.elasticacheStack.redisSecret
@@ -310,6 +318,19 @@ export class BackendStack extends cdk.Stack {
       "AUTH_SESSION_COOKIE_DOMAIN",
       `${authHubHostedZone.zoneName}`
     );
+    container.addEnvironment(
+      "DEVICE_VERIFICATION_URI",
+      `https://${projectName}-${deployEnv}-auth-hub.${authHubHostedZone.zoneName}/device`
+    );
+    container.addEnvironment(
+      "AUTHORIZATION_ENDPOINT",
+      `https://${projectName}-${deployEnv}-auth-hub.${authHubHostedZone.zoneName}/login`
+    );
+    // Public URL of this API, used for the endpoints published in discovery.
+    container.addEnvironment(
+      "API_BASE_URL",
+      `https://${projectName}-${deployEnv}-api.${currentEnvConfig.apiDomain}`
+    );
 
     // Service
     const service = new ecs.FargateService(this, "Service", {
@@ -22,6 +22,10 @@ export class ElasticacheStack extends cdk.Stack {
    * Address of the Elasticache.
    */
   public readonly cacheAddr: string;
+  /**
+   * Reader endpoint address of the Elasticache.
+   */
+  public readonly cacheReaderAddr: string;
   /**
    * Redis secret.
    */
@@ -97,11 +101,14 @@ export class ElasticacheStack extends cdk.Stack {
         ).ref,
         numNodeGroups: 1,
         replicasPerNodeGroup: 1,
+        automaticFailoverEnabled: true,
+        multiAzEnabled: true,
         securityGroupIds: [cacheSg.securityGroupId],
         atRestEncryptionEnabled: true,
         transitEncryptionEnabled: true,
       }
     );
     this.cacheAddr = `${cluster.attrPrimaryEndPointAddress}:${cluster.attrPrimaryEndPointPort}`;
+    this.cacheReaderAddr = `${cluster.attrReaderEndPointAddress}:${cluster.attrReaderEndPointPort}`;
   }
 }